@@ -9,6 +9,8 @@ import (
 	"net/http"
 	_ "net/http/pprof"
 	"os"
+	"strconv"
+	"strings"
 	. "utils"
 )
 
@@ -35,6 +37,10 @@ func (p *ClPayload) Play(w *Worker) {
 	input := p.file
 	fmt.Printf("Info tokenize worker:%s <%d> file:%s \n", w.Name(), GetGID(), input)
 	tokens := Tokenize(input, true, nil)
+	if tokens == nil {
+		fmt.Printf("Error tokenize worker:%s <%d> file:%s \n", w.Name(), GetGID(), input)
+		return
+	}
 	fmt.Printf("Info done worker:%s <%d> file:%s tokens:%d \n", w.Name(), GetGID(), input, tokens.Len())
 	p.tokens = tokens
 }
@@ -44,6 +50,19 @@ func do_cl(cfgs []CfgConfig) {
 	dispatch := NewDispatcher("cl", 8, jobQueue, false)
 	dispatch.Run()
 
+	// Warnings are set for the whole process, so the settings of all
+	// configs are merged.
+	for _, cfg := range cfgs {
+		for name, state := range cfg.Warn {
+			if !Set_warning(name, state) {
+				fmt.Printf("Error Unknown warning %s:%s \n", name, state)
+			}
+		}
+		for _, flag := range cfg.Flag {
+			Warning_option(flag)
+		}
+	}
+
 	for _, cfg := range cfgs {
 		inputs := cfg.Input
 		for _, input := range inputs {
@@ -100,33 +119,54 @@ func main() {
 	dump_ir1 := false
 	dump_ir2 := false
 
-	if len(os.Args) == 3 && os.Args[1] == "-dump-ir1" {
-		dump_ir1 = true
-		path = os.Args[2]
-	} else if len(os.Args) == 3 && os.Args[1] == "-dump-ir2" {
-		dump_ir2 = true
-		path = os.Args[2]
-	} else {
-		if len(os.Args) != 2 {
+	for _, arg := range os.Args[1:] {
+		switch {
+		case arg == "-dump-ir1":
+			dump_ir1 = true
+		case arg == "-dump-ir2":
+			dump_ir2 = true
+		case strings.HasPrefix(arg, "-fmax-errors="):
+			n, err := strconv.Atoi(strings.TrimPrefix(arg, "-fmax-errors="))
+			if err != nil || n < 0 {
+				usage()
+			}
+			Set_max_errors(n)
+		case strings.HasPrefix(arg, "-I") && len(arg) > 2:
+			Add_include_path(arg[2:])
+		case Warning_option(arg):
+		case path == "" && (arg == "-" || !strings.HasPrefix(arg, "-")):
+			path = arg
+		default:
 			usage()
 		}
-		path = os.Args[1]
+	}
+	if path == "" {
+		usage()
 	}
 
-	// Tokenize and parse.
+	// Tokenize and parse. Each pass reports as many errors as it
+	// can, and the compilation stops before code generation if
+	// there are any. The tree is not analyzed after syntax errors,
+	// since the declarations skipped by the parser would cause
+	// spurious errors.
 	tokens := Tokenize(path, true, nil)
+	check_errors(tokens == nil)
 	if debug {
 		Print_tokens(tokens)
 	}
 	nodes := Parse(tokens)
+	check_errors(Error_count() > 0)
 	globals := Sema(nodes)
+	check_errors(Error_count() > 0)
 	fns := Gen_ir(nodes)
+	check_errors(Error_count() > 0)
 
 	if dump_ir1 {
 		Dump_ir(fns)
 	}
 
 	Alloc_regs(fns)
+	check_errors(Error_count() > 0)
 	if dump_ir2 {
 		Dump_ir(fns)
 	}
@@ -134,4 +174,15 @@ func main() {
 	Gen_x86(globals, fns)
 }
 
-func usage() { ErrorReport("Usage: 9ccgo [-test] [-dump-ir1] [-dump-ir2] <file>") }
+// Exits with an error status if stop is true or the error limit has
+// been reached.
+func check_errors(stop bool) {
+	if stop || Too_many_errors() {
+		os.Exit(1)
+	}
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage: 9ccgo [-test] [-dump-ir1] [-dump-ir2] [-fmax-errors=N] [-Idir] [-W...] <file>\n")
+	os.Exit(1)
+}
@@ -31,6 +31,15 @@ type Type struct {
 	size  int // sizeof
 	align int // alignof
 
+	// Type qualifiers (QUAL_*). A qualified type is a copy of the
+	// unqualified one, which is kept in origin.
+	qual   int
+	origin *Type
+
+	// Integer types. _Bool is an unsigned integer type whose
+	// value is always 0 or 1.
+	is_unsigned bool
+
 	// Pointer
 	ptr_to *Type
 
@@ -38,12 +47,16 @@ type Type struct {
 	ary_of *Type
 	len    int
 
-	// Struct
-	members *Vector
-	offset  int
+	// Struct or union
+	members  *Vector
+	is_union bool
 
-	// Function
-	returning *Type
+	// Function. A function declared as `f()` has no prototype, so
+	// its calls are not checked against parameters.
+	returning   *Type
+	params      *Vector // Parameter declarations (ND_VARDEF)
+	is_variadic bool
+	no_proto    bool
 }
 
 // token.go
@@ -94,6 +107,37 @@ const TK_ALIGNOF = 298  // "_Alignof"
 const TK_TYPEOF = 299   // "typeof"
 const TK_PARAM = 300    // Function-like macro parameter
 const TK_EOF = 301      // End marker
+const TK_ELLIPSIS = 302 // ...
+const TK_SHORT = 303    // "short"
+const TK_LONG = 304     // "long"
+const TK_SIGNED = 305   // "signed"
+const TK_UNSIGNED = 306 // "unsigned"
+const TK_FLOAT = 307    // "float"
+const TK_DOUBLE = 308   // "double"
+const TK_TRUE = 309     // "true"
+const TK_FALSE = 310    // "false"
+const TK_UNQUAL = 311   // "typeof_unqual"
+const TK_AUTO = 312     // "auto" or "__auto_type"
+const TK_CONST = 313    // "const"
+const TK_VOLATILE = 314 // "volatile"
+const TK_RESTRICT = 315 // "restrict"
+const TK_ATOMIC = 316   // "_Atomic"
+const TK_STATIC = 317   // "static"
+const TK_REGISTER = 318 // "register"
+const TK_INLINE = 319   // "inline"
+const TK_THREAD = 320   // "_Thread_local"
+const TK_UNION = 321    // "union"
+const TK_ENUM = 322     // "enum"
+const TK_DEFAULT = 323  // "default"
+const TK_SASSERT = 324  // "_Static_assert"
+const TK_ALIGNAS = 327  // "_Alignas"
+const TK_NORETURN = 328 // "_Noreturn"
+const TK_GENERIC = 329  // "_Generic"
+
+// GNU extensions
+const TK_ASM = 325       // "asm"
+const TK_EXTENSION = 326 // "__extension__"
+const TK_ATTRIBUTE = 330 // "__attribute__"
 
 // Token type
 type Token struct {
@@ -101,6 +145,18 @@ type Token struct {
 	val  int    // Number literal
 	name string // Identifier
 
+	// Number literal. is_decimal is false for hexadecimal and
+	// octal literals, which may have unsigned types without 'u'.
+	is_unsigned bool // 'u' suffix
+	is_long     bool // 'l' or 'll' suffix
+	is_decimal  bool
+
+	// Floating-point literal. A literal with an 'f' suffix
+	// has type float, others double.
+	is_float  bool
+	is_single bool
+	fval      float64
+
 	// String literal
 	str string
 	len int
@@ -122,12 +178,16 @@ const (
 	ND_STRUCT                 // Struct
 	ND_DECL                   // declaration
 	ND_VARDEF                 // Variable definition
+	ND_DECL_LIST              // Declaration with multiple declarators
 	ND_LVAR                   // Local variable reference
 	ND_GVAR                   // Global variable reference
 	ND_IF                     // "if"
 	ND_FOR                    // "for"
 	ND_DO_WHILE               // do ... while
 	ND_BREAK                  // break
+	ND_CONTINUE               // continue
+	ND_SWITCH                 // "switch"
+	ND_CASE                   // "case" or "default"
 	ND_ADDR                   // address-of operator ("&")
 	ND_DEREF                  // pointer dereference ("*")
 	ND_DOT                    // Struct member access
@@ -160,9 +220,25 @@ const (
 	ND_COMP_STMT              // Compound statement
 	ND_EXPR_STMT              // Expressions statement
 	ND_STMT_EXPR              // Statement expression (GUN extn.)
+	ND_VA_START               // __builtin_va_start
+	ND_VA_ARG                 // __builtin_va_arg
+	ND_VA_COPY                // __builtin_va_copy
+	ND_VA_END                 // __builtin_va_end
+	ND_INIT_LIST              // Brace-enclosed initializer list
+	ND_DESIG                  // Designated initializer
+	ND_CAST                   // Type conversion
+	ND_ASM                    // "asm" statement
+	ND_GENERIC                // _Generic
 	ND_NULL                   // Null statement
 )
 
+const (
+	QUAL_CONST    = 1 << 0
+	QUAL_VOLATILE = 1 << 1
+	QUAL_RESTRICT = 1 << 2
+	QUAL_ATOMIC   = 1 << 3
+)
+
 const (
 	INT = iota
 	CHAR
@@ -171,6 +247,11 @@ const (
 	ARY
 	STRUCT
 	FUNC
+	SHORT
+	LONG
+	FLOAT
+	DOUBLE
+	BOOL
 )
 
 type Node struct {
@@ -179,15 +260,28 @@ type Node struct {
 	lhs   *Node   // left-hand side
 	rhs   *Node   // right-hand side
 	val   int     // Number literal
+	fval  float64 // Floating-point literal
 	expr  *Node   // "return" or expression stmt
 	stmts *Vector // Compound statement
+	end   *Token  // The '}' of a compound statement
 
 	name string // Identifier
+	used bool   // A declaration referenced while parsing, by typeof
+
+	// Global variable or function. is_static means internal linkage.
+	is_extern   bool
+	is_static   bool
+	is_inline   bool
+	is_noreturn bool // _Noreturn function, or a call to one
+	is_tls      bool // Thread-local storage
+	data        string
+	len         int
 
-	// Global variable
-	is_extern bool
-	data      string
-	len       int
+	// Variable or member. Alignment by _Alignas, 0 if not specified.
+	align int
+
+	// Declaration. GNU or C23 attributes, nil if there are none.
+	attrs *Attrs
 
 	// "if" ( cond ) then "else" els
 	// "for" ( init; cond; inc ) body
@@ -199,14 +293,61 @@ type Node struct {
 	inc  *Node
 
 	// Function definition
-	stacksize int
-	globals   *Vector
+	stacksize   int
+	frame_align int // Alignment of BP, 16 unless a local needs more
+	globals     *Vector
+	va_area     int // Offset of the register save area of a variadic function
+	ret_buf     int // Offset of the buffer for a struct return value
 
 	// Offset from BP or beginning of a struct
 	offset int
 
-	// Function call
+	// Bit-field member, or an access to one. The field is bit_width
+	// bits wide starting at bit_offset of the storage unit at offset.
+	is_bitfield bool
+	bit_width   int
+	bit_offset  int
+
+	// Function call. expr is the callee if called through a pointer.
+	// tok is the callee name or the '(' for diagnostics.
 	args *Vector
+	tok  *Token
+
+	// "switch" ( cond ) body, and the case labels in the body.
+	// A case label has its value in val and the statement after
+	// it in body. A case range "case a ... b" (GNU extension) has
+	// its last value in case_end, which is val for a single value.
+	cases        *Vector
+	default_case *Node
+	case_label   int
+	case_end     int
+
+	// Variable definition. Initializers are lowered to assignments
+	// by sema.
+	inits *Vector
+}
+
+// Attributes given by `__attribute__((...))` or C23 `[[...]]`. Those
+// that do not affect the generated code are dropped by the parser.
+type Attrs struct {
+	packed     bool   // Members are not aligned
+	aligned    int    // Minimum alignment, 0 if not specified
+	section    string // "" for the default section
+	visibility string // "hidden", "protected" or "internal"; "" for default
+	is_weak    bool
+	noreturn   bool
+	unused     bool // "unused" or "used": never warned by -Wunused
+
+	// Priorities of a constructor or destructor function, which is
+	// 65535 if not specified. 0 if it is not one.
+	constructor int
+	destructor  int
+
+	// format(printf, fmt_idx, fmt_first): the argument at fmt_idx
+	// (1-origin) is a printf format string for the arguments from
+	// fmt_first, which is 0 for a function taking a va_list.
+	fmt_idx   int
+	fmt_first int
 }
 
 // Sema.go
@@ -214,15 +355,46 @@ type Node struct {
 type Var struct {
 	ty       *Type
 	is_local bool
+	tok      *Token // Declaration, for diagnostics
+	used     bool   // Referenced, for -Wunused
+	is_param bool
 
 	// local
 	offset int
 
 	// global
-	name      string
-	is_extern bool
-	data      string
-	len       int
+	name        string
+	is_extern   bool
+	is_static   bool // Internal linkage
+	is_tls      bool // Thread-local storage
+	is_rodata   bool // Read-only data, such as floating-point constants
+	is_noreturn bool
+	def         *Token // Definition of a function, nil if not defined
+	align       int    // Alignment by _Alignas, 0 if not specified
+	attrs       *Attrs // nil if there are none
+	data        string
+	len         int
+	rels        *Vector // Relocations in data
+	inits       *Vector // Initialized scalars in data, nil for string literals
+}
+
+// A pointer in the initial data of a global variable, which is
+// resolved by the assembler to the address of label plus addend.
+type Reloc struct {
+	offset int
+	label  string
+	addend int
+}
+
+// An explicitly initialized scalar within a variable.
+type Initializer struct {
+	ty     *Type
+	offset int
+	expr   *Node
+
+	// Bit-field. bit_width is 0 otherwise.
+	bit_width  int
+	bit_offset int
 }
 
 // ir_dump.go
@@ -265,6 +437,29 @@ const (
 	IR_STORE_ARG
 	IR_KILL
 	IR_NOP
+	IR_ZERO
+	IR_UDIV
+	IR_UMOD
+	IR_SAR
+	IR_ULT
+	IR_ULE
+	IR_SEXT
+	IR_ZEXT
+	IR_FADD
+	IR_FSUB
+	IR_FMUL
+	IR_FDIV
+	IR_FNEG
+	IR_FEQ
+	IR_FNE
+	IR_FLT
+	IR_FLE
+	IR_I2F
+	IR_F2I
+	IR_F2F
+	IR_TLS_ADDR
+	IR_MEMCPY
+	IR_ASM
 )
 
 type IR struct {
@@ -272,16 +467,42 @@ type IR struct {
 	lhs int
 	rhs int
 
-	// Load/Store size in bytes
-	size int
+	// Load/Store size in bytes. A load sign-extends the value
+	// unless is_unsigned is true.
+	//
+	// Floating-point values are kept as bit patterns in
+	// general-purpose registers. For floating-point operations,
+	// size is the size of the operands. For conversions, size is
+	// the size of the floating-point side and is_unsigned tells if
+	// the integer side is an unsigned 64-bit integer.
+	size        int
+	is_unsigned bool
 
 	// For binary operator. If true, rhs is an immediate.
 	is_imm bool
 
-	// Function call
-	name  string
-	nargs int
-	args  [6]int
+	// Function call. If name is empty, the callee address
+	// is spilled at offset rhs from BP. For IR_ASM, name is the
+	// assembly text.
+	name   string
+	nargs  int
+	args   []int // Offsets from BP of the spilled arguments
+	fargs  []int // Sizes of floating-point arguments, 0 for others
+	nfloat int   // Number of vector registers used, passed in %al
+
+	// Function call and return. If true, the value is
+	// floating-point and is returned in xmm0.
+	is_float bool
+
+	// Function call. stack tells which arguments are passed on
+	// the stack.
+	stack []bool
+
+	// Function call and return of a struct in registers. classes
+	// are the classes of its eightbytes. A returned struct is
+	// stored to the temporary at offset ret_offset from BP.
+	classes    []int
+	ret_offset int
 }
 
 const (
@@ -301,8 +522,12 @@ const (
 )
 
 type Function struct {
-	name      string
-	stacksize int
-	globals   *Vector
-	ir        *Vector
+	name        string
+	is_static   bool
+	stacksize   int
+	frame_align int
+	globals     *Vector
+	ir          *Vector
+	va_area     int
+	attrs       *Attrs
 }
@@ -0,0 +1,276 @@
+package go9cc
+
+// Diagnostics engine. The tokenizer, the preprocessor, the parser
+// and the semantics analyzer report errors and warnings here instead
+// of exiting, so that a single run shows as many problems as possible
+// and the compiler can be used as a library.
+//
+// Reporting an error unwinds the stack to the nearest recovery point
+// by a panic with abort_error. The parser recovers at statements and
+// declarations, sema at statements and the exported entry points of
+// each pass stop at the first unrecovered error. The caller checks
+// Error_count after each pass.
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Severities
+const (
+	SEV_NOTE = iota
+	SEV_WARNING
+	SEV_ERROR
+)
+
+// A range [start, end) of a source file. pos is the position the
+// diagnostic points to with a caret.
+type Loc struct {
+	ctx   *Context
+	pos   int
+	start int
+	end   int
+}
+
+type Diag struct {
+	severity int
+	loc      *Loc // nil if the diagnostic has no location
+	msg      string
+	notes    *Vector // *Diag
+
+	// Fix-it hint: replace the range of fix_loc with fix_text.
+	fix_loc  *Loc
+	fix_text string
+}
+
+// Panic values that unwind from a reported error. abort_error is
+// caught by recovery points. fatal_error stops the whole pass.
+type abort_error struct{}
+type fatal_error struct{}
+
+var (
+	diag_mu   sync.Mutex
+	nerrors   int
+	nwarnings int
+
+	// Compilation stops after this many errors. 0 means no limit.
+	max_errors = 0
+)
+
+func Set_max_errors(n int) { max_errors = n }
+func Error_count() int     { return nerrors }
+
+// Reports whether the error limit has been reached, after which no
+// more passes should be run.
+func Too_many_errors() bool { return max_errors > 0 && nerrors >= max_errors }
+
+func new_diag(severity int, loc *Loc, msg string) *Diag {
+	d := new(Diag)
+	d.severity = severity
+	d.loc = loc
+	d.msg = msg
+	d.notes = new_vec()
+	return d
+}
+
+func add_note(d *Diag, loc *Loc, msg string) {
+	vec_push(d.notes, new_diag(SEV_NOTE, loc, msg))
+}
+
+func set_fixit(d *Diag, loc *Loc, text string) {
+	d.fix_loc = loc
+	d.fix_text = text
+}
+
+func token_loc(t *Token) *Loc {
+	loc := new(Loc)
+	loc.ctx = t.ctx
+	loc.pos = t.start
+	loc.start = t.start
+	loc.end = t.end
+	// EOF has no position.
+	if t.start < 0 {
+		loc.pos = len(t.ctx.buf)
+		loc.start = loc.pos
+		loc.end = loc.pos
+	}
+	return loc
+}
+
+// Returns the location of a node, which points to its token and
+// covers its subexpressions.
+func node_loc(node *Node) *Loc {
+	if node.tok == nil {
+		return nil
+	}
+	loc := token_loc(node.tok)
+	loc.start, loc.end = node_range(node, node.tok.ctx)
+	return loc
+}
+
+// Returns the source range of an expression, which is the union of
+// the tokens of its subexpressions in the same file as its own.
+func node_range(node *Node, ctx *Context) (int, int) {
+	start, end := node.tok.start, node.tok.end
+	kids := []*Node{node.lhs, node.rhs, node.expr, node.cond, node.then, node.els}
+	if node.args != nil {
+		for i := 0; i < node.args.len; i++ {
+			kids = append(kids, node.args.data[i].(*Node))
+		}
+	}
+	for _, k := range kids {
+		if k == nil || k.tok == nil || k.tok.ctx != ctx || k.tok.start < 0 {
+			continue
+		}
+		s, e := node_range(k, ctx)
+		if s < start {
+			start = s
+		}
+		if e > end {
+			end = e
+		}
+	}
+	return start, end
+}
+
+// Prints and counts a diagnostic. When the number of errors reaches
+// the limit, the pass is stopped.
+func report(d *Diag) {
+	diag_mu.Lock()
+	print_diag(d)
+	for i := 0; i < d.notes.len; i++ {
+		print_diag(d.notes.data[i].(*Diag))
+	}
+	if d.severity == SEV_WARNING {
+		nwarnings++
+	}
+	if d.severity == SEV_ERROR {
+		nerrors++
+	}
+	fatal := d.severity == SEV_ERROR && max_errors > 0 && nerrors >= max_errors
+	diag_mu.Unlock()
+
+	if fatal {
+		fmt.Fprintf(os.Stderr, "compilation terminated due to -fmax-errors=%d.\n", max_errors)
+		panic(fatal_error{})
+	}
+}
+
+var severity_names = []string{"note", "warning", "error"}
+
+// Prints a diagnostic like
+//
+//	foo.c:3:10: error: undefined variable: x
+//	  return x + 1;
+//	         ^~~~~
+func print_diag(d *Diag) {
+	kind := severity_names[d.severity]
+	loc := d.loc
+	if loc == nil {
+		fmt.Fprintf(os.Stderr, "%s: %s\n", kind, d.msg)
+		return
+	}
+
+	buf := loc.ctx.buf
+	pos := loc.pos
+	if pos > len(buf) {
+		pos = len(buf)
+	}
+	ls := strings.LastIndexByte(buf[:pos], '\n') + 1
+	le := strings.IndexByte(buf[pos:], '\n')
+	if le < 0 {
+		le = len(buf)
+	} else {
+		le += pos
+	}
+	line := strings.Count(buf[:ls], "\n") + 1
+
+	fmt.Fprintf(os.Stderr, "%s:%d:%d: %s: %s\n", loc.ctx.path, line, pos-ls+1, kind, d.msg)
+	if ls == le {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%s\n", buf[ls:le])
+	fmt.Fprintf(os.Stderr, "%s\n", marker_line(buf, ls, le, func(i int) byte {
+		switch {
+		case i == pos:
+			return '^'
+		case loc.start <= i && i < loc.end && i < le:
+			return '~'
+		}
+		return 0
+	}))
+
+	// A fix-it on the same line is shown below the caret.
+	fix := d.fix_loc
+	if fix != nil && fix.ctx == loc.ctx && ls <= fix.start && fix.start <= le {
+		text := marker_line(buf, ls, fix.start, func(i int) byte { return 0 })
+		fmt.Fprintf(os.Stderr, "%s%s\n", text, d.fix_text)
+	}
+}
+
+// Returns a line as wide as buf[ls:le] with a mark for each position,
+// keeping tabs so that the marks line up with the source. A tab within
+// a range is kept too, since a mark would not be as wide as the tab.
+func marker_line(buf string, ls, le int, mark func(int) byte) string {
+	b := make([]byte, 0, le-ls+1)
+	for i := ls; i <= le; i++ {
+		c := mark(i)
+		if (c == 0 || c == '~') && i < le && buf[i] == '\t' {
+			c = '\t'
+		}
+		if c == 0 {
+			c = ' '
+		}
+		b = append(b, c)
+	}
+	return strings.TrimRight(string(b), " \t")
+}
+
+// Reports an error and unwinds to the nearest recovery point.
+func error_diag(d *Diag) {
+	report(d)
+	panic(abort_error{})
+}
+
+func error_at(loc *Loc, msg string) {
+	error_diag(new_diag(SEV_ERROR, loc, msg))
+}
+
+func bad_token(t *Token, msg string) {
+	error_at(token_loc(t), msg)
+}
+
+// Reports an error at the source range of a node.
+func bad_node(node *Node, msg string) {
+	error_at(node_loc(node), msg)
+}
+
+// Reports an error without a location.
+func ErrorReport(format string, a ...interface{}) {
+	error_at(nil, fmt.Sprintf(format, a...))
+}
+
+// Called with the value of recover() at a recovery point. Returns
+// normally only for a recoverable error.
+func recovered(r interface{}) {
+	if _, ok := r.(abort_error); !ok {
+		panic(r)
+	}
+}
+
+// Runs a pass, which stops at the first error that is not recovered
+// inside it.
+func guard(f func()) {
+	defer func() {
+		if r := recover(); r != nil {
+			_, abort := r.(abort_error)
+			_, fatal := r.(fatal_error)
+			if !abort && !fatal {
+				panic(r)
+			}
+		}
+	}()
+	f()
+}
@@ -0,0 +1,174 @@
+package go9cc
+
+import (
+	"io"
+	"os"
+	"testing"
+)
+
+// Compiles src up to the semantic analysis and returns the numbers of
+// errors and warnings reported.
+func count_diags(t *testing.T, src string, limit int) (int, int) {
+	return count_diags_at(t, "test.c", src, limit)
+}
+
+// Same as count_diags, but src is read as if it were the file at path.
+func count_diags_at(t *testing.T, path, src string, limit int) (int, int) {
+	devnull, err := os.Create(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig_stderr, orig_max := os.Stderr, max_errors
+	os.Stderr, nerrors, nwarnings, max_errors = devnull, 0, 0, limit
+	defer func() {
+		devnull.Close()
+		os.Stderr, nerrors, nwarnings, max_errors = orig_stderr, 0, 0, orig_max
+	}()
+
+	tokens := tokenize_buf(path, src, true, nil)
+	if !Too_many_errors() {
+		nodes := Parse(tokens)
+		if nerrors == 0 {
+			Sema(nodes)
+		}
+	}
+	return nerrors, nwarnings
+}
+
+func Test_error_recovery(t *testing.T) {
+	cases := []struct {
+		src   string
+		limit int
+		ret   int
+	}{
+		{"int main() { return 0; }\n", 0, 0},
+		{"int main() { int x = 1 return x; }\n", 0, 1},
+		{"int main() { x = ; y = ; return z; }\n", 0, 2},
+		{"int f() { 1 +; }\nint g() { return 2 +; }\n", 0, 2},
+		{"int f() { if (1) { a; } b; }\n}\nint g() { c; }\n", 0, 1},
+		{"int f() { if (1) { a; } b; }\nint g() { c; }\n", 0, 3},
+		{"int f() { int a = ; return a; }\n", 0, 1},
+		{"int x = {;\nint y = ;\nint f() { int z = {1, ; return 1 +; }\n", 0, 4},
+		{"int x = 'a;\nint y = $;\n", 0, 4},
+		{"#foo\nint main() { return +; }\n", 0, 2},
+		{"int main() { return 0;\n", 0, 1},
+		{"int main() { x = ; y = ; return z; }\n", 2, 2},
+		{"int f(int x) { switch (x) { case 1 ... 5: case 3: return 1; } return 0; }\n", 0, 1},
+		{"int f(int x) { switch (x) { case 5 ... 1: case 3: return 1; } return 0; }\n", 0, 0},
+		{"int f() { asm(\"nop\" : : ); return 0; }\n", 0, 1},
+		{"static_assert(1);\n_Static_assert(0);\nstatic_assert(0, \"msg\");\nstruct S { static_assert(0); int x; };\n", 0, 3},
+		{"_Alignas(2) int x;\n_Alignas(3) int y;\nstruct S { _Alignas(16) int a : 3; };\n", 0, 3},
+		{"_Noreturn int x;\nint f(_Noreturn int y);\n", 0, 2},
+		{"int x = _Generic(1L, int: 1);\nint y = _Generic(1, int: 1, signed: 2);\nint z = _Generic(1, default: 1, default: 2);\n", 0, 3},
+		{"int x = _Generic(1L, int: 1);\nint y = ;\n", 0, 1},
+		{"int x __attribute__((aligned(3)));\nint y __attribute__((visibility(\"nope\")));\nint z __attribute__((section(1)));\n", 0, 3},
+		{"void f(const char *, ...) __attribute__((format(printf, 0, 1)));\nvoid g(const char *, ...) __attribute__((format(printf, 2, 1)));\n", 0, 2},
+		{"void f() __attribute__((constructor(70000)));\nint x __attribute__((packed;\n", 0, 2},
+		{"void g(void);\nint f() { int x = ({ }); int y = g(); x = g(); return (void)1; }\n", 0, 4},
+		{"void g(void);\nint h(int, ...);\nint f() { h(g()); h(1, g()); return 0; }\n", 0, 2},
+		{"void g(void);\nint f(int *p) { int x = g() + 1; x = 1 < g(); x = p == g(); p = p + g(); return (int)g(); }\n", 0, 5},
+		{"void g(void);\nvoid f(int c) { c ? g() : g(); (void)g(); g(), 1; ({ g(); }); }\n", 0, 0},
+		{"struct C { int a; const int b; };\nstruct D { struct C c[2]; };\nvoid f(struct C *p, struct C q) { p->a = 1; *p = q; }\nvoid g(struct D *r, struct D s) { r->c[0].a = 1; *r = s; }\n", 0, 2},
+		{"int f(int a) { return a; }\nint f(int a) { return a; }\n", 0, 1},
+		{"int f(int a);\nint f(int a) { return a; }\nint f(int a);\nint g() { return f(1); }\n", 0, 0},
+		{"struct S { int a; };\nvoid g(struct S s, char *p);\nint f(struct S t) { g(1, \"\"); return 0; }\nint h(const char *s, struct S t) { g(t, s); return 0; }\n", 0, 2},
+	}
+
+	for _, c := range cases {
+		ret, _ := count_diags(t, c.src, c.limit)
+		if ret != c.ret {
+			t.Errorf("%q: expected %d errors, got: %d\n", c.src, c.ret, ret)
+		}
+	}
+}
+
+// Returns the diagnostics printed for src.
+func render_diags(t *testing.T, src string) string {
+	f, err := os.CreateTemp("", "diag")
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig_stderr := os.Stderr
+	os.Stderr, nerrors, nwarnings = f, 0, 0
+	defer func() {
+		f.Close()
+		os.Remove(f.Name())
+		os.Stderr, nerrors, nwarnings = orig_stderr, 0, 0
+	}()
+
+	tokens := tokenize_buf("test.c", src, true, nil)
+	nodes := Parse(tokens)
+	if nerrors == 0 {
+		Sema(nodes)
+	}
+
+	f.Seek(0, 0)
+	out, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(out)
+}
+
+func Test_render_diags(t *testing.T) {
+	cases := []struct {
+		src  string
+		want string
+	}{
+		// A single token
+		{"int main() { return x; }\n",
+			"test.c:1:21: error: undefined variable: x\n" +
+				"int main() { return x; }\n" +
+				"                    ^\n"},
+		// The range of an expression
+		{"int *f(int a, int b) { return a + b; }\n",
+			"test.c:1:33: warning: assignment makes pointer from integer without a cast [-Wint-conversion]\n" +
+				"int *f(int a, int b) { return a + b; }\n" +
+				"                              ~~^~~\n"},
+		// Tabs are kept in the marker line.
+		{"int f(int a) {\n\treturn\ta +\tb;\n}\n",
+			"test.c:2:13: error: undefined variable: b\n" +
+				"\treturn\ta +\tb;\n" +
+				"\t      \t   \t^\n"},
+		{"int *f(int a) {\n\treturn\ta\t+ 1;\n}\n",
+			"test.c:2:11: warning: assignment makes pointer from integer without a cast [-Wint-conversion]\n" +
+				"\treturn\ta\t+ 1;\n" +
+				"\t      \t~\t^~~\n"},
+		// A note
+		{"int f(int a) { return a; }\nint f(int a) { return a; }\n",
+			"test.c:2:5: error: redefinition of 'f'\n" +
+				"int f(int a) { return a; }\n" +
+				"    ^\n" +
+				"test.c:1:5: note: previous definition of 'f' was here\n" +
+				"int f(int a) { return a; }\n" +
+				"    ^\n"},
+	}
+
+	for _, c := range cases {
+		if got := render_diags(t, c.src); got != c.want {
+			t.Errorf("%q: expected:\n%s\ngot:\n%s", c.src, c.want, got)
+		}
+	}
+}
+
+// `#include <name>` is not looked up in the directory of the including
+// file, unlike `#include "name"`.
+func Test_include_lookup(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(dir+"/q.h", []byte("int q;\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		src string
+		ret int
+	}{
+		{"#include \"q.h\"\nint f() { return q; }\n", 0},
+		{"#include <q.h>\nint f() { return 0; }\n", 1},
+	}
+	for _, c := range cases {
+		ret, _ := count_diags_at(t, dir+"/main.c", c.src, 0)
+		if ret != c.ret {
+			t.Errorf("%q: expected %d errors, got: %d\n", c.src, c.ret, ret)
+		}
+	}
+}
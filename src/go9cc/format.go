@@ -0,0 +1,197 @@
+package go9cc
+
+// Checking of format strings (-Wformat)
+//
+// A call to a function declared with `format(printf, m, n)` whose
+// format string is a literal is checked like gcc does for printf:
+// each conversion must have an argument of a matching type, and no
+// argument may be left over. Arguments have been promoted by then,
+// so `char` and `short` are passed as int and `float` as double.
+
+import "strings"
+
+// Kinds of arguments of conversions
+const (
+	FMT_INT = iota
+	FMT_DOUBLE
+	FMT_STR
+	FMT_PTR
+)
+
+// Returns the format string of a call if it is a string literal. It
+// has to be taken before the arguments are analyzed.
+func format_literal(node *Node, attrs *Attrs) (string, bool) {
+	if attrs == nil || attrs.fmt_idx == 0 || attrs.fmt_idx > node.args.len {
+		return "", false
+	}
+	arg := node.args.data[attrs.fmt_idx-1].(*Node)
+	if arg.op != ND_STR {
+		return "", false
+	}
+	return arg.data, true
+}
+
+// Checks the arguments from the first-th (1-origin) against a format
+// string. If first is 0, only the format string is checked.
+func check_format(node *Node, s string, first int) {
+	next := first - 1
+	take := func(spec, want string, kind, size int) {
+		if first == 0 {
+			return
+		}
+		if next >= node.args.len {
+			warn_token(W_FORMAT, node.tok, format("format '%s' expects a matching '%s' argument", spec, want))
+			next++
+			return
+		}
+		arg := node.args.data[next].(*Node)
+		next++
+		if !format_match(arg.ty, kind, size) {
+			warn_node(W_FORMAT, arg, format("format '%s' expects argument of type '%s', but argument %d has type '%s'",
+				spec, want, next, type_str(arg.ty)))
+		}
+	}
+
+	for i := 0; i < len(s); i++ {
+		if s[i] != '%' {
+			continue
+		}
+		start := i
+		i++
+		if i < len(s) && s[i] == '%' {
+			continue
+		}
+
+		// Flags, field width and precision. A '*' takes an int
+		// argument.
+		for i < len(s) && strings.IndexByte("-+ #0'", s[i]) >= 0 {
+			i++
+		}
+		for i < len(s) && ('0' <= s[i] && s[i] <= '9' || s[i] == '*') {
+			if s[i] == '*' {
+				take(s[start:i+1], "int", FMT_INT, 4)
+			}
+			i++
+		}
+		if i < len(s) && s[i] == '.' {
+			i++
+			for i < len(s) && ('0' <= s[i] && s[i] <= '9' || s[i] == '*') {
+				if s[i] == '*' {
+					take(s[start:i+1], "int", FMT_INT, 4)
+				}
+				i++
+			}
+		}
+
+		mod := ""
+		for i < len(s) && strings.IndexByte("hlLqjzt", s[i]) >= 0 {
+			mod += s[i : i+1]
+			i++
+		}
+		if i == len(s) {
+			warn_token(W_FORMAT, node.tok, "conversion lacks type at end of format")
+			return
+		}
+		spec := s[start : i+1]
+
+		// Every length modifier but "h" and "hh" makes integers
+		// 8 bytes long.
+		size, long := 4, ""
+		if mod != "" && mod != "h" && mod != "hh" {
+			size, long = 8, "long "
+		}
+		switch c := s[i]; c {
+		case 'd', 'i':
+			take(spec, long+"int", FMT_INT, size)
+		case 'u', 'o', 'x', 'X':
+			take(spec, long+"unsigned int", FMT_INT, size)
+		case 'c':
+			take(spec, "int", FMT_INT, 4)
+		case 'f', 'F', 'e', 'E', 'g', 'G', 'a', 'A':
+			// long double is double here, but libc reads an
+			// 80-bit value for 'L', so no argument can match.
+			if mod == "L" {
+				warn_token(W_FORMAT, node.tok, format("format '%s' expects 'long double', which this compiler passes as 'double'", spec))
+			}
+			take(spec, "double", FMT_DOUBLE, 8)
+		case 's':
+			if mod == "l" {
+				take(spec, "wchar_t *", FMT_PTR, 0)
+			} else {
+				take(spec, "char *", FMT_STR, 0)
+			}
+		case 'p':
+			take(spec, "void *", FMT_PTR, 0)
+		case 'n':
+			take(spec, "int *", FMT_PTR, 0)
+		default:
+			warn_token(W_FORMAT, node.tok, format("unknown conversion type character '%c' in format", c))
+			return
+		}
+	}
+
+	if first != 0 && next < node.args.len {
+		warn_node(W_FORMAT, node.args.data[next].(*Node), "too many arguments for format")
+	}
+}
+
+func format_match(ty *Type, kind, size int) bool {
+	switch kind {
+	case FMT_INT:
+		return is_integer(ty) && ty.size == size
+	case FMT_DOUBLE:
+		return is_flonum(ty)
+	case FMT_STR:
+		return ty.ty == PTR && ty.ptr_to.ty == CHAR
+	}
+	return ty.ty == PTR
+}
+
+// Returns the name of a type for diagnostics.
+func type_str(ty *Type) string {
+	s := ""
+	switch ty.ty {
+	case VOID:
+		s = "void"
+	case BOOL:
+		return "_Bool"
+	case CHAR:
+		s = "char"
+	case SHORT:
+		s = "short"
+	case INT:
+		s = "int"
+	case LONG:
+		s = "long"
+	case FLOAT:
+		s = "float"
+	case DOUBLE:
+		s = "double"
+	case PTR:
+		if ty.ptr_to.ty == FUNC {
+			return format("%s (*)()", type_str(ty.ptr_to.returning))
+		}
+		s = type_str(ty.ptr_to)
+		if strings.HasSuffix(s, "*") {
+			s += "*"
+		} else {
+			s += " *"
+		}
+	case ARY:
+		return format("%s[%d]", type_str(ty.ary_of), ty.len)
+	case STRUCT:
+		s = "struct"
+		if ty.is_union {
+			s = "union"
+		}
+	case FUNC:
+		return format("%s ()", type_str(ty.returning))
+	}
+	if ty.is_unsigned {
+		s = "unsigned " + s
+	}
+	if ty.qual&QUAL_CONST != 0 && ty.ty != PTR {
+		s = "const " + s
+	}
+	return s
+}
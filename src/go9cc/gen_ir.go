@@ -11,13 +11,28 @@ package go9cc
 // Such infinite number of registers are mapped to a finite registers
 // in a later pass.
 
+import "math"
+
 var (
-	code         *Vector
-	nreg         = 1
-	nlabel       = 1
-	return_label int
-	return_reg   int
-	break_label  int
+	code        *Vector
+	nreg        = 1
+	nlabel      = 1
+	break_label int
+	cont_label  int
+
+	// Struct return value of the current function. If ret_hidden
+	// is true, its address is passed as a hidden argument.
+	ret_buf    int
+	ret_hidden bool
+
+	// Outgoing call arguments are spilled to 8-byte slots placed
+	// below the local variables. Slots are released when the call
+	// is made, so nested calls reuse the same area.
+	localsize int
+	argslots  int
+	maxslots  int
+
+	nfconst int
 )
 
 func add(op, lhs, rhs int) *IR {
@@ -50,6 +65,7 @@ func jmp(x int) {
 func load(node *Node, dst, src int) {
 	ir := add(IR_LOAD, dst, src)
 	ir.size = node.ty.size
+	ir.is_unsigned = node.ty.is_unsigned
 }
 
 func store(node *Node, dst, src int) {
@@ -57,9 +73,248 @@ func store(node *Node, dst, src int) {
 	ir.size = node.ty.size
 }
 
+func load_n(dst, src, size int) {
+	ir := add(IR_LOAD, dst, src)
+	ir.size = size
+}
+
+func store_n(dst, src, size int) {
+	ir := add(IR_STORE, dst, src)
+	ir.size = size
+}
+
+// A bit-field is read from its storage unit by shifting the field to
+// the top of the register and back, which also extends its sign.
+func load_bitfield(node *Node, dst, addr int) {
+	ir := add(IR_LOAD, dst, addr)
+	ir.size = node.ty.size
+	ir.is_unsigned = true
+	add_imm(IR_SHL, dst, 64-node.bit_width-node.bit_offset)
+	add_imm(typed_op(IR_SAR, node.ty), dst, 64-node.bit_width)
+}
+
+// Stores to a bit-field by read-modify-write of its storage unit.
+// The value in val is truncated to the width of the field, since it
+// is the value of the assignment expression.
+func store_bitfield(node *Node, addr, val int) {
+	w, off := node.bit_width, node.bit_offset
+	unit := nreg
+	nreg++
+	mask := nreg
+	nreg++
+	bits := nreg
+	nreg++
+
+	ir := add(IR_LOAD, unit, addr)
+	ir.size = node.ty.size
+	ir.is_unsigned = true
+	add(IR_IMM, mask, ^((1<<uint(w) - 1) << uint(off)))
+	add(IR_AND, unit, mask)
+	add(IR_MOV, bits, val)
+	add_imm(IR_SHL, bits, 64-w)
+	add_imm(IR_SHR, bits, 64-w-off)
+	add(IR_OR, unit, bits)
+	store(node, addr, unit)
+	kill(unit)
+	kill(mask)
+	kill(bits)
+
+	add_imm(IR_SHL, val, 64-w)
+	add_imm(typed_op(IR_SAR, node.ty), val, 64-w)
+}
+
+// Loads or stores the value of an lvalue whose address is in addr.
+func load_lval(node *Node, dst, addr int) {
+	if node.is_bitfield {
+		load_bitfield(node, dst, addr)
+		return
+	}
+	load(node, dst, addr)
+}
+
+func store_lval(node *Node, addr, val int) {
+	if node.is_bitfield {
+		store_bitfield(node, addr, val)
+		return
+	}
+	store(node, addr, val)
+}
+
 func store_arg(node *Node, bpoff, argreg int) {
+	store_arg_n(bpoff, argreg, node.ty.size, is_flonum(node.ty))
+}
+
+func store_arg_n(bpoff, argreg, size int, is_float bool) {
 	ir := add(IR_STORE_ARG, bpoff, argreg)
-	ir.size = node.ty.size
+	ir.size = size
+	ir.is_float = is_float
+}
+
+func gen_memcpy(dst, src, size int) {
+	ir := add(IR_MEMCPY, dst, src)
+	ir.size = size
+}
+
+// Classes of eightbytes in the System V x86-64 ABI.
+const (
+	CLASS_INTEGER = iota
+	CLASS_SSE
+)
+
+// A struct of up to 16 bytes is passed in registers, one per
+// eightbyte. An eightbyte goes to a vector register if it consists
+// only of floating-point members and to a general-purpose register
+// otherwise. Returns nil for a larger struct, which is passed in
+// memory.
+func classify(ty *Type) []int {
+	if ty.size > 16 {
+		return nil
+	}
+	classes := make([]int, (ty.size+7)/8)
+	for i := range classes {
+		classes[i] = CLASS_SSE
+	}
+	mark_integer(classes, ty, 0)
+	return classes
+}
+
+// Marks the eightbytes which have a member other than floating-point.
+func mark_integer(classes []int, ty *Type, offset int) {
+	switch {
+	case ty.ty == STRUCT:
+		for i := 0; i < ty.members.len; i++ {
+			m := ty.members.data[i].(*Node)
+			if m.name != "" {
+				mark_integer(classes, m.ty, offset+m.offset)
+			}
+		}
+	case ty.ty == ARY:
+		for i := 0; i < ty.len; i++ {
+			mark_integer(classes, ty.ary_of, offset+i*ty.ary_of.size)
+		}
+	case !is_flonum(ty):
+		for i := offset / 8; i < (offset+ty.size+7)/8; i++ {
+			classes[i] = CLASS_INTEGER
+		}
+	}
+}
+
+func arg_classes(ty *Type) []int {
+	if ty.ty == STRUCT {
+		return classify(ty)
+	}
+	if is_flonum(ty) {
+		return []int{CLASS_SSE}
+	}
+	return []int{CLASS_INTEGER}
+}
+
+// A struct returned in memory is written to a buffer whose address
+// the caller passes as a hidden first argument.
+func ret_in_mem(ty *Type) bool {
+	return ty.ty == STRUCT && classify(ty) == nil
+}
+
+// Decides which arguments are passed in registers. An argument goes
+// on the stack if it is passed in memory or if not all of its
+// eightbytes fit in the remaining registers. gp is the number of
+// general-purpose registers taken by a hidden argument. Returns the
+// numbers of registers and stack eightbytes used as well.
+func place_args(tys []*Type, gp int) (in_reg []bool, ngp, nfp, nstack int) {
+	in_reg = make([]bool, len(tys))
+	ngp = gp
+	for i, ty := range tys {
+		classes := arg_classes(ty)
+		ni, ns := 0, 0
+		for _, c := range classes {
+			if c == CLASS_SSE {
+				ns++
+			} else {
+				ni++
+			}
+		}
+		if classes != nil && ngp+ni <= 6 && nfp+ns <= 8 {
+			in_reg[i] = true
+			ngp += ni
+			nfp += ns
+			continue
+		}
+		nstack += (ty.size + 7) / 8
+	}
+	return
+}
+
+func param_types(args *Vector) []*Type {
+	tys := make([]*Type, args.len)
+	for i := 0; i < args.len; i++ {
+		tys[i] = args.data[i].(*Node).ty
+	}
+	return tys
+}
+
+// Loads the k-th eightbyte of an object. A last eightbyte shorter
+// than 8 bytes is assembled from smaller loads so as not to read past
+// the end of the object.
+func load_eightbyte(addr, k, size int) int {
+	n := size - k*8
+	if n > 8 {
+		n = 8
+	}
+
+	r := nreg
+	nreg++
+	p := nreg
+	nreg++
+	add(IR_MOV, p, addr)
+	add_imm(IR_ADD, p, k*8)
+	if n == 8 {
+		load_n(r, p, 8)
+		kill(p)
+		return r
+	}
+
+	tmp := nreg
+	nreg++
+	add(IR_IMM, r, 0)
+	for off := 0; off < n; {
+		c := 4
+		for off+c > n {
+			c /= 2
+		}
+		ir := add(IR_LOAD, tmp, p)
+		ir.size = c
+		ir.is_unsigned = true
+		add_imm(IR_SHL, tmp, off*8)
+		add(IR_OR, r, tmp)
+		add_imm(IR_ADD, p, c)
+		off += c
+	}
+	kill(tmp)
+	kill(p)
+	return r
+}
+
+// A struct return value is copied to the buffer and loaded from there
+// to registers by gen_x86, or copied to the caller's buffer if it is
+// returned in memory.
+func gen_return_struct(ty *Type, r int) {
+	buf := nreg
+	nreg++
+	add(IR_BPREL, buf, ret_buf)
+	if ret_in_mem(ty) {
+		load_n(buf, buf, 8)
+		gen_memcpy(buf, r, ty.size)
+		kill(r)
+		add(IR_RETURN, buf, -1)
+		kill(buf)
+		return
+	}
+
+	gen_memcpy(buf, r, ty.size)
+	kill(r)
+	ir := add(IR_RETURN, buf, -1)
+	ir.classes = classify(ty)
+	kill(buf)
 }
 
 // In C, all expressions that can be written on the left-hand side of
@@ -96,21 +351,177 @@ func gen_lval(node *Node) int {
 		add(IR_BPREL, r, node.offset)
 		return r
 	}
+	// A struct rvalue, such as a return value of a function,
+	// evaluates to its address.
+	if node.op != ND_GVAR && node.ty.ty == STRUCT {
+		return gen_expr(node)
+	}
+
 	// assert(node.op == ND_GVAR)
 	r := nreg
 	nreg++
-	ir := add(IR_LABEL_ADDR, r, -1)
+	op := IR_LABEL_ADDR
+	if node.is_tls {
+		op = IR_TLS_ADDR
+	}
+	ir := add(op, r, -1)
 	ir.name = node.name
 	return r
 }
 
+func spill_arg(r int) int {
+	argslots++
+	if maxslots < argslots {
+		maxslots = argslots
+	}
+	off := localsize + argslots*8
+
+	addr := nreg
+	nreg++
+	add(IR_BPREL, addr, off)
+	store_n(addr, r, 8)
+	kill(addr)
+	kill(r)
+	return off
+}
+
+// Integer values narrower than 8 bytes are kept sign- or zero-extended
+// to 64 bits in registers. This truncates the result of an operation
+// that may carry into the upper bits to the width of its type.
+func normalize(r int, ty *Type) {
+	if ty.ty == BOOL {
+		zero := nreg
+		nreg++
+		add(IR_IMM, zero, 0)
+		add(IR_NE, r, zero)
+		kill(zero)
+		return
+	}
+	if !is_integer(ty) || ty.size == 8 {
+		return
+	}
+	if ty.is_unsigned {
+		add(IR_ZEXT, r, ty.size)
+	} else {
+		add(IR_SEXT, r, ty.size)
+	}
+}
+
+// Pointers are compared as unsigned integers.
+func is_unsigned(ty *Type) bool {
+	return ty.is_unsigned || ty.ty == PTR
+}
+
+// Returns the floating-point, signed or unsigned version of an IR
+// opcode depending on the type of the operands.
+func typed_op(op int, ty *Type) int {
+	if is_flonum(ty) {
+		switch op {
+		case IR_ADD:
+			return IR_FADD
+		case IR_SUB:
+			return IR_FSUB
+		case IR_MUL:
+			return IR_FMUL
+		case IR_DIV:
+			return IR_FDIV
+		case IR_EQ:
+			return IR_FEQ
+		case IR_NE:
+			return IR_FNE
+		case IR_LT:
+			return IR_FLT
+		case IR_LE:
+			return IR_FLE
+		}
+		return op
+	}
+
+	if !is_unsigned(ty) {
+		return op
+	}
+	switch op {
+	case IR_DIV:
+		return IR_UDIV
+	case IR_MOD:
+		return IR_UMOD
+	case IR_SAR:
+		return IR_SHR
+	case IR_LT:
+		return IR_ULT
+	case IR_LE:
+		return IR_ULE
+	}
+	return op
+}
+
 func gen_binop(ty int, node *Node) int {
 	lhs, rhs := gen_expr(node.lhs), gen_expr(node.rhs)
-	add(ty, lhs, rhs)
+	ir := add(ty, lhs, rhs)
+	ir.size = node.lhs.ty.size
 	kill(rhs)
 	return lhs
 }
 
+func gen_arith(op int, node *Node) int {
+	r := gen_binop(typed_op(op, node.ty), node)
+	normalize(r, node.ty)
+	return r
+}
+
+// Converts the value in register r from one type to another.
+func gen_conv(r int, from, to *Type) {
+	switch {
+	case is_flonum(from) && to.ty == BOOL:
+		zero := gen_fconst(from, 0)
+		ir := add(IR_FNE, r, zero)
+		ir.size = from.size
+		kill(zero)
+	case is_flonum(from) && is_flonum(to):
+		if from.size != to.size {
+			ir := add(IR_F2F, r, -1)
+			ir.size = to.size
+		}
+	case is_flonum(to):
+		ir := add(IR_I2F, r, -1)
+		ir.size = to.size
+		ir.is_unsigned = from.is_unsigned && from.size == 8
+	case is_flonum(from):
+		ir := add(IR_F2I, r, -1)
+		ir.size = from.size
+		ir.is_unsigned = to.is_unsigned && to.size == 8
+		normalize(r, to)
+	default:
+		normalize(r, to)
+	}
+}
+
+// Floating-point constants are placed in .rodata and loaded from
+// there.
+func gen_fconst(ty *Type, val float64) int {
+	bits := math.Float64bits(val)
+	if ty.ty == FLOAT {
+		bits = uint64(math.Float32bits(float32(val)))
+	}
+	buf := make([]byte, ty.size)
+	for i := range buf {
+		buf[i] = byte(bits >> uint(i*8))
+	}
+
+	v := new_global(ty, format(".L.fconst%d", nfconst), string(buf), len(buf))
+	v.is_rodata = true
+	v.is_static = true
+	nfconst++
+	vec_push(globals, v)
+
+	r := nreg
+	nreg++
+	ir := add(IR_LABEL_ADDR, r, -1)
+	ir.name = v.name
+	load_n(r, r, ty.size)
+	return r
+}
+
 func get_inc_scale(node *Node) int {
 	if node.ty.ty == PTR {
 		return node.ty.ptr_to.size
@@ -122,35 +533,76 @@ func gen_pre_inc(node *Node, num int) int {
 	addr := gen_lval(node.expr)
 	val := nreg
 	nreg++
-	load(node, val, addr)
+	load_lval(node.expr, val, addr)
 	add_imm(IR_ADD, val, num*get_inc_scale(node))
-	store(node, addr, val)
+	normalize(val, node.ty)
+	store_lval(node.expr, addr, val)
+	kill(addr)
+	return val
+}
+
+// Floating-point x++ keeps the original value in a separate
+// register since subtracting 1 again would not be exact.
+func gen_post_finc(node *Node, num int) int {
+	addr := gen_lval(node.expr)
+	val := nreg
+	nreg++
+	load(node, val, addr)
+
+	r := gen_fconst(node.ty, float64(num))
+	ir := add(IR_FADD, r, val)
+	ir.size = node.ty.size
+	store(node, addr, r)
+	kill(r)
 	kill(addr)
 	return val
 }
 
 func gen_post_inc(node *Node, num int) int {
+	if is_flonum(node.ty) {
+		return gen_post_finc(node, num)
+	}
+
+	// x++ on _Bool or a bit-field cannot be undone by subtracting
+	// 1 since the result may have wrapped around.
+	if node.ty.ty == BOOL || node.expr.is_bitfield {
+		addr := gen_lval(node.expr)
+		val := nreg
+		nreg++
+		r := nreg
+		nreg++
+		load_lval(node.expr, val, addr)
+		add(IR_MOV, r, val)
+		add_imm(IR_ADD, r, num)
+		normalize(r, node.ty)
+		store_lval(node.expr, addr, r)
+		kill(r)
+		kill(addr)
+		return val
+	}
+
 	val := gen_pre_inc(node, num)
 	add_imm(IR_SUB, val, num*get_inc_scale(node))
+	normalize(val, node.ty)
 	return val
 }
 
-func to_assign_op(op int) int {
+func to_assign_op(op int, ty *Type) int {
 	switch op {
 	case ND_MUL_EQ:
-		return IR_MUL
+		return typed_op(IR_MUL, ty)
 	case ND_DIV_EQ:
-		return IR_DIV
+		return typed_op(IR_DIV, ty)
 	case ND_MOD_EQ:
-		return IR_MOD
+		return typed_op(IR_MOD, ty)
 	case ND_ADD_EQ:
-		return IR_ADD
+		return typed_op(IR_ADD, ty)
 	case ND_SUB_EQ:
-		return IR_SUB
+		return typed_op(IR_SUB, ty)
 	case ND_SHL_EQ:
 		return IR_SHL
 	case ND_SHR_EQ:
-		return IR_SHR
+		return typed_op(IR_SAR, ty)
 	case ND_BITAND_EQ:
 		return IR_AND
 	case ND_XOR_EQ:
@@ -167,28 +619,233 @@ func gen_assign_op(node *Node) int {
 	val := nreg
 	nreg++
 
-	load(node, val, dst)
-	add(to_assign_op(node.op), val, src)
+	// The operation is done in the type of the converted rhs.
+	ty := node.rhs.ty
+	load_lval(node.lhs, val, dst)
+	gen_conv(val, node.ty, ty)
+	ir := add(to_assign_op(node.op, ty), val, src)
+	ir.size = ty.size
 	kill(src)
-	store(node, dst, val)
+	gen_conv(val, ty, node.ty)
+	store_lval(node.lhs, dst, val)
 	kill(dst)
 	return val
 }
 
+// Initializes a va_list. See va_list_tyf() for its layout.
+func gen_va_start(node *Node) int {
+	ap := gen_expr(node.expr)
+	r := nreg
+	nreg++
+
+	// Count the named parameters passed in each register class
+	// and on the stack.
+	gp := 0
+	if ret_hidden {
+		gp = 1
+	}
+	_, ngp, nfp, nstack := place_args(param_types(node.args), gp)
+
+	// gp_offset
+	add(IR_IMM, r, ngp*8)
+	store_n(ap, r, 4)
+	add_imm(IR_ADD, ap, 4)
+
+	// fp_offset
+	add(IR_IMM, r, 48+nfp*16)
+	store_n(ap, r, 4)
+	add_imm(IR_ADD, ap, 4)
+
+	// overflow_arg_area. Stack arguments start right above the
+	// return address, followed by the variadic ones.
+	add(IR_BPREL, r, -(16 + nstack*8))
+	store_n(ap, r, 8)
+	add_imm(IR_ADD, ap, 8)
+
+	// reg_save_area
+	add(IR_BPREL, r, node.offset)
+	store_n(ap, r, 8)
+
+	kill(r)
+	return ap
+}
+
+// Fetches the next variadic argument. If gp_offset is less than 48
+// (or fp_offset less than 176 for floating-point values), the argument
+// is in the register save area. Otherwise it has been passed on the
+// stack.
+func gen_va_arg(node *Node) int {
+	field, limit, step := 0, 48, 8
+	if is_flonum(node.ty) {
+		field, limit, step = 4, 176, 16
+	}
+
+	x := nlabel
+	nlabel++
+	y := nlabel
+	nlabel++
+
+	ap := gen_expr(node.expr)
+	addr := nreg
+	nreg++
+	off := nreg
+	nreg++
+
+	add_imm(IR_ADD, ap, field)
+	load_n(off, ap, 4)
+	r1 := nreg
+	nreg++
+	r2 := nreg
+	nreg++
+	add(IR_MOV, r1, off)
+	add(IR_IMM, r2, limit)
+	add(IR_LT, r1, r2)
+	kill(r2)
+	add(IR_UNLESS, r1, x)
+	kill(r1)
+
+	// reg_save_area + gp_offset (or fp_offset)
+	add(IR_MOV, addr, ap)
+	add_imm(IR_ADD, addr, 16-field)
+	load_n(addr, addr, 8)
+	add(IR_ADD, addr, off)
+	add_imm(IR_ADD, off, step)
+	store_n(ap, off, 4)
+	jmp(y)
+
+	// overflow_arg_area
+	label(x)
+	r3 := nreg
+	nreg++
+	add(IR_MOV, r3, ap)
+	add_imm(IR_ADD, r3, 8-field)
+	load_n(addr, r3, 8)
+	add(IR_MOV, off, addr)
+	add_imm(IR_ADD, off, 8)
+	store_n(r3, off, 8)
+	kill(r3)
+
+	label(y)
+	kill(off)
+	kill(ap)
+	load(node, addr, addr)
+	return addr
+}
+
+// Each argument is stored to its own slot as soon as it is
+// evaluated, so the number of arguments is not limited by the number
+// of registers. A struct argument takes a slot per eightbyte.
+func gen_call(node *Node) int {
+	fn := -1
+	if node.expr != nil {
+		fn = spill_arg(gen_expr(node.expr))
+	}
+
+	hidden := ret_in_mem(node.ty)
+	gp := 0
+	if hidden {
+		gp = 1
+	}
+	in_reg, _, _, _ := place_args(param_types(node.args), gp)
+
+	var args, fargs []int
+	var stack []bool
+	if hidden {
+		r := nreg
+		nreg++
+		add(IR_BPREL, r, node.offset)
+		args = append(args, spill_arg(r))
+		fargs = append(fargs, 0)
+		stack = append(stack, false)
+	}
+
+	for i := 0; i < node.args.len; i++ {
+		arg := node.args.data[i].(*Node)
+		if arg.ty.ty != STRUCT {
+			args = append(args, spill_arg(gen_expr(arg)))
+			size := 0
+			if is_flonum(arg.ty) {
+				size = arg.ty.size
+			}
+			fargs = append(fargs, size)
+			stack = append(stack, !in_reg[i])
+			continue
+		}
+
+		addr := gen_expr(arg)
+		classes := classify(arg.ty)
+		for k := 0; k*8 < arg.ty.size; k++ {
+			args = append(args, spill_arg(load_eightbyte(addr, k, arg.ty.size)))
+			size := 0
+			if in_reg[i] && classes[k] == CLASS_SSE {
+				size = 8
+			}
+			fargs = append(fargs, size)
+			stack = append(stack, !in_reg[i])
+		}
+		kill(addr)
+	}
+	argslots -= len(args)
+
+	r := nreg
+	nreg++
+
+	ir := add(IR_CALL, r, -1)
+	if node.expr != nil {
+		argslots--
+		ir.rhs = fn
+	} else {
+		ir.name = node.name
+	}
+	ir.nargs = len(args)
+	ir.args = args
+	ir.fargs = fargs
+	ir.stack = stack
+	ir.is_float = is_flonum(node.ty)
+	ir.size = node.ty.size
+
+	// The number of vector registers used is passed in AL for
+	// variadic functions.
+	for i := range args {
+		if fargs[i] != 0 && !stack[i] {
+			ir.nfloat++
+		}
+	}
+
+	if node.ty.ty == STRUCT && !hidden {
+		ir.classes = classify(node.ty)
+		ir.ret_offset = node.offset
+	}
+
+	// The upper bits of a narrow return value are unspecified in
+	// the ABI.
+	if is_integer(node.ty) && node.ty.size < 8 {
+		if node.ty.is_unsigned {
+			add(IR_ZEXT, r, node.ty.size)
+		} else {
+			add(IR_SEXT, r, node.ty.size)
+		}
+	}
+	return r
+}
+
 func gen_expr(node *Node) int {
 
 	switch node.op {
 	case ND_NUM:
 		{
+			if is_flonum(node.ty) {
+				return gen_fconst(node.ty, node.fval)
+			}
 			r := nreg
 			nreg++
 			add(IR_IMM, r, node.val)
 			return r
 		}
 	case ND_EQ:
-		return gen_binop(IR_EQ, node)
+		return gen_binop(typed_op(IR_EQ, node.lhs.ty), node)
 	case ND_NE:
-		return gen_binop(IR_NE, node)
+		return gen_binop(typed_op(IR_NE, node.lhs.ty), node)
 	case ND_LOGAND:
 		{
 			x := nlabel
@@ -224,101 +881,124 @@ func gen_expr(node *Node) int {
 		}
 	case ND_GVAR, ND_LVAR, ND_DOT:
 		{
+			// The value of a struct is its address.
 			r := gen_lval(node)
-			load(node, r, r)
+			if node.ty.ty != STRUCT {
+				load_lval(node, r, r)
+			}
 			return r
 		}
 
 	case ND_CALL:
-		{
-			var args [6]int
-			for i := 0; i < node.args.len; i++ {
-				args[i] = gen_expr(node.args.data[i].(*Node))
-			}
-			r := nreg
-			nreg++
-
-			ir := add(IR_CALL, r, -1)
-			ir.name = node.name
-			ir.nargs = node.args.len
-			for i := 0; i < 6; i++ {
-				ir.args[i] = args[i]
-			}
-			for i := 0; i < ir.nargs; i++ {
-				kill(ir.args[i])
-			}
-			return r
-		}
+		return gen_call(node)
 	case ND_ADDR:
 		{
 			return gen_lval(node.expr)
 		}
+	case ND_CAST:
+		{
+			r := gen_expr(node.expr)
+			if node.ty.ty != VOID {
+				gen_conv(r, node.expr.ty, node.ty)
+			}
+			return r
+		}
 	case ND_DEREF:
 		{
 			r := gen_expr(node.expr)
-			load(node, r, r)
+			if node.ty.ty != STRUCT {
+				load(node, r, r)
+			}
 			return r
 		}
 	case ND_STMT_EXPR:
 		{
-			orig_label := return_label
-			orig_reg := return_reg
-			return_label = nlabel
-			nlabel++
+			gen_stmt(node.body)
+			if node.expr != nil {
+				return gen_expr(node.expr)
+			}
 			r := nreg
 			nreg++
-			return_reg = r
-
-			gen_stmt(node.body)
-			label(return_label)
-
-			return_label = orig_label
-			return_reg = orig_reg
+			add(IR_IMM, r, 0)
 			return r
 		}
+	case ND_VA_START:
+		return gen_va_start(node)
+	case ND_VA_ARG:
+		return gen_va_arg(node)
+	case ND_VA_COPY:
+		{
+			dst := gen_expr(node.lhs)
+			src := gen_expr(node.rhs)
+			r := nreg
+			nreg++
+			for i := 0; i < 3; i++ {
+				load_n(r, src, 8)
+				store_n(dst, r, 8)
+				add_imm(IR_ADD, dst, 8)
+				add_imm(IR_ADD, src, 8)
+			}
+			kill(r)
+			kill(src)
+			return dst
+		}
+	case ND_VA_END:
+		return gen_expr(node.expr)
 	case ND_MUL_EQ, ND_DIV_EQ, ND_MOD_EQ, ND_ADD_EQ, ND_SUB_EQ, ND_SHL_EQ, ND_SHR_EQ, ND_BITAND_EQ, ND_XOR_EQ, ND_BITOR_EQ:
 		return gen_assign_op(node)
 	case '=':
 		{
 			rhs, lhs := gen_expr(node.rhs), gen_lval(node.lhs)
-			store(node, lhs, rhs)
+			if node.ty.ty == STRUCT {
+				gen_memcpy(lhs, rhs, node.ty.size)
+				kill(rhs)
+				return lhs
+			}
+			store_lval(node.lhs, lhs, rhs)
 			kill(lhs)
 			return rhs
 		}
 	case '+':
-		return gen_binop(IR_ADD, node)
+		return gen_arith(IR_ADD, node)
 	case '-':
-		return gen_binop(IR_SUB, node)
+		return gen_arith(IR_SUB, node)
 	case '*':
-		return gen_binop(IR_MUL, node)
+		return gen_arith(IR_MUL, node)
+	case ND_SHL:
+		return gen_arith(IR_SHL, node)
 	case '/':
-		return gen_binop(IR_DIV, node)
+		return gen_binop(typed_op(IR_DIV, node.ty), node)
 	case '%':
-		return gen_binop(IR_MOD, node)
+		return gen_binop(typed_op(IR_MOD, node.ty), node)
 	case '<':
-		return gen_binop(IR_LT, node)
+		return gen_binop(typed_op(IR_LT, node.lhs.ty), node)
 	case ND_LE:
-		return gen_binop(IR_LE, node)
+		return gen_binop(typed_op(IR_LE, node.lhs.ty), node)
 	case '&':
 		return gen_binop(IR_AND, node)
 	case '|':
 		return gen_binop(IR_OR, node)
 	case '^':
 		return gen_binop(IR_XOR, node)
-	case ND_SHL:
-		return gen_binop(IR_SHL, node)
 	case ND_SHR:
-		return gen_binop(IR_SHR, node)
+		return gen_binop(typed_op(IR_SAR, node.ty), node)
 	case '~':
 		{
 			r := gen_expr(node.expr)
 			add_imm(IR_XOR, r, -1)
+			normalize(r, node.ty)
 			return r
 		}
 	case ND_NEG:
 		{
 			r := gen_expr(node.expr)
+			if is_flonum(node.ty) {
+				ir := add(IR_FNEG, r, -1)
+				ir.size = node.ty.size
+				return r
+			}
 			add(IR_NEG, r, -1)
+			normalize(r, node.ty)
 			return r
 		}
 	case ND_POST_INC:
@@ -334,8 +1014,23 @@ func gen_expr(node *Node) int {
 			nlabel++
 			y := nlabel
 			nlabel++
-			r := gen_expr(node.cond)
+			// "a ?: b" jumps to the end with the value of a.
+			if node.cond == nil {
+				r := gen_expr(node.then)
+				r2 := nreg
+				nreg++
+				add(IR_MOV, r2, r)
+				gen_conv(r2, node.ty, bool_tyf())
+				add(IR_IF, r2, y)
+				kill(r2)
+				r3 := gen_expr(node.els)
+				add(IR_MOV, r, r3)
+				kill(r3)
+				label(y)
+				return r
+			}
 
+			r := gen_expr(node.cond)
 			add(IR_UNLESS, r, x)
 			r2 := gen_expr(node.then)
 			add(IR_MOV, r, r2)
@@ -345,7 +1040,7 @@ func gen_expr(node *Node) int {
 			label(x)
 			r3 := gen_expr(node.els)
 			add(IR_MOV, r, r3)
-			kill(r2)
+			kill(r3)
 			label(y)
 			return r
 		}
@@ -368,6 +1063,9 @@ func gen_expr(node *Node) int {
 
 func gen_stmt(node *Node) {
 	switch node.op {
+	case ND_ASM:
+		ir := add(IR_ASM, -1, -1)
+		ir.name = node.data
 	case ND_NULL:
 		return
 
@@ -376,13 +1074,19 @@ func gen_stmt(node *Node) {
 			if node.init == nil {
 				return
 			}
-			rhs := gen_expr(node.init)
-			lhs := nreg
-			nreg++
-			add(IR_BPREL, lhs, node.offset)
-			store(node, lhs, rhs)
-			kill(lhs)
-			kill(rhs)
+
+			// Members and elements without initializers are zero.
+			if is_aggregate(node.ty) {
+				r := nreg
+				nreg++
+				add(IR_BPREL, r, node.offset)
+				add(IR_ZERO, r, node.ty.size)
+				kill(r)
+			}
+
+			for i := 0; i < node.inits.len; i++ {
+				kill(gen_expr(node.inits.data[i].(*Node)))
+			}
 			return
 		}
 	case ND_IF:
@@ -417,9 +1121,11 @@ func gen_stmt(node *Node) {
 			nlabel++
 			y := nlabel
 			nlabel++
-			orig := break_label
+			orig, orig_cont := break_label, cont_label
 			break_label = nlabel
 			nlabel++
+			cont_label = nlabel
+			nlabel++
 
 			gen_stmt(node.init)
 			label(x)
@@ -429,49 +1135,109 @@ func gen_stmt(node *Node) {
 				kill(r)
 			}
 			gen_stmt(node.body)
+			label(cont_label)
 			if node.inc != nil {
 				gen_stmt(node.inc)
 			}
 			jmp(x)
 			label(y)
 			label(break_label)
-			break_label = orig
+			break_label, cont_label = orig, orig_cont
 			return
 		}
 	case ND_DO_WHILE:
 		{
 			x := nlabel
 			nlabel++
-			orig := break_label
+			orig, orig_cont := break_label, cont_label
 			break_label = nlabel
 			nlabel++
+			cont_label = nlabel
+			nlabel++
 			label(x)
 			gen_stmt(node.body)
+			label(cont_label)
 			r := gen_expr(node.cond)
 			add(IR_IF, r, x)
 			kill(r)
 			label(break_label)
+			break_label, cont_label = orig, orig_cont
+			return
+		}
+	case ND_SWITCH:
+		{
+			// Compares the value with each case label in turn and
+			// jumps to the matching one, to the default label or
+			// out of the statement.
+			orig := break_label
+			break_label = nlabel
+			nlabel++
+
+			r := gen_expr(node.cond)
+			for i := 0; i < node.cases.len; i++ {
+				c := node.cases.data[i].(*Node)
+				c.case_label = nlabel
+				nlabel++
+
+				r2 := nreg
+				nreg++
+				add(IR_IMM, r2, c.val)
+				if c.val == c.case_end {
+					add(IR_EQ, r2, r)
+					add(IR_IF, r2, c.case_label)
+					kill(r2)
+					continue
+				}
+
+				// A value is in a range if value - first is not
+				// greater than last - first as unsigned.
+				r3 := nreg
+				nreg++
+				add(IR_MOV, r3, r)
+				add(IR_SUB, r3, r2)
+				add(IR_IMM, r2, c.case_end-c.val)
+				add(IR_ULE, r3, r2)
+				add(IR_IF, r3, c.case_label)
+				kill(r2)
+				kill(r3)
+			}
+			kill(r)
+			if node.default_case != nil {
+				node.default_case.case_label = nlabel
+				nlabel++
+				jmp(node.default_case.case_label)
+			} else {
+				jmp(break_label)
+			}
+
+			gen_stmt(node.body)
+			label(break_label)
 			break_label = orig
 			return
 		}
+	case ND_CASE:
+		label(node.case_label)
+		gen_stmt(node.body)
 	case ND_BREAK:
 		if break_label == 0 {
-			ErrorReport("stray 'break' statement")
+			bad_node(node, "stray 'break' statement")
 		}
 		jmp(break_label)
+	case ND_CONTINUE:
+		if cont_label == 0 {
+			bad_node(node, "stray 'continue' statement")
+		}
+		jmp(cont_label)
 	case ND_RETURN:
 		{
 			r := gen_expr(node.expr)
-
-			// Statement expression (GNU extension)
-			if return_label != 0 {
-				add(IR_MOV, return_reg, r)
-				kill(r)
-				jmp(return_label)
+			if node.expr.ty.ty == STRUCT {
+				gen_return_struct(node.expr.ty, r)
 				return
 			}
 
-			add(IR_RETURN, r, -1)
+			ir := add(IR_RETURN, r, -1)
+			ir.is_float = is_flonum(node.expr.ty)
 			kill(r)
 			return
 		}
@@ -480,7 +1246,7 @@ func gen_stmt(node *Node) {
 			kill(gen_expr(node.expr))
 			return
 		}
-	case ND_COMP_STMT:
+	case ND_COMP_STMT, ND_DECL_LIST:
 		{
 			for i := 0; i < node.stmts.len; i++ {
 				gen_stmt((node.stmts.data[i]).(*Node))
@@ -492,33 +1258,120 @@ func gen_stmt(node *Node) {
 	}
 }
 
+// Copies a struct parameter passed in registers to its local
+// variable by eightbytes.
+func gen_struct_param(arg *Node, gp, fp *int) {
+	classes := classify(arg.ty)
+	for k, c := range classes {
+		if c == CLASS_SSE {
+			store_arg_n(arg.offset-k*8, *fp, 8, true)
+			*fp++
+		} else {
+			store_arg_n(arg.offset-k*8, *gp, 8, false)
+			*gp++
+		}
+	}
+}
+
+// Copies a struct parameter passed on the stack to its local
+// variable. Returns the number of stack eightbytes it takes.
+func gen_stack_struct_param(arg *Node, nstack int) int {
+	src := nreg
+	nreg++
+	dst := nreg
+	nreg++
+	add(IR_BPREL, src, -(16 + nstack*8))
+	add(IR_BPREL, dst, arg.offset)
+	gen_memcpy(dst, src, arg.ty.size)
+	kill(src)
+	kill(dst)
+	return (arg.ty.size + 7) / 8
+}
+
 func Gen_ir(nodes *Vector) *Vector {
 	v := new_vec()
 	nlabel = 1
 
-	for i := 0; i < nodes.len; i++ {
-		node := nodes.data[i].(*Node)
+	guard(func() {
+		for i := 0; i < nodes.len; i++ {
+			node := nodes.data[i].(*Node)
 
-		if node.op == ND_VARDEF || node.op == ND_DECL {
-			continue
-		}
+			if node.op == ND_VARDEF || node.op == ND_DECL {
+				continue
+			}
 
-		//assert(node.op == ND_FUNC)
-		code = new_vec()
+			//assert(node.op == ND_FUNC)
+			code = new_vec()
+			localsize = node.stacksize
+			argslots = 0
+			maxslots = 0
 
-		for i := 0; i < node.args.len; i++ {
-			arg := node.args.data[i].(*Node)
-			store_arg(arg, arg.offset, i)
-		}
+			// The first six integer arguments and the first eight
+			// floating-point ones are passed in registers and the rest
+			// on the stack above the return address. Both are copied to
+			// the parameters' local variables.
+			ret_buf = node.ret_buf
+			ret_hidden = ret_in_mem(node.ty.returning)
+			gp, fp, nstack := 0, 0, 0
+			if ret_hidden {
+				store_arg_n(ret_buf, 0, 8, false)
+				gp++
+			}
 
-		gen_stmt(node.body)
+			// Parameters in registers are stored first, since a
+			// struct on the stack is copied with rep movsb, which
+			// uses rdi, rsi and rcx.
+			in_reg, _, _, _ := place_args(param_types(node.args), gp)
+			for i := 0; i < node.args.len; i++ {
+				arg := node.args.data[i].(*Node)
+				if !in_reg[i] {
+					continue
+				}
+				if arg.ty.ty == STRUCT {
+					gen_struct_param(arg, &gp, &fp)
+				} else if is_flonum(arg.ty) {
+					store_arg(arg, arg.offset, fp)
+					fp++
+				} else {
+					store_arg(arg, arg.offset, gp)
+					gp++
+				}
+			}
+			for i := 0; i < node.args.len; i++ {
+				arg := node.args.data[i].(*Node)
+				if in_reg[i] {
+					continue
+				}
+				if arg.ty.ty == STRUCT {
+					nstack += gen_stack_struct_param(arg, nstack)
+					continue
+				}
+				r := nreg
+				nreg++
+				add(IR_BPREL, r, -(16 + nstack*8))
+				nstack++
+				load_n(r, r, 8)
+				addr := nreg
+				nreg++
+				add(IR_BPREL, addr, arg.offset)
+				store(arg, addr, r)
+				kill(addr)
+				kill(r)
+			}
 
-		fn := new(Function)
-		fn.name = node.name
-		fn.stacksize = node.stacksize
-		fn.ir = code
-		fn.globals = node.globals
-		vec_push(v, fn)
-	}
+			gen_stmt(node.body)
+
+			fn := new(Function)
+			fn.name = node.name
+			fn.is_static = node.is_static
+			fn.stacksize = localsize + maxslots*8
+			fn.frame_align = node.frame_align
+			fn.va_area = node.va_area
+			fn.ir = code
+			fn.globals = node.globals
+			fn.attrs = node.attrs
+			vec_push(v, fn)
+		}
+	})
 	return v
 }
@@ -0,0 +1,29 @@
+package go9cc
+
+import "testing"
+
+// Accesses to volatile objects must all be kept. No pass drops or
+// merges loads and stores, so each access is one IR_LOAD or IR_STORE.
+func Test_volatile_access(t *testing.T) {
+	src := "volatile int v;\nint f() { v; (void)v; v = 1; v = 1; return v; }\n"
+	nodes := Parse(tokenize_buf("test.c", src, true, nil))
+	Sema(nodes)
+	fns := Gen_ir(nodes)
+	if nerrors != 0 || fns.len != 1 {
+		t.Fatalf("%q: failed to compile", src)
+	}
+
+	loads, stores := 0, 0
+	code := fns.data[0].(*Function).ir
+	for i := 0; i < code.len; i++ {
+		switch code.data[i].(*IR).op {
+		case IR_LOAD:
+			loads++
+		case IR_STORE:
+			stores++
+		}
+	}
+	if loads != 3 || stores != 2 {
+		t.Errorf("%q: expected 3 loads and 2 stores, got: %d and %d", src, loads, stores)
+	}
+}
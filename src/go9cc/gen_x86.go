@@ -10,21 +10,19 @@ var (
 	n         int
 	glabel    int
 	regs      = []string{"r10", "r11", "rbx", "r12", "r13", "r14", "r15"}
-	regs8     = []string{"r10b", "r11b", "b1", "r12b", "r13b", "r14b", "r15b"}
+	regs8     = []string{"r10b", "r11b", "bl", "r12b", "r13b", "r14b", "r15b"}
+	regs16    = []string{"r10w", "r11w", "bx", "r12w", "r13w", "r14w", "r15w"}
 	regs32    = []string{"r10d", "r11d", "ebx", "r12d", "r13d", "r14d", "r15d"}
 	argregs   = []string{"rdi", "rsi", "rdx", "rcx", "r8", "r9"}
 	argregs8  = []string{"dil", "sil", "dl", "cl", "r8b", "r9b"}
+	argregs16 = []string{"di", "si", "dx", "cx", "r8w", "r9w"}
 	argregs32 = []string{"edi", "esi", "edx", "ecx", "r8d", "r9d"}
+	retregs   = []string{"rax", "rdx"}
 	num_regs  = len(regs)
 )
 
 func backslash_escape(s string, length int) string {
-
-	if len(s) == 0 {
-		return string([]rune{'\\', '0', '0', '0', '\\', '0', '0', '0', '\\', '0', '0', '0', '\\', '0', '0', '0'})
-	}
-
-	escaped := map[rune]rune{
+	escaped := map[byte]byte{
 		'\b': 'b',
 		'\f': 'f',
 		'\n': 'n',
@@ -36,20 +34,18 @@ func backslash_escape(s string, length int) string {
 	}
 
 	sb := new_sb()
-	for _, c := range s {
+	for i := 0; i < length; i++ {
+		c := s[i]
 		esc, ok := escaped[c]
 		if ok {
 			sb_add(sb, "\\")
 			sb_add(sb, string(esc))
-		} else if isgraph_rune(c) || c == ' ' {
+		} else if isgraph(c) || c == ' ' {
 			sb_add(sb, string(c))
 		} else {
 			sb_append(sb, format("\\%03o", c))
 		}
 	}
-
-	buf := string([]rune{'\\', '0', '0', '0'})
-	sb_append(sb, buf)
 	return sb_get(sb)
 }
 
@@ -57,6 +53,9 @@ func argreg(r, size int) string {
 	if size == 1 {
 		return argregs8[r]
 	}
+	if size == 2 {
+		return argregs16[r]
+	}
 	if size == 4 {
 		return argregs32[r]
 	}
@@ -84,6 +83,9 @@ func reg(r, size int) string {
 	if size == 1 {
 		return regs8[r]
 	}
+	if size == 2 {
+		return regs16[r]
+	}
 	if size == 4 {
 		return regs32[r]
 	}
@@ -91,20 +93,281 @@ func reg(r, size int) string {
 	return regs[r]
 }
 
+// Loads a value and extends it to 64 bits.
+func emit_load(ir *IR) {
+	dst := regs[ir.lhs]
+	src := regs[ir.rhs]
+	ext := "movsx"
+	if ir.is_unsigned {
+		ext = "movzx"
+	}
+
+	switch ir.size {
+	case 1:
+		emit("%s %s, byte ptr [%s]", ext, dst, src)
+	case 2:
+		emit("%s %s, word ptr [%s]", ext, dst, src)
+	case 4:
+		if ir.is_unsigned {
+			emit("mov %s, [%s]", regs32[ir.lhs], src)
+		} else {
+			emit("movsxd %s, dword ptr [%s]", dst, src)
+		}
+	default:
+		emit("mov %s, [%s]", dst, src)
+	}
+}
+
+// Sign- or zero-extends the lower bytes of a register.
+func emit_ext(ir *IR) {
+	r := ir.lhs
+	ext := "movsx"
+	if ir.op == IR_ZEXT {
+		ext = "movzx"
+	}
+
+	switch ir.rhs {
+	case 1:
+		emit("%s %s, %s", ext, regs[r], regs8[r])
+	case 2:
+		emit("%s %s, %s", ext, regs[r], regs16[r])
+	default:
+		// assert(ir.rhs == 4)
+		if ir.op == IR_ZEXT {
+			emit("mov %s, %s", regs32[r], regs32[r])
+		} else {
+			emit("movsxd %s, %s", regs[r], regs32[r])
+		}
+	}
+}
+
+// Floating-point values live in general-purpose registers as bit
+// patterns. They are moved to vector registers for each operation.
+func to_xmm(xmm string, r, size int) {
+	if size == 4 {
+		emit("movd %s, %s", xmm, regs32[r])
+	} else {
+		emit("movq %s, %s", xmm, regs[r])
+	}
+}
+
+func from_xmm(r int, xmm string, size int) {
+	if size == 4 {
+		emit("movd %s, %s", regs32[r], xmm)
+	} else {
+		emit("movq %s, %s", regs[r], xmm)
+	}
+}
+
+// Returns the scalar instruction suffix for a floating-point size.
+func fsuffix(size int) string {
+	if size == 4 {
+		return "ss"
+	}
+	return "sd"
+}
+
+func emit_farith(ir *IR, insn string) {
+	to_xmm("xmm0", ir.lhs, ir.size)
+	to_xmm("xmm1", ir.rhs, ir.size)
+	emit("%s%s xmm0, xmm1", insn, fsuffix(ir.size))
+	from_xmm(ir.lhs, "xmm0", ir.size)
+}
+
+// Compares two floating-point values. Any comparison with NaN is
+// false except for "!=".
+func emit_fcmp(ir *IR) {
+	to_xmm("xmm0", ir.lhs, ir.size)
+	to_xmm("xmm1", ir.rhs, ir.size)
+
+	switch ir.op {
+	case IR_FEQ:
+		emit("ucomi%s xmm0, xmm1", fsuffix(ir.size))
+		emit("sete al")
+		emit("setnp dl")
+		emit("and al, dl")
+	case IR_FNE:
+		emit("ucomi%s xmm0, xmm1", fsuffix(ir.size))
+		emit("setne al")
+		emit("setp dl")
+		emit("or al, dl")
+	case IR_FLT:
+		emit("ucomi%s xmm1, xmm0", fsuffix(ir.size))
+		emit("seta al")
+	default:
+		// assert(ir.op == IR_FLE)
+		emit("ucomi%s xmm1, xmm0", fsuffix(ir.size))
+		emit("setae al")
+	}
+	emit("movzx %s, al", regs[ir.lhs])
+}
+
+// Converts a 64-bit integer to floating-point. Unsigned values with
+// the top bit set are halved first, keeping the lowest bit for
+// rounding, and doubled afterwards.
+func emit_i2f(ir *IR) {
+	r := regs[ir.lhs]
+	sfx := fsuffix(ir.size)
+
+	if !ir.is_unsigned {
+		emit("cvtsi2%s xmm0, %s", sfx, r)
+		from_xmm(ir.lhs, "xmm0", ir.size)
+		return
+	}
+
+	big := format(".Lcvt%d", glabel)
+	end := format(".Lcvt%d", glabel+1)
+	glabel += 2
+
+	emit("test %s, %s", r, r)
+	emit("js %s", big)
+	emit("cvtsi2%s xmm0, %s", sfx, r)
+	emit("jmp %s", end)
+	fmt.Printf("%s:\n", big)
+	emit("mov rax, %s", r)
+	emit("shr rax, 1")
+	emit("mov rdx, %s", r)
+	emit("and edx, 1")
+	emit("or rax, rdx")
+	emit("cvtsi2%s xmm0, rax", sfx)
+	emit("add%s xmm0, xmm0", sfx)
+	fmt.Printf("%s:\n", end)
+	from_xmm(ir.lhs, "xmm0", ir.size)
+}
+
+// Converts floating-point to a 64-bit integer, truncating toward
+// zero. Values not less than 2^63 cannot be converted directly to
+// unsigned long, so 2^63 is subtracted before and added after.
+func emit_f2i(ir *IR) {
+	r := regs[ir.lhs]
+	sfx := fsuffix(ir.size)
+	to_xmm("xmm0", ir.lhs, ir.size)
+
+	if !ir.is_unsigned {
+		emit("cvtt%s2si %s, xmm0", sfx, r)
+		return
+	}
+
+	big := format(".Lcvt%d", glabel)
+	end := format(".Lcvt%d", glabel+1)
+	glabel += 2
+
+	if ir.size == 4 {
+		emit("mov eax, 0x5f000000")
+		emit("movd xmm1, eax")
+	} else {
+		emit("mov rax, 0x43e0000000000000")
+		emit("movq xmm1, rax")
+	}
+	emit("ucomi%s xmm0, xmm1", sfx)
+	emit("jae %s", big)
+	emit("cvtt%s2si %s, xmm0", sfx, r)
+	emit("jmp %s", end)
+	fmt.Printf("%s:\n", big)
+	emit("sub%s xmm0, xmm1", sfx)
+	emit("cvtt%s2si %s, xmm0", sfx, r)
+	emit("btc %s, 63", r)
+	fmt.Printf("%s:\n", end)
+}
+
+// A struct is returned in RAX and RDX, XMM0 and XMM1, or one of each
+// depending on the classes of its eightbytes. The struct is in a
+// buffer padded to eightbytes.
+func emit_struct_return(ir *IR) {
+	gp, fp := 0, 0
+	for k, c := range ir.classes {
+		if c == CLASS_SSE {
+			emit("movsd xmm%d, [%s+%d]", fp, regs[ir.lhs], k*8)
+			fp++
+		} else {
+			emit("mov %s, [%s+%d]", retregs[gp], regs[ir.lhs], k*8)
+			gp++
+		}
+	}
+}
+
+// Stores a struct returned in registers to its temporary. The result
+// of the call is the address of the temporary.
+func emit_struct_result(ir *IR) {
+	gp, fp := 0, 0
+	for k, c := range ir.classes {
+		if c == CLASS_SSE {
+			emit("movsd [rbp-%d], xmm%d", ir.ret_offset-k*8, fp)
+			fp++
+		} else {
+			emit("mov [rbp-%d], %s", ir.ret_offset-k*8, retregs[gp])
+			gp++
+		}
+	}
+	emit("lea %s, [rbp-%d]", regs[ir.lhs], ir.ret_offset)
+}
+
+// The shift count is an immediate or in CL.
+func emit_shift(ir *IR, insn string) {
+	if ir.is_imm {
+		emit("%s %s, %d", insn, regs[ir.lhs], ir.rhs)
+		return
+	}
+	emit("mov cl, %s", regs8[ir.rhs])
+	emit("%s %s, cl", insn, regs[ir.lhs])
+}
+
 func gen(fn *Function) {
 
 	ret := format(".Lend%d", glabel)
+	va_skip := format(".Lva%d", glabel)
 	glabel++
 
-	fmt.Printf(".global %s\n", fn.name)
+	attrs := fn.attrs
+	if attrs == nil {
+		attrs = &Attrs{}
+	}
+	if attrs.section != "" {
+		fmt.Printf(".section %s,\"ax\",@progbits\n", attrs.section)
+	}
+	if attrs.aligned > 1 {
+		fmt.Printf(".align %d\n", attrs.aligned)
+	}
+	emit_symbol(fn.name, fn.is_static, attrs)
 	fmt.Printf("%s:\n", fn.name)
+	// Callee-saved registers are pushed below the local variables.
+	// The extra 8 bytes keep RSP 16-byte aligned.
+	//
+	// If a local variable needs an alignment greater than 16, RBP
+	// is rounded down to it. The original frame address is saved at
+	// RBP+8, from which the stack arguments are addressed and RSP
+	// is restored on return.
+	stacksize := roundup(fn.stacksize, 16)
+	realign := fn.frame_align > 16
 	emit("push rbp")
+	if realign {
+		emit("mov r11, rsp")
+		emit("and rsp, %d", -fn.frame_align)
+		emit("sub rsp, %d", fn.frame_align)
+		emit("mov [rsp+8], r11")
+	}
 	emit("mov rbp, rsp")
-	emit("sub rsp, %d", roundup(fn.stacksize, 16))
+	emit("sub rsp, %d", stacksize)
+	emit("push rbx")
 	emit("push r12")
 	emit("push r13")
 	emit("push r14")
 	emit("push r15")
+	emit("sub rsp, 8")
+
+	// Save argument registers for va_arg. %al holds the number of
+	// vector registers used by the caller.
+	if fn.va_area != 0 {
+		for i := 0; i < 6; i++ {
+			emit("mov [rbp-%d], %s", fn.va_area-i*8, argregs[i])
+		}
+		emit("test al, al")
+		emit("je %s", va_skip)
+		for i := 0; i < 8; i++ {
+			emit("movaps [rbp-%d], xmm%d", fn.va_area-48-i*16, i)
+		}
+		fmt.Printf("%s:\n", va_skip)
+	}
 
 	for i := 0; i < fn.ir.len; i++ {
 		ir := fn.ir.data[i].(*IR)
@@ -115,29 +378,94 @@ func gen(fn *Function) {
 		case IR_IMM:
 			emit("mov %s, %d", regs[lhs], rhs)
 		case IR_BPREL:
-			emit("lea %s, [rbp-%d]", regs[lhs], rhs)
+			if realign && rhs < 0 {
+				emit("mov %s, [rbp+8]", regs[lhs])
+				emit("lea %s, [%s%+d]", regs[lhs], regs[lhs], -rhs)
+				break
+			}
+			emit("lea %s, [rbp%+d]", regs[lhs], -rhs)
 		case IR_MOV:
 			emit("mov %s, %s", regs[lhs], regs[rhs])
 		case IR_RETURN:
+			if ir.classes != nil {
+				emit_struct_return(ir)
+				emit("jmp %s", ret)
+				break
+			}
+			if ir.is_float {
+				emit("movq xmm0, %s", regs[lhs])
+			}
 			emit("mov rax, %s", regs[lhs])
 			emit("jmp %s", ret)
 		case IR_CALL:
 			{
+				// Arguments in registers are loaded to the
+				// general-purpose or vector registers in order and
+				// the rest are pushed in reverse order. RSP must be
+				// 16-byte aligned at the call instruction.
+				var stack []int
 				for i := 0; i < ir.nargs; i++ {
-					emit("mov %s, %s", argregs[i], regs[ir.args[i]])
+					if ir.stack[i] {
+						stack = append(stack, ir.args[i])
+					}
 				}
+				nstack := len(stack)
+
 				emit("push r10")
 				emit("push r11")
-				emit("mov rax, 0")
-				emit("call %s", ir.name)
+				if nstack%2 == 1 {
+					emit("sub rsp, 8")
+				}
+				for i := nstack - 1; i >= 0; i-- {
+					emit("push qword ptr [rbp-%d]", stack[i])
+				}
+
+				gp, fp := 0, 0
+				for i := 0; i < ir.nargs; i++ {
+					if ir.stack[i] {
+						continue
+					}
+					if ir.fargs[i] != 0 {
+						emit("mov%s xmm%d, [rbp-%d]", fsuffix(ir.fargs[i]), fp, ir.args[i])
+						fp++
+					} else {
+						emit("mov %s, [rbp-%d]", argregs[gp], ir.args[i])
+						gp++
+					}
+				}
+				emit("mov eax, %d", ir.nfloat)
+				if ir.name == "" {
+					emit("call qword ptr [rbp-%d]", ir.rhs)
+				} else {
+					emit("call %s", ir.name)
+				}
+				if nstack > 0 {
+					emit("add rsp, %d", roundup(nstack, 2)*8)
+				}
 				emit("pop r11")
 				emit("pop r10")
-				emit("mov %s, rax", regs[lhs])
+				if ir.classes != nil {
+					emit_struct_result(ir)
+				} else if ir.is_float {
+					from_xmm(lhs, "xmm0", ir.size)
+				} else {
+					emit("mov %s, rax", regs[lhs])
+				}
 			}
+		case IR_MEMCPY:
+			emit("mov rdi, %s", regs[lhs])
+			emit("mov rsi, %s", regs[rhs])
+			emit("mov rcx, %d", ir.size)
+			emit("rep movsb")
 		case IR_LABEL:
 			fmt.Printf(".L%d:\n", lhs)
 		case IR_LABEL_ADDR:
 			emit("lea %s, %s", regs[lhs], ir.name)
+		case IR_TLS_ADDR:
+			// Initial-exec TLS model: the offset of the variable from
+			// the thread pointer is loaded from the GOT.
+			emit("mov %s, QWORD PTR %s@gottpoff[rip]", regs[lhs], ir.name)
+			emit("add %s, QWORD PTR fs:0", regs[lhs])
 		case IR_NEG:
 			emit("neg %s", regs[lhs])
 		case IR_EQ:
@@ -148,6 +476,10 @@ func gen(fn *Function) {
 			emit_cmp(ir, "setl")
 		case IR_LE:
 			emit_cmp(ir, "setle")
+		case IR_ULT:
+			emit_cmp(ir, "setb")
+		case IR_ULE:
+			emit_cmp(ir, "setbe")
 		case IR_AND:
 			emit("and %s, %s", regs[lhs], regs[rhs])
 		case IR_OR:
@@ -159,11 +491,11 @@ func gen(fn *Function) {
 				emit("xor %s, %s", regs[lhs], regs[rhs])
 			}
 		case IR_SHL:
-			emit("mov cl, %s", regs8[rhs])
-			emit("shl %s, cl", regs[lhs])
+			emit_shift(ir, "shl")
 		case IR_SHR:
-			emit("mov cl, %s", regs8[rhs])
-			emit("shr %s, cl", regs[lhs])
+			emit_shift(ir, "shr")
+		case IR_SAR:
+			emit_shift(ir, "sar")
 		case IR_JMP:
 			emit("jmp .L%d", lhs)
 		case IR_IF:
@@ -173,14 +505,17 @@ func gen(fn *Function) {
 			emit("cmp %s, 0", regs[lhs])
 			emit("je .L%d", rhs)
 		case IR_LOAD:
-			emit("mov %s, [%s]", reg(lhs, ir.size), regs[rhs])
-			if ir.size == 1 {
-				emit("movzb %s, %s", regs[lhs], regs8[lhs])
-			}
+			emit_load(ir)
+		case IR_SEXT, IR_ZEXT:
+			emit_ext(ir)
 		case IR_STORE:
 			emit("mov [%s], %s", regs[lhs], reg(rhs, ir.size))
 		case IR_STORE_ARG:
-			emit("mov [rbp-%d], %s", lhs, argreg(rhs, ir.size))
+			if ir.is_float {
+				emit("mov%s [rbp-%d], xmm%d", fsuffix(ir.size), lhs, rhs)
+			} else {
+				emit("mov [rbp-%d], %s", lhs, argreg(rhs, ir.size))
+			}
 		case IR_ADD:
 			if ir.is_imm {
 				emit("add %s, %d", regs[lhs], rhs)
@@ -195,9 +530,7 @@ func gen(fn *Function) {
 			}
 		case IR_MUL:
 			if !ir.is_imm {
-				emit("mov rax, %s", regs[rhs])
-				emit("mul %s", regs[lhs])
-				emit("mov %s, rax", regs[lhs])
+				emit("imul %s, %s", regs[lhs], regs[rhs])
 				break
 			}
 			if popCount(uint(rhs)) == 1 {
@@ -205,18 +538,61 @@ func gen(fn *Function) {
 				break
 			}
 			emit("mov rax, %d", rhs)
-			emit("mul %s", regs[lhs])
-			emit("mov %s, rax", regs[lhs])
-		case IR_DIV:
+			emit("imul %s, rax", regs[lhs])
+		case IR_DIV, IR_MOD:
 			emit("mov rax, %s", regs[lhs])
 			emit("cqo")
-			emit("div %s", regs[rhs])
-			emit("mov %s, rax", regs[lhs])
-		case IR_MOD:
+			emit("idiv %s", regs[rhs])
+			if ir.op == IR_DIV {
+				emit("mov %s, rax", regs[lhs])
+			} else {
+				emit("mov %s, rdx", regs[lhs])
+			}
+		case IR_UDIV, IR_UMOD:
 			emit("mov rax, %s", regs[lhs])
-			emit("cqo")
+			emit("xor edx, edx")
 			emit("div %s", regs[rhs])
-			emit("mov %s, rdx", regs[lhs])
+			if ir.op == IR_UDIV {
+				emit("mov %s, rax", regs[lhs])
+			} else {
+				emit("mov %s, rdx", regs[lhs])
+			}
+		case IR_FADD:
+			emit_farith(ir, "add")
+		case IR_FSUB:
+			emit_farith(ir, "sub")
+		case IR_FMUL:
+			emit_farith(ir, "mul")
+		case IR_FDIV:
+			emit_farith(ir, "div")
+		case IR_FNEG:
+			if ir.size == 4 {
+				emit("btc %s, 31", regs32[lhs])
+			} else {
+				emit("btc %s, 63", regs[lhs])
+			}
+		case IR_FEQ, IR_FNE, IR_FLT, IR_FLE:
+			emit_fcmp(ir)
+		case IR_I2F:
+			emit_i2f(ir)
+		case IR_F2I:
+			emit_f2i(ir)
+		case IR_F2F:
+			if ir.size == 8 {
+				to_xmm("xmm0", lhs, 4)
+				emit("cvtss2sd xmm0, xmm0")
+			} else {
+				to_xmm("xmm0", lhs, 8)
+				emit("cvtsd2ss xmm0, xmm0")
+			}
+			from_xmm(lhs, "xmm0", ir.size)
+		case IR_ZERO:
+			emit("mov rdi, %s", regs[lhs])
+			emit("mov rcx, %d", rhs)
+			emit("xor eax, eax")
+			emit("rep stosb")
+		case IR_ASM:
+			emit("%s", ir.name)
 		case IR_NOP:
 			break
 		default:
@@ -225,27 +601,240 @@ func gen(fn *Function) {
 	}
 
 	fmt.Printf("%s:\n", ret)
+	emit("lea rsp, [rbp-%d]", stacksize+40)
 	emit("pop r15")
 	emit("pop r14")
 	emit("pop r13")
 	emit("pop r12")
-	emit("mov rsp, rbp")
+	emit("pop rbx")
+	if realign {
+		emit("mov rsp, [rbp+8]")
+	} else {
+		emit("mov rsp, rbp")
+	}
 	emit("pop rbp")
 	emit("ret")
+
+	if attrs.section != "" {
+		fmt.Printf(".text\n")
+	}
+	if attrs.constructor != 0 {
+		emit_init_array(".init_array", attrs.constructor, fn.name)
+	}
+	if attrs.destructor != 0 {
+		emit_init_array(".fini_array", attrs.destructor, fn.name)
+	}
+}
+
+// Declares the binding and the visibility of a global symbol.
+func emit_symbol(name string, is_static bool, attrs *Attrs) {
+	if is_static {
+		return
+	}
+	if attrs.is_weak {
+		fmt.Printf(".weak %s\n", name)
+	} else {
+		fmt.Printf(".global %s\n", name)
+	}
+	if attrs.visibility != "" {
+		fmt.Printf(".%s %s\n", attrs.visibility, name)
+	}
+}
+
+// Registers a constructor or destructor, which is called before or
+// after main. The linker sorts the sections with priorities by name.
+func emit_init_array(sec string, prio int, name string) {
+	if prio != 65535 {
+		sec = format("%s.%05d", sec, prio)
+	}
+	fmt.Printf(".section %s,\"aw\"\n", sec)
+	fmt.Printf(".align 8\n")
+	emit(".quad %s", name)
+	fmt.Printf(".text\n")
+}
+
+// Emits the initial data of a global variable. Each initialized
+// scalar is emitted with a directive of its size, and pointers to
+// other symbols as relocations. Bytes not covered by a scalar are
+// zeros, except in string literals, which are emitted as .ascii.
+func emit_data(v *Var) {
+	rels := make(map[int]*Reloc)
+	if v.rels != nil {
+		for i := 0; i < v.rels.len; i++ {
+			rel := v.rels.data[i].(*Reloc)
+			rels[rel.offset] = rel
+		}
+	}
+
+	// Sizes of the scalars by their offsets. A scalar overlapped by
+	// another, as members of a union can be, is emitted byte by byte.
+	sizes := make(map[int]int)
+	if v.inits != nil {
+		for i := 0; i < v.inits.len; i++ {
+			init := v.inits.data[i].(*Initializer)
+			if sizes[init.offset] < init.ty.size {
+				sizes[init.offset] = init.ty.size
+			}
+		}
+	} else if v.ty.ty != ARY && v.ty.ty != STRUCT {
+		sizes[0] = v.ty.size
+	}
+	is_start := func(off int) bool {
+		return sizes[off] > 0 || rels[off] != nil
+	}
+
+	pos := 0
+	for pos < v.ty.size {
+		if rel, ok := rels[pos]; ok {
+			emit(".quad %s%+d", rel.label, rel.addend)
+			pos += 8
+			continue
+		}
+
+		if size := sizes[pos]; size > 0 {
+			for i := 1; i < size; i++ {
+				if is_start(pos + i) {
+					size = 1
+					break
+				}
+			}
+			emit("%s %d", data_directive(size), data_val(v, pos, size))
+			pos += size
+			continue
+		}
+
+		end := pos
+		for end < v.ty.size && !is_start(end) {
+			end++
+		}
+		if v.inits == nil && pos < v.len {
+			n := end
+			if n > v.len {
+				n = v.len
+			}
+			emit(".ascii \"%s\"", backslash_escape(v.data[pos:], n-pos))
+			pos = n
+		}
+		for pos < end && pos < v.len && v.data[pos] != 0 {
+			emit(".byte %d", data_val(v, pos, 1))
+			pos++
+		}
+		zero := pos
+		for zero < end && (zero >= v.len || v.data[zero] == 0) {
+			zero++
+		}
+		if pos < zero {
+			emit(".zero %d", zero-pos)
+			pos = zero
+		}
+	}
+}
+
+func data_directive(size int) string {
+	switch size {
+	case 2:
+		return ".short"
+	case 4:
+		return ".long"
+	case 8:
+		return ".quad"
+	}
+	return ".byte"
+}
+
+// Returns the little-endian value of size bytes at off in the data
+// of a variable, sign-extended.
+func data_val(v *Var, off, size int) int64 {
+	var val uint64
+	for i := size - 1; i >= 0; i-- {
+		val <<= 8
+		if off+i < v.len {
+			val |= uint64(v.data[off+i])
+		}
+	}
+	shift := uint(64 - size*8)
+	return int64(val<<shift) >> shift
+}
+
+// Returns true if a global variable has no initial data other than
+// zeros, so that it can be placed in a bss section.
+func is_zero_data(v *Var) bool {
+	if v.rels != nil && v.rels.len > 0 {
+		return false
+	}
+	for i := 0; i < v.len && i < v.ty.size; i++ {
+		if v.data[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func section_of(v *Var) string {
+	if v.attrs != nil && v.attrs.section != "" {
+		flags := "aw"
+		if v.is_tls {
+			flags = "awT"
+		} else if v.is_rodata {
+			flags = "a"
+		}
+		return format(".section %s,\"%s\",@progbits", v.attrs.section, flags)
+	}
+	if v.is_tls {
+		if is_zero_data(v) {
+			return ".section .tbss,\"awT\",@nobits"
+		}
+		return ".section .tdata,\"awT\",@progbits"
+	}
+	if v.is_rodata {
+		return ".section .rodata"
+	}
+	if is_zero_data(v) {
+		return ".bss"
+	}
+	return ".data"
 }
 
 func Gen_x86(globals, fns *Vector) {
 
 	fmt.Printf(".intel_syntax noprefix\n")
 
-	fmt.Printf(".data\n")
+	section := ""
 	for i := 0; i < globals.len; i++ {
 		v := globals.data[i].(*Var)
 		if v.is_extern {
+			if v.attrs != nil && v.attrs.is_weak {
+				fmt.Printf(".weak %s\n", v.name)
+			}
 			continue
 		}
+
+		sec := section_of(v)
+		if sec != section {
+			fmt.Printf("%s\n", sec)
+			section = sec
+		}
+		align := v.ty.align
+		if v.align > align {
+			align = v.align
+		}
+		if align > 1 {
+			fmt.Printf(".align %d\n", align)
+		}
+		attrs := v.attrs
+		if attrs == nil {
+			attrs = &Attrs{}
+		}
+		emit_symbol(v.name, v.is_static, attrs)
 		fmt.Printf("%s:\n", v.name)
-		emit(".ascii \"%s\"", backslash_escape(v.data, v.len))
+		if is_zero_data(v) {
+			// A zero-length array (GNU extension) has no data.
+			if v.ty.size > 0 {
+				emit(".zero %d", v.ty.size)
+			}
+			continue
+		}
+		emit_data(v)
 	}
 
 	fmt.Printf(".text\n")
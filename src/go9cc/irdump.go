@@ -14,6 +14,8 @@ var irinfo = map[int]IRInfo{
 	IR_KILL:       {name: "KILL", ty: IR_TY_REG},
 	IR_LABEL:      {name: "", ty: IR_TY_LABEL},
 	IR_LABEL_ADDR: {name: "LABEL_ADDR", ty: IR_TY_LABEL_ADDR},
+	IR_TLS_ADDR:   {name: "TLS_ADDR", ty: IR_TY_LABEL_ADDR},
+	IR_MEMCPY:     {name: "MEMCPY", ty: IR_TY_REG_REG},
 	IR_EQ:         {name: "EQ", ty: IR_TY_REG_REG},
 	IR_NE:         {name: "NE", ty: IR_TY_REG_REG},
 	IR_LE:         {name: "LE", ty: IR_TY_REG_REG},
@@ -21,19 +23,40 @@ var irinfo = map[int]IRInfo{
 	IR_AND:        {name: "AND", ty: IR_TY_REG_REG},
 	IR_OR:         {name: "OR", ty: IR_TY_REG_REG},
 	IR_XOR:        {name: "XOR", ty: IR_TY_BINARY},
-	IR_SHL:        {name: "SHL", ty: IR_TY_REG_REG},
-	IR_SHR:        {name: "SHR", ty: IR_TY_REG_REG},
+	IR_SHL:        {name: "SHL", ty: IR_TY_BINARY},
+	IR_SHR:        {name: "SHR", ty: IR_TY_BINARY},
 	IR_LOAD:       {name: "LOAD", ty: IR_TY_MEM},
 	IR_MOD:        {name: "MOD", ty: IR_TY_REG_REG},
 	IR_NEG:        {name: "NEG", ty: IR_TY_REG},
 	IR_MOV:        {name: "MOV", ty: IR_TY_REG_REG},
 	IR_MUL:        {name: "MUL", ty: IR_TY_BINARY},
 	IR_NOP:        {name: "NOP", ty: IR_TY_NOARG},
+	IR_ASM:        {name: "ASM", ty: IR_TY_NOARG},
+	IR_ZERO:       {name: "ZERO", ty: IR_TY_REG_IMM},
 	IR_RETURN:     {name: "RET", ty: IR_TY_REG},
 	IR_STORE:      {name: "STORE", ty: IR_TY_MEM},
 	IR_STORE_ARG:  {name: "STORE_ARG", ty: IR_TY_STORE_ARG},
 	IR_SUB:        {name: "SUB", ty: IR_TY_BINARY},
 	IR_BPREL:      {name: "BPREL", ty: IR_TY_REG_IMM},
+	IR_UDIV:       {name: "UDIV", ty: IR_TY_REG_REG},
+	IR_UMOD:       {name: "UMOD", ty: IR_TY_REG_REG},
+	IR_SAR:        {name: "SAR", ty: IR_TY_BINARY},
+	IR_ULT:        {name: "ULT", ty: IR_TY_REG_REG},
+	IR_ULE:        {name: "ULE", ty: IR_TY_REG_REG},
+	IR_SEXT:       {name: "SEXT", ty: IR_TY_REG_IMM},
+	IR_ZEXT:       {name: "ZEXT", ty: IR_TY_REG_IMM},
+	IR_FADD:       {name: "FADD", ty: IR_TY_REG_REG},
+	IR_FSUB:       {name: "FSUB", ty: IR_TY_REG_REG},
+	IR_FMUL:       {name: "FMUL", ty: IR_TY_REG_REG},
+	IR_FDIV:       {name: "FDIV", ty: IR_TY_REG_REG},
+	IR_FNEG:       {name: "FNEG", ty: IR_TY_REG},
+	IR_FEQ:        {name: "FEQ", ty: IR_TY_REG_REG},
+	IR_FNE:        {name: "FNE", ty: IR_TY_REG_REG},
+	IR_FLT:        {name: "FLT", ty: IR_TY_REG_REG},
+	IR_FLE:        {name: "FLE", ty: IR_TY_REG_REG},
+	IR_I2F:        {name: "I2F", ty: IR_TY_REG},
+	IR_F2I:        {name: "F2I", ty: IR_TY_REG},
+	IR_F2F:        {name: "F2F", ty: IR_TY_REG},
 	IR_IF:         {name: "IF", ty: IR_TY_REG_LABEL},
 	IR_UNLESS:     {name: "UNLESS", ty: IR_TY_REG_LABEL},
 	0:             {name: "", ty: 0},
@@ -70,12 +93,16 @@ func tostr(ir *IR) string {
 	case IR_TY_CALL:
 		{
 			sb := new_sb()
-			sb_append(sb, format("r%d = %s(", ir.lhs, ir.name))
+			if ir.name == "" {
+				sb_append(sb, format("r%d = *[bp-%d](", ir.lhs, ir.rhs))
+			} else {
+				sb_append(sb, format("r%d = %s(", ir.lhs, ir.name))
+			}
 			for i := 0; i < ir.nargs; i++ {
 				if i != 0 {
 					sb_append(sb, ", ")
 				}
-				sb_append(sb, format("r%d", ir.args[i]))
+				sb_append(sb, format("[bp-%d]", ir.args[i]))
 			}
 			sb_append(sb, ")\n")
 			return sb_get(sb)
@@ -84,7 +111,6 @@ func tostr(ir *IR) string {
 		//asset(info.ty == IR_TY_NOARG)
 		return format("\t%s", info.name)
 	}
-	return ""
 }
 
 func Dump_ir(irv *Vector) {
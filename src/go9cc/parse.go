@@ -8,18 +8,32 @@ package go9cc
 // `1+2=3`, are accepted by this parser, but that's intentional.
 // Semantic errors are detected in a later pass.
 
+import "strings"
+
 var (
-	pos        = 0
-	penv       *PEnv
-	tokens     *Vector
-	int_ty     = Type{ty: INT, size: 4, align: 4}
-	null_stmt  = Node{op: ND_NULL}
-	break_stmt = Node{op: ND_BREAK}
+	pos       = 0
+	penv      *PEnv
+	tokens    *Vector
+	int_ty    = Type{ty: INT, size: 4, align: 4}
+	null_stmt = Node{op: ND_NULL}
+
+	// The innermost switch statement, to which case labels belong.
+	cur_switch *Node
+
+	// The type specifier of a declaration whose type is inferred
+	// from its initializer (`__auto_type` or `auto`).
+	auto_ty = Type{ty: VOID}
 )
 
+// Scope of the parser. Variables are recorded with their declarations,
+// so that typeof and __auto_type can compute the types of expressions
+// before the semantic analysis. Enumerators are recorded with their
+// values.
 type PEnv struct {
 	typedefs *Map
 	tags     *Map
+	vars     *Map
+	enums    *Map
 	next     *PEnv
 }
 
@@ -27,12 +41,22 @@ func new_penv(next *PEnv) *PEnv {
 	env := new(PEnv)
 	env.typedefs = new_map()
 	env.tags = new_map()
+	env.vars = new_map()
+	env.enums = new_map()
 	env.next = next
 	return env
 }
 
+func add_pvar(node *Node) {
+	map_put(penv.vars, node.name, node)
+}
+
+// A variable hides a typedef of the same name in an outer scope.
 func find_typedef(name string) *Type {
 	for e := penv; e != nil; e = e.next {
+		if map_get(e.vars, name) != nil {
+			return nil
+		}
 		ty := map_get(e.typedefs, name)
 		if ty != nil {
 			return ty.(*Type)
@@ -41,6 +65,21 @@ func find_typedef(name string) *Type {
 	return nil
 }
 
+// A variable hides an enumerator of the same name in an outer scope
+// and vice versa.
+func find_enum(name string) (int, bool) {
+	for e := penv; e != nil; e = e.next {
+		if map_get(e.vars, name) != nil {
+			return 0, false
+		}
+		val := map_get(e.enums, name)
+		if val != nil {
+			return val.(int), true
+		}
+	}
+	return 0, false
+}
+
 func find_tag(name string) *Type {
 	for e := penv; e != nil; e = e.next {
 		ty := map_get(e.tags, name)
@@ -58,6 +97,18 @@ func expect(ty int) {
 		return
 	}
 
+	// A missing semicolon is reported after the previous token
+	// with a fix-it, and parsing goes on as if it were there.
+	if ty == ';' && pos > 0 {
+		prev := tokens.data[pos-1].(*Token)
+		loc := token_loc(prev)
+		loc.pos, loc.start = loc.end, loc.end
+		d := new_diag(SEV_ERROR, loc, "; expected")
+		set_fixit(d, loc, ";")
+		report(d)
+		return
+	}
+
 	if isprint(uint8(ty)) {
 		bad_token(t, format("%c expected", ty))
 	}
@@ -74,9 +125,86 @@ func new_prim_ty(ty, size int) *Type {
 	return ret
 }
 
-func void_tyf() *Type { return new_prim_ty(VOID, 0) }
-func char_tyf() *Type { return new_prim_ty(CHAR, 1) }
-func int_tyf() *Type  { return new_prim_ty(INT, 4) }
+func void_tyf() *Type   { return new_prim_ty(VOID, 0) }
+func char_tyf() *Type   { return new_prim_ty(CHAR, 1) }
+func short_tyf() *Type  { return new_prim_ty(SHORT, 2) }
+func int_tyf() *Type    { return new_prim_ty(INT, 4) }
+func long_tyf() *Type   { return new_prim_ty(LONG, 8) }
+func float_tyf() *Type  { return new_prim_ty(FLOAT, 4) }
+func double_tyf() *Type { return new_prim_ty(DOUBLE, 8) }
+func bool_tyf() *Type   { return unsigned_of(new_prim_ty(BOOL, 1)) }
+
+func unsigned_of(ty *Type) *Type {
+	ty.is_unsigned = true
+	return ty
+}
+
+func is_integer(ty *Type) bool {
+	switch ty.ty {
+	case BOOL, CHAR, SHORT, INT, LONG:
+		return true
+	}
+	return false
+}
+
+func is_flonum(ty *Type) bool {
+	return ty.ty == FLOAT || ty.ty == DOUBLE
+}
+
+func is_arith(ty *Type) bool {
+	return is_integer(ty) || is_flonum(ty)
+}
+
+// Returns a copy of a type with additional qualifiers.
+func qualify(ty *Type, qual int) *Type {
+	if qual == 0 || ty.qual|qual == ty.qual {
+		return ty
+	}
+	q := *ty
+	q.qual |= qual
+	if ty.origin == nil {
+		q.origin = ty
+	}
+	return &q
+}
+
+// Returns the unqualified version of a type.
+func unqual(ty *Type) *Type {
+	if ty.qual == 0 {
+		return ty
+	}
+	return ty.origin
+}
+
+func new_member(ty *Type, name string) *Node {
+	node := new(Node)
+	node.op = ND_VARDEF
+	node.ty = ty
+	node.name = name
+	return node
+}
+
+// __builtin_va_list is an array of one struct as defined by the
+// System V x86-64 ABI.
+//
+//	typedef struct {
+//	  unsigned int gp_offset;
+//	  unsigned int fp_offset;
+//	  void *overflow_arg_area;
+//	  void *reg_save_area;
+//	} __builtin_va_list[1];
+func va_list_tyf() *Type {
+	members := new_vec()
+	vec_push(members, new_member(int_tyf(), "gp_offset"))
+	vec_push(members, new_member(int_tyf(), "fp_offset"))
+	vec_push(members, new_member(ptr_to(void_tyf()), "overflow_arg_area"))
+	vec_push(members, new_member(ptr_to(void_tyf()), "reg_save_area"))
+
+	ty := new(Type)
+	ty.ty = STRUCT
+	add_members(ty, members, false)
+	return ary_of(ty, 1)
+}
 
 func consume(ty int) bool {
 	t := tokens.data[pos].(*Token)
@@ -93,119 +221,832 @@ func is_typename() bool {
 		ret := find_typedef(t.name)
 		return ret != nil
 	}
-	return t.ty == TK_INT || t.ty == TK_CHAR || t.ty == TK_VOID || t.ty == TK_STRUCT
+	switch t.ty {
+	case TK_VOID, TK_BOOL, TK_CHAR, TK_SHORT, TK_INT, TK_LONG, TK_FLOAT,
+		TK_DOUBLE, TK_SIGNED, TK_UNSIGNED, TK_STRUCT, TK_UNION, TK_ENUM, TK_TYPEOF, TK_UNQUAL,
+		TK_AUTO, TK_ALIGNAS:
+		return true
+	}
+	return is_qualifier(t.ty) || is_storage_class(t.ty) || is_attribute()
 }
 
-func add_members(ty *Type, members *Vector) {
-	off := 0
+func is_storage_class(ty int) bool {
+	switch ty {
+	case TK_TYPEDEF, TK_EXTERN, TK_STATIC, TK_REGISTER, TK_INLINE, TK_NORETURN, TK_THREAD:
+		return true
+	}
+	return false
+}
+
+func is_qualifier(ty int) bool {
+	switch ty {
+	case TK_CONST, TK_VOLATILE, TK_RESTRICT, TK_ATOMIC:
+		return true
+	}
+	return false
+}
+
+// Reads a sequence of type qualifiers.
+func qualifiers() int {
+	qual := 0
+	for {
+		switch {
+		case consume(TK_CONST):
+			qual |= QUAL_CONST
+		case consume(TK_VOLATILE):
+			qual |= QUAL_VOLATILE
+		case consume(TK_RESTRICT):
+			qual |= QUAL_RESTRICT
+		case consume(TK_ATOMIC):
+			qual |= QUAL_ATOMIC
+		default:
+			return qual
+		}
+	}
+}
+
+// Reads the parenthesized operand of typeof or typeof_unqual, which
+// is either a type name or an expression. The expression is not
+// evaluated.
+func typeof_specifier(is_unqual bool) *Type {
+	expect('(')
+	var ty *Type
+	if is_typename() {
+		ty = type_name()
+	} else {
+		ty = expr_type(expr(), false)
+	}
+	expect(')')
+	if is_unqual {
+		return unqual(ty)
+	}
+	return ty
+}
+
+// Members are laid out as in the System V x86-64 ABI. A bit-field
+// is packed into the preceding storage units unless it would
+// straddle a boundary of its declared type, in which case it starts
+// at the next one. A zero-width bit-field moves the next member to
+// such a boundary. Unnamed bit-fields do not affect the alignment of
+// the struct. All members of a union are at offset 0.
+//
+// In a packed struct, or for a packed member, the members other than
+// bit-fields are aligned only by _Alignas or the aligned attribute.
+func add_members(ty *Type, members *Vector, packed bool) {
+	if ty.align == 0 {
+		ty.align = 1
+	}
+
+	bits := 0
+	size := 0
 	for i := 0; i < members.len; i++ {
 		node := members.data[i].(*Node)
 		//assert(node.op == ND_VARDEF)
 
 		t := node.ty
-		off = roundup(off, t.align)
-		t.offset = off
-		off += t.size
+		if ty.is_union {
+			bits = 0
+		}
+
+		align := var_align(node)
+		if !node.is_bitfield && (packed || node.attrs != nil && node.attrs.packed) {
+			align = node.align
+			if align == 0 {
+				align = 1
+			}
+		}
+
+		if node.is_bitfield {
+			unit := t.size * 8
+			if node.bit_width == 0 || bits/unit != (bits+node.bit_width-1)/unit {
+				bits = roundup(bits, unit)
+			}
+			node.offset = bits / unit * t.size
+			node.bit_offset = bits - node.offset*8
+			bits += node.bit_width
+		} else {
+			bits = roundup(bits, align*8)
+			node.offset = bits / 8
+			bits += t.size * 8
+		}
 
-		if ty.align < node.ty.align {
-			ty.align = node.ty.align
+		if size < (bits+7)/8 {
+			size = (bits + 7) / 8
+		}
+		if node.name != "" && ty.align < align {
+			ty.align = align
 		}
 	}
 
 	ty.members = members
-	ty.size = roundup(off, ty.align)
+	ty.size = roundup(size, ty.align)
 }
 
-func decl_specifiers() *Type {
+// Attributes of the struct may follow the keyword or the closing
+// brace. Only packed and aligned have effects.
+func struct_specifier(is_union bool) *Type {
+	attrs := new(Attrs)
+	attributes(attrs)
+
+	var tag string
 	t := tokens.data[pos].(*Token)
-	pos++
+	if t.ty == TK_IDENT {
+		pos++
+		tag = t.name
+	}
+
+	var members *Vector
+	if consume('{') {
+		members = new_vec()
+		for !consume('}') {
+			if consume(TK_SASSERT) {
+				static_assert_decl()
+				continue
+			}
+			struct_decl(members)
+		}
+		attributes(attrs)
+	}
+
+	if tag == "" && members == nil {
+		bad_token(t, "bad struct definition")
+	}
+
+	// A tag refers to the same type until it is redefined in an
+	// inner scope, so that a forward declaration is completed in
+	// place by its definition.
+	var ty *Type
+	if tag != "" && members == nil {
+		ty = find_tag(tag)
+	} else if tag != "" {
+		if cur := map_get(penv.tags, tag); cur != nil && cur.(*Type).members == nil {
+			ty = cur.(*Type)
+		}
+	}
+	if ty != nil && (ty.ty != STRUCT || ty.is_union != is_union) {
+		bad_token(t, format("'%s' defined as wrong kind of tag", tag))
+	}
+
+	if ty == nil {
+		ty = new(Type)
+		ty.ty = STRUCT
+		ty.is_union = is_union
+		if tag != "" {
+			map_put(penv.tags, tag, ty)
+		}
+	}
+
+	if members != nil {
+		add_members(ty, members, attrs.packed)
+		if ty.align < attrs.aligned {
+			ty.align = attrs.aligned
+			ty.size = roundup(ty.size, ty.align)
+		}
+	}
+	return ty
+}
 
+// Enumerators are constants of type int. The parser replaces them
+// with their values, so later passes never see them.
+func enum_specifier() *Type {
+	t := tokens.data[pos].(*Token)
+	tag := ""
 	if t.ty == TK_IDENT {
-		ty := find_typedef(t.name)
+		pos++
+		tag = t.name
+	}
+
+	if !consume('{') {
+		if tag == "" {
+			bad_token(t, "bad enum definition")
+		}
+		ty := find_tag(tag)
 		if ty == nil {
-			pos--
+			bad_token(t, format("unknown enum: %s", tag))
+		}
+		if ty.ty == STRUCT {
+			bad_token(t, format("'%s' defined as wrong kind of tag", tag))
 		}
 		return ty
 	}
 
-	if t.ty == TK_INT {
-		return int_tyf()
+	val := 0
+	for !consume('}') {
+		name := ident()
+		if consume('=') {
+			val = const_expr()
+		}
+		map_puti(penv.enums, name, val)
+		val++
+		if !consume(',') {
+			expect('}')
+			break
+		}
 	}
 
-	if t.ty == TK_CHAR {
-		return char_tyf()
+	ty := int_tyf()
+	if tag != "" {
+		map_put(penv.tags, tag, ty)
 	}
+	return ty
+}
+
+// Type specifiers may appear in any order (e.g. `long unsigned int`
+// is the same as `unsigned long`), so each keyword is counted and
+// the combination is looked up at the end. The counts are kept in
+// separate bit fields of a single integer.
+const (
+	SPEC_VOID     = 1 << 0
+	SPEC_CHAR     = 1 << 2
+	SPEC_SHORT    = 1 << 4
+	SPEC_INT      = 1 << 6
+	SPEC_LONG     = 1 << 8
+	SPEC_FLOAT    = 1 << 10
+	SPEC_DOUBLE   = 1 << 11
+	SPEC_OTHER    = 1 << 12
+	SPEC_SIGNED   = 1 << 13
+	SPEC_UNSIGNED = 1 << 14
+	SPEC_BOOL     = 1 << 15
+)
+
+// Storage-class, function and alignment specifiers of a declaration.
+type DeclAttr struct {
+	is_typedef  bool
+	is_extern   bool
+	is_static   bool
+	is_inline   bool
+	is_noreturn bool
+	is_tls      bool
+	align       int // The largest _Alignas, 0 if none
+	attrs       Attrs
+}
+
+// Reads declaration specifiers. Storage-class, function and alignment
+// specifiers and attributes are stored to attr, which is nil where
+// they are not allowed, such as in type names. Attributes are read
+// but dropped there.
+func decl_specifiers(attr *DeclAttr) *Type {
+	start := tokens.data[pos].(*Token)
+	var ty *Type
+	spec := 0
+	qual := 0
+	is_auto := false
 
-	if t.ty == TK_VOID {
-		return void_tyf()
+	// __extension__ only suppresses pedantic warnings in gcc.
+	for consume(TK_EXTENSION) {
 	}
 
-	if t.ty == TK_STRUCT {
-		var tag string
+	for is_typename() {
 		t := tokens.data[pos].(*Token)
-		if t.ty == TK_IDENT {
+
+		if is_storage_class(t.ty) {
 			pos++
-			tag = t.name
+			if attr == nil {
+				bad_token(t, "storage class specifier is not allowed here")
+			}
+			switch t.ty {
+			case TK_TYPEDEF, TK_EXTERN, TK_STATIC:
+				if attr.is_typedef || attr.is_extern || attr.is_static {
+					bad_token(t, "multiple storage classes in declaration specifiers")
+				}
+			}
+			switch t.ty {
+			case TK_TYPEDEF:
+				attr.is_typedef = true
+			case TK_EXTERN:
+				attr.is_extern = true
+			case TK_STATIC:
+				attr.is_static = true
+			case TK_INLINE:
+				attr.is_inline = true
+			case TK_NORETURN:
+				attr.is_noreturn = true
+			case TK_THREAD:
+				attr.is_tls = true
+			}
+			continue
 		}
 
-		var members *Vector
-		if consume('{') {
-			members = new_vec()
-			for !consume('}') {
-				vec_push(members, declaration())
+		if is_attribute() {
+			if attr == nil {
+				attributes(new(Attrs))
+			} else {
+				attributes(&attr.attrs)
 			}
+			continue
 		}
 
-		if tag == "" && members == nil {
-			bad_token(t, "bad struct definition")
+		if t.ty == TK_ALIGNAS {
+			pos++
+			if attr == nil {
+				bad_token(t, "_Alignas is not allowed here")
+			}
+			if align := alignas_specifier(); attr.align < align {
+				attr.align = align
+			}
+			continue
 		}
 
-		var ty *Type
-		if tag != "" && members == nil {
-			ty = find_tag(tag)
+		// _Atomic followed by a parenthesized type name is a type
+		// specifier. Otherwise it is a qualifier.
+		if t.ty == TK_ATOMIC && tokens.data[pos+1].(*Token).ty == '(' {
+			if spec != 0 {
+				bad_token(t, "invalid type")
+			}
+			pos += 2
+			ty = type_name()
+			expect(')')
+			qual |= QUAL_ATOMIC
+			spec = SPEC_OTHER
+			continue
+		}
+		if is_qualifier(t.ty) {
+			qual |= qualifiers()
+			continue
 		}
 
-		if ty == nil {
-			ty = new(Type)
-			ty.ty = STRUCT
+		// "auto" alone infers the type from the initializer. With
+		// other type specifiers, it is the storage class, which
+		// changes nothing.
+		if t.ty == TK_AUTO {
+			pos++
+			is_auto = true
+			continue
 		}
 
-		if members != nil {
-			add_members(ty, members)
-			if tag != "" {
-				map_put(penv.tags, tag, ty)
+		// A typedef name, a struct or typeof cannot be combined with
+		// other type specifiers. An identifier after them is the
+		// name being declared, even if it is also a typedef name.
+		if t.ty == TK_IDENT || t.ty == TK_STRUCT || t.ty == TK_UNION ||
+			t.ty == TK_ENUM || t.ty == TK_TYPEOF || t.ty == TK_UNQUAL {
+			if spec != 0 {
+				break
 			}
+			pos++
+			switch t.ty {
+			case TK_IDENT:
+				ty = find_typedef(t.name)
+			case TK_STRUCT, TK_UNION:
+				ty = struct_specifier(t.ty == TK_UNION)
+			case TK_ENUM:
+				ty = enum_specifier()
+			default:
+				ty = typeof_specifier(t.ty == TK_UNQUAL)
+			}
+			spec = SPEC_OTHER
+			continue
+		}
+
+		pos++
+		switch t.ty {
+		case TK_VOID:
+			spec += SPEC_VOID
+		case TK_BOOL:
+			spec += SPEC_BOOL
+		case TK_CHAR:
+			spec += SPEC_CHAR
+		case TK_SHORT:
+			spec += SPEC_SHORT
+		case TK_INT:
+			spec += SPEC_INT
+		case TK_LONG:
+			spec += SPEC_LONG
+		case TK_FLOAT:
+			spec += SPEC_FLOAT
+		case TK_DOUBLE:
+			spec += SPEC_DOUBLE
+		case TK_SIGNED:
+			spec |= SPEC_SIGNED
+		case TK_UNSIGNED:
+			spec |= SPEC_UNSIGNED
+		}
+
+		switch spec {
+		case SPEC_VOID:
+			ty = void_tyf()
+		case SPEC_BOOL:
+			ty = bool_tyf()
+		case SPEC_CHAR, SPEC_SIGNED + SPEC_CHAR:
+			ty = char_tyf()
+		case SPEC_UNSIGNED + SPEC_CHAR:
+			ty = unsigned_of(char_tyf())
+		case SPEC_SHORT, SPEC_SHORT + SPEC_INT,
+			SPEC_SIGNED + SPEC_SHORT, SPEC_SIGNED + SPEC_SHORT + SPEC_INT:
+			ty = short_tyf()
+		case SPEC_UNSIGNED + SPEC_SHORT, SPEC_UNSIGNED + SPEC_SHORT + SPEC_INT:
+			ty = unsigned_of(short_tyf())
+		case SPEC_INT, SPEC_SIGNED, SPEC_SIGNED + SPEC_INT:
+			ty = int_tyf()
+		case SPEC_UNSIGNED, SPEC_UNSIGNED + SPEC_INT:
+			ty = unsigned_of(int_tyf())
+		case SPEC_LONG, SPEC_LONG + SPEC_INT, SPEC_LONG + SPEC_LONG,
+			SPEC_LONG + SPEC_LONG + SPEC_INT,
+			SPEC_SIGNED + SPEC_LONG, SPEC_SIGNED + SPEC_LONG + SPEC_INT,
+			SPEC_SIGNED + SPEC_LONG + SPEC_LONG,
+			SPEC_SIGNED + SPEC_LONG + SPEC_LONG + SPEC_INT:
+			ty = long_tyf()
+		case SPEC_UNSIGNED + SPEC_LONG, SPEC_UNSIGNED + SPEC_LONG + SPEC_INT,
+			SPEC_UNSIGNED + SPEC_LONG + SPEC_LONG,
+			SPEC_UNSIGNED + SPEC_LONG + SPEC_LONG + SPEC_INT:
+			ty = unsigned_of(long_tyf())
+		case SPEC_FLOAT:
+			ty = float_tyf()
+		case SPEC_DOUBLE, SPEC_LONG + SPEC_DOUBLE:
+			// long double is the same as double.
+			ty = double_tyf()
+		default:
+			bad_token(t, "invalid type")
 		}
-		return ty
 	}
 
-	bad_token(t, "typename expected")
-	return nil
+	if ty == nil && is_auto {
+		return &auto_ty
+	}
+	if ty == nil {
+		bad_token(start, "typename expected")
+	}
+	return qualify(ty, qual)
+}
+
+// Reads the operand of _Alignas, which is a type name or a constant
+// expression, and returns the alignment. _Alignas(0) has no effect.
+func alignas_specifier() int {
+	expect('(')
+	if is_typename() {
+		ty := type_name()
+		expect(')')
+		return ty.align
+	}
+	align := alignment()
+	expect(')')
+	return align
+}
+
+func alignment() int {
+	t := tokens.data[pos].(*Token)
+	align := const_expr()
+	if align < 0 || align&(align-1) != 0 {
+		bad_token(t, "requested alignment is not a positive power of 2")
+	}
+	return align
+}
+
+// Applies _Alignas to a declared variable or member, which cannot be
+// aligned less strictly than its type. The aligned attribute is
+// ignored if it is less strict.
+func set_align(node *Node, attr *DeclAttr) {
+	if attr.align != 0 {
+		if node.ty.ty == FUNC {
+			bad_node(node, format("alignment specified for function '%s'", node.name))
+		}
+		if attr.align < node.ty.align {
+			bad_node(node, format("'_Alignas' specifiers cannot reduce alignment of '%s'", node.name))
+		}
+		node.align = attr.align
+	}
+	if node.align < attr.attrs.aligned {
+		node.align = attr.attrs.aligned
+	}
+}
+
+// Attributes that are accepted without any effect.
+var ignored_attrs = map[string]bool{
+	"access": true, "alloc_size": true, "always_inline": true,
+	"artificial": true, "cold": true, "const": true, "deprecated": true,
+	"fallthrough": true, "gnu_inline": true, "hot": true, "leaf": true,
+	"malloc": true, "may_alias": true, "nodiscard": true, "noinline": true,
+	"nonnull": true, "nothrow": true, "pure": true, "returns_nonnull": true,
+	"returns_twice": true, "sentinel": true, "warn_unused_result": true,
+}
+
+// `__attribute__` or `[[`
+func is_attribute() bool {
+	t := tokens.data[pos].(*Token)
+	if t.ty == TK_ATTRIBUTE {
+		return true
+	}
+	return t.ty == '[' && tokens.data[pos+1].(*Token).ty == '['
+}
+
+// Reads a sequence of GNU attributes `__attribute__((a, b(1)))` and
+// C23 attributes `[[a, gnu::b(1)]]`.
+func attributes(attrs *Attrs) {
+	for {
+		if consume(TK_ATTRIBUTE) {
+			expect('(')
+			expect('(')
+			attribute_list(attrs)
+			expect(')')
+			expect(')')
+		} else if is_attribute() {
+			pos += 2
+			attribute_list(attrs)
+			expect(']')
+			expect(']')
+		} else {
+			return
+		}
+	}
 }
 
-func new_binop(op int, lhs, rhs *Node) *Node {
+// Skips attributes without checking them.
+func skip_attributes() {
+	for is_attribute() {
+		if consume(TK_ATTRIBUTE) {
+			skip_parens()
+			continue
+		}
+		depth := 0
+		for {
+			t := tokens.data[pos].(*Token)
+			pos++
+			if t.ty == '[' {
+				depth++
+			} else if t.ty == ']' {
+				depth--
+			} else if t.ty == TK_EOF {
+				bad_token(t, "unclosed bracket")
+			}
+			if depth == 0 {
+				break
+			}
+		}
+	}
+}
+
+// Attributes are separated by commas, which may be repeated.
+func attribute_list(attrs *Attrs) {
+	for {
+		t := tokens.data[pos].(*Token)
+		if t.ty == ')' || t.ty == ']' {
+			return
+		}
+		if t.ty != ',' {
+			attribute(attrs)
+		}
+		if !consume(',') {
+			return
+		}
+	}
+}
+
+// Reads an attribute, which is an identifier or a keyword, optionally
+// with the "gnu" namespace, followed by its arguments. A name may be
+// surrounded by double underscores (e.g. `__packed__`).
+func attribute(attrs *Attrs) {
+	t := tokens.data[pos].(*Token)
+	if t.name == "" {
+		bad_token(t, "attribute name expected")
+	}
+	pos++
+	name := t.name
+	if consume(':') {
+		expect(':')
+		t = tokens.data[pos].(*Token)
+		if t.name == "" {
+			bad_token(t, "attribute name expected")
+		}
+		pos++
+		if name != "gnu" && name != "__gnu__" {
+			warn_token(W_ATTRIBUTES, t, format("'%s::%s' scoped attribute directive ignored", name, t.name))
+			if tokens.data[pos].(*Token).ty == '(' {
+				skip_parens()
+			}
+			return
+		}
+		name = t.name
+	}
+	if len(name) > 4 && strings.HasPrefix(name, "__") && strings.HasSuffix(name, "__") {
+		name = name[2 : len(name)-2]
+	}
+
+	switch name {
+	case "packed":
+		attrs.packed = true
+	case "aligned":
+		// The largest alignment ever used on the target
+		attrs.aligned = 16
+		if consume('(') {
+			attrs.aligned = alignment()
+			expect(')')
+		}
+	case "section":
+		attrs.section = string_arg()
+	case "visibility":
+		t := tokens.data[pos+1].(*Token)
+		switch v := string_arg(); v {
+		case "default":
+			attrs.visibility = ""
+		case "hidden", "protected", "internal":
+			attrs.visibility = v
+		default:
+			bad_token(t, "attribute 'visibility' argument must be one of 'default', 'hidden', 'protected' or 'internal'")
+		}
+	case "weak":
+		attrs.is_weak = true
+	case "noreturn", "_Noreturn":
+		attrs.noreturn = true
+	case "unused", "maybe_unused", "used":
+		attrs.unused = true
+	case "constructor":
+		attrs.constructor = priority()
+	case "destructor":
+		attrs.destructor = priority()
+	case "format":
+		format_attr(attrs)
+	default:
+		if !ignored_attrs[name] {
+			warn_token(W_ATTRIBUTES, t, format("'%s' attribute directive ignored", name))
+		}
+		if tokens.data[pos].(*Token).ty == '(' {
+			skip_parens()
+		}
+	}
+}
+
+// Reads `("string")`.
+func string_arg() string {
+	expect('(')
+	t := tokens.data[pos].(*Token)
+	if t.ty != TK_STR {
+		bad_token(t, "string literal expected")
+	}
+	pos++
+	expect(')')
+	return t.str
+}
+
+// Reads the optional priority of a constructor or destructor.
+func priority() int {
+	if !consume('(') {
+		return 65535
+	}
+	t := tokens.data[pos].(*Token)
+	prio := const_expr()
+	if prio < 0 || prio > 65535 {
+		bad_token(t, "priorities must be integers from 0 to 65535")
+	}
+	expect(')')
+	return prio
+}
+
+// Reads the arguments of `format(archetype, fmt_idx, fmt_first)`.
+// Only printf formats are checked.
+func format_attr(attrs *Attrs) {
+	expect('(')
+	t := tokens.data[pos].(*Token)
+	kind := ident()
+	expect(',')
+	t2 := tokens.data[pos].(*Token)
+	idx := const_expr()
+	expect(',')
+	first := const_expr()
+	expect(')')
+
+	if idx <= 0 || first < 0 {
+		bad_token(t2, "format string argument index out of range")
+	}
+	if first != 0 && first <= idx {
+		bad_token(t2, "format string argument follows the arguments to be formatted")
+	}
+	switch strings.Trim(kind, "_") {
+	case "printf", "gnu_printf":
+		attrs.fmt_idx = idx
+		attrs.fmt_first = first
+	case "scanf", "gnu_scanf", "strftime", "gnu_strftime", "strfmon":
+	default:
+		warn_token(W_FORMAT, t, format("'%s' is an unrecognized format function type", kind))
+	}
+}
+
+// Reads the attributes after a declarator, which apply to it in
+// addition to those in the declaration specifiers. Returns the
+// specifiers with them for the declarator.
+func declarator_attrs(node *Node, attr *DeclAttr) *DeclAttr {
+	a := *attr
+	if node.attrs != nil {
+		a.attrs = *merge_attrs(&a.attrs, node.attrs)
+	}
+	attributes(&a.attrs)
+	if a.attrs != (Attrs{}) {
+		node.attrs = &a.attrs
+	}
+
+	// Constructors and destructors are used by the startup code.
+	if a.attrs.unused || a.attrs.constructor != 0 || a.attrs.destructor != 0 {
+		node.used = true
+	}
+
+	// The noreturn attribute is the same as _Noreturn for a
+	// function, but is not an error for others.
+	is_fn := node.ty.ty == FUNC
+	if a.attrs.noreturn && is_fn {
+		a.is_noreturn = true
+	}
+	for _, x := range []struct {
+		name string
+		on   bool
+	}{
+		{"noreturn", a.attrs.noreturn},
+		{"constructor", a.attrs.constructor != 0},
+		{"destructor", a.attrs.destructor != 0},
+		{"format", a.attrs.fmt_idx != 0},
+	} {
+		if x.on && !is_fn {
+			warn_node(W_ATTRIBUTES, node, format("'%s' attribute ignored", x.name))
+		}
+	}
+	return &a
+}
+
+func new_node(op int, t *Token) *Node {
 	node := new(Node)
 	node.op = op
+	node.tok = t
+	return node
+}
+
+func new_binop(op int, lhs, rhs *Node, t *Token) *Node {
+	node := new_node(op, t)
 	node.lhs = lhs
 	node.rhs = rhs
 	return node
 }
 
-func new_expr(op int, expr *Node) *Node {
-	node := new(Node)
-	node.op = op
+func new_expr(op int, expr *Node, t *Token) *Node {
+	node := new_node(op, t)
 	node.expr = expr
 	return node
 }
 
-func new_num(val int) *Node {
-	node := new(Node)
-	node.op = ND_NUM
+func new_num(val int, t *Token) *Node {
+	node := new_node(ND_NUM, t)
 	node.ty = int_tyf()
 	node.val = val
 	return node
 }
 
+// A floating-point literal is a double unless it has an 'f' suffix.
+//
+// The type of an integer literal is the first of int, long and
+// their unsigned versions that can represent the value. Unsigned
+// types are candidates only for hexadecimal and octal literals or
+// for literals with a 'u' suffix.
+func num_literal(t *Token) *Node {
+	if t.is_float {
+		node := new_node(ND_NUM, t)
+		node.fval = t.fval
+		node.ty = double_tyf()
+		if t.is_single {
+			node.ty = float_tyf()
+		}
+		return node
+	}
+
+	node := new_num(t.val, t)
+	val := uint64(t.val)
+
+	var ty *Type
+	switch {
+	case !t.is_long && !t.is_unsigned && val <= 0x7fffffff:
+		ty = int_tyf()
+	case !t.is_long && !t.is_decimal && val <= 0xffffffff,
+		!t.is_long && t.is_unsigned && val <= 0xffffffff:
+		ty = unsigned_of(int_tyf())
+	case !t.is_unsigned && val <= 0x7fffffffffffffff:
+		ty = long_tyf()
+	default:
+		ty = unsigned_of(long_tyf())
+	}
+	node.ty = ty
+	return node
+}
+
+// Reads `_Generic(expr, type: expr, ..., default: expr)`. Each
+// association is a node with the type, or nil for default, and the
+// expression. Sema selects one by the type of the controlling
+// expression.
+func generic_selection(node *Node) *Node {
+	node.op = ND_GENERIC
+	node.args = new_vec()
+	expect('(')
+	node.expr = assign()
+	for consume(',') {
+		assoc := new_node(0, tokens.data[pos].(*Token))
+		if !consume(TK_DEFAULT) {
+			assoc.ty = type_name()
+		}
+		expect(':')
+		assoc.expr = assign()
+		vec_push(node.args, assoc)
+	}
+	if node.args.len == 0 {
+		expect(',')
+	}
+	expect(')')
+	return node
+}
+
 func ident() string {
 	t := tokens.data[pos].(*Token)
 	pos++
@@ -221,8 +1062,7 @@ func primary() *Node {
 
 	if t.ty == '(' {
 		if consume('{') {
-			node := new(Node)
-			node.op = ND_STMT_EXPR
+			node := new_node(ND_STMT_EXPR, t)
 			node.body = compound_stmt()
 			expect(')')
 			return node
@@ -232,9 +1072,22 @@ func primary() *Node {
 		return node
 	}
 
-	node := new(Node)
+	node := new_node(0, t)
 	if t.ty == TK_NUM {
-		return new_num(t.val)
+		return num_literal(t)
+	}
+
+	if t.ty == TK_TRUE || t.ty == TK_FALSE {
+		node := new_num(0, t)
+		if t.ty == TK_TRUE {
+			node.val = 1
+		}
+		node.ty = bool_tyf()
+		return node
+	}
+
+	if t.ty == TK_GENERIC {
+		return generic_selection(node)
 	}
 
 	if t.ty == TK_STR {
@@ -248,22 +1101,20 @@ func primary() *Node {
 	if t.ty == TK_IDENT {
 		node.name = t.name
 
+		if is_builtin(t.name) {
+			return builtin(t)
+		}
+
 		if !consume('(') {
+			if val, ok := find_enum(t.name); ok {
+				return new_num(val, t)
+			}
 			node.op = ND_IDENT
 			return node
 		}
 
 		node.op = ND_CALL
-		node.args = new_vec()
-		if consume(')') {
-			return node
-		}
-
-		vec_push(node.args, assign())
-		for consume(',') {
-			vec_push(node.args, assign())
-		}
-		expect(')')
+		node.args = func_args()
 		return node
 	}
 
@@ -271,154 +1122,282 @@ func primary() *Node {
 	return nil
 }
 
+// Reads function call arguments. The opening '(' has already
+// been consumed.
+func func_args() *Vector {
+	args := new_vec()
+	if consume(')') {
+		return args
+	}
+
+	vec_push(args, assign())
+	for consume(',') {
+		vec_push(args, assign())
+	}
+	expect(')')
+	return args
+}
+
+func is_builtin(name string) bool {
+	switch name {
+	case "__builtin_va_start", "__builtin_va_arg", "__builtin_va_copy", "__builtin_va_end",
+		"__builtin_offsetof":
+		return true
+	}
+	return false
+}
+
+// Builtin functions of <stdarg.h>. They look like function calls
+// but va_arg takes a type name as its second argument, so they are
+// parsed as special forms.
+func builtin(t *Token) *Node {
+	node := new_node(0, t)
+	expect('(')
+
+	switch t.name {
+	case "__builtin_va_start":
+		node.op = ND_VA_START
+		node.expr = assign()
+		expect(',')
+		node.rhs = assign()
+	case "__builtin_va_arg":
+		node.op = ND_VA_ARG
+		node.expr = assign()
+		expect(',')
+		node.ty = type_name()
+	case "__builtin_va_copy":
+		node.op = ND_VA_COPY
+		node.lhs = assign()
+		expect(',')
+		node.rhs = assign()
+	case "__builtin_offsetof":
+		ty := type_name()
+		expect(',')
+		node = new_num(member_offset(ty), t)
+		node.ty = unsigned_of(long_tyf())
+	default:
+		// assert(name == "__builtin_va_end")
+		node.op = ND_VA_END
+		node.expr = assign()
+	}
+	expect(')')
+	return node
+}
+
+func find_member(ty *Type, name string) *Node {
+	for i := 0; i < ty.members.len; i++ {
+		m := ty.members.data[i].(*Node)
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
+// Reads the member designator of offsetof, such as `a.b[2]`, and
+// returns its offset in the type.
+func member_offset(ty *Type) int {
+	off := 0
+	for {
+		t := tokens.data[pos].(*Token)
+		ty = unqual(ty)
+		if ty.ty != STRUCT || ty.members == nil {
+			bad_token(t, "offsetof on a type other than a complete struct or union")
+		}
+		m := find_member(ty, ident())
+		if m == nil {
+			bad_token(t, "member missing")
+		}
+		if m.is_bitfield {
+			bad_token(t, "cannot apply offsetof to a bit-field")
+		}
+		off += m.offset
+		ty = m.ty
+
+		for consume('[') {
+			if ty.ty != ARY {
+				bad_token(t, "subscripted value is not an array")
+			}
+			off += const_expr() * ty.ary_of.size
+			ty = ty.ary_of
+			expect(']')
+		}
+		if !consume('.') {
+			return off
+		}
+	}
+}
+
 func postfix() *Node {
 	lhs := primary()
 
 	for {
+		t := tokens.data[pos].(*Token)
 		if consume(TK_INC) {
-			lhs = new_expr(ND_POST_INC, lhs)
+			lhs = new_expr(ND_POST_INC, lhs, t)
 			continue
 		}
 
 		if consume(TK_DEC) {
-			lhs = new_expr(ND_POST_DEC, lhs)
+			lhs = new_expr(ND_POST_DEC, lhs, t)
 			continue
 		}
 
+		// A member access points to the member name.
 		if consume('.') {
-			lhs = new_expr(ND_DOT, lhs)
+			lhs = new_expr(ND_DOT, lhs, tokens.data[pos].(*Token))
 			lhs.name = ident()
 			continue
 		}
 
 		if consume(TK_ARROW) {
-			lhs = new_expr(ND_DOT, new_expr(ND_DEREF, lhs))
+			lhs = new_expr(ND_DOT, new_expr(ND_DEREF, lhs, t), tokens.data[pos].(*Token))
 			lhs.name = ident()
 			continue
 		}
 
 		if consume('[') {
-			lhs = new_expr(ND_DEREF, new_binop('+', lhs, assign()))
+			lhs = new_expr(ND_DEREF, new_binop('+', lhs, assign(), t), t)
 			expect(']')
 			continue
 		}
+
+		// Call through a function pointer
+		if consume('(') {
+			lhs = new_expr(ND_CALL, lhs, t)
+			lhs.args = func_args()
+			continue
+		}
 		return lhs
 	}
-	return nil
+}
+
+// Parses "sizeof" or "_Alignof" followed by a parenthesized type
+// name or a unary expression. For a type name, the operand type is
+// kept in ty and expr is nil.
+func sizeof_operand(op int, t *Token) *Node {
+	if consume('(') {
+		if is_typename() {
+			node := new_expr(op, nil, t)
+			node.ty = type_name()
+			expect(')')
+			return node
+		}
+		pos--
+	}
+	return new_expr(op, unary(), t)
 }
 
 func unary() *Node {
+	t := tokens.data[pos].(*Token)
 	if consume('-') {
-		return new_expr(ND_NEG, unary())
+		return new_expr(ND_NEG, cast(), t)
 	}
 	if consume('*') {
-		return new_expr(ND_DEREF, unary())
+		return new_expr(ND_DEREF, cast(), t)
 	}
 	if consume('&') {
-		return new_expr(ND_ADDR, unary())
+		return new_expr(ND_ADDR, cast(), t)
 	}
 	if consume('!') {
-		return new_expr('!', unary())
+		return new_expr('!', cast(), t)
 	}
 	if consume('~') {
-		return new_expr('~', unary())
+		return new_expr('~', cast(), t)
 	}
 	if consume(TK_SIZEOF) {
-		return new_expr(ND_SIZEOF, unary())
+		return sizeof_operand(ND_SIZEOF, t)
 	}
 	if consume(TK_ALIGNOF) {
-		return new_expr(ND_ALIGNOF, unary())
+		return sizeof_operand(ND_ALIGNOF, t)
+	}
+	if consume(TK_EXTENSION) {
+		return cast()
 	}
 
 	if consume(TK_INC) {
-		return new_binop(ND_ADD_EQ, unary(), new_num(1))
+		return new_binop(ND_ADD_EQ, unary(), new_num(1, t), t)
 	}
 	if consume(TK_DEC) {
-		return new_binop(ND_SUB_EQ, unary(), new_num(1))
+		return new_binop(ND_SUB_EQ, unary(), new_num(1, t), t)
 	}
 
 	return postfix()
 }
 
+// A parenthesized type name followed by an expression is a cast.
+// Otherwise the parenthesis starts a primary expression.
+func cast() *Node {
+	t := tokens.data[pos].(*Token)
+	if consume('(') {
+		if is_typename() {
+			ty := type_name()
+			expect(')')
+			node := new_expr(ND_CAST, cast(), t)
+			node.ty = ty
+			return node
+		}
+		pos--
+	}
+	return unary()
+}
+
 func mul() *Node {
-	lhs := unary()
+	lhs := cast()
 	for {
+		t := tokens.data[pos].(*Token)
 		if consume('*') {
-			lhs = new_binop('*', lhs, unary())
+			lhs = new_binop('*', lhs, cast(), t)
 		} else if consume('/') {
-			lhs = new_binop('/', lhs, unary())
+			lhs = new_binop('/', lhs, cast(), t)
 		} else if consume('%') {
-			lhs = new_binop('%', lhs, unary())
+			lhs = new_binop('%', lhs, cast(), t)
 		} else {
 			return lhs
 		}
 	}
-	return lhs
-}
-
-func read_array(ty *Type) *Type {
-	v := new_vec()
-
-	for consume('[') {
-		if consume(']') {
-			vec_push(v, -1)
-			continue
-		}
-
-		t := tokens.data[pos].(*Token)
-		l := expr()
-		if l.op != ND_NUM {
-			bad_token(t, "number expected")
-		}
-		vec_push(v, l.val)
-		expect(']')
-	}
-	for i := v.len - 1; i >= 0; i-- {
-		l := v.data[i].(int)
-		ty = ary_of(ty, l)
-	}
-	return ty
 }
 
 func parse_add() *Node {
 	lhs := mul()
 	for {
+		t := tokens.data[pos].(*Token)
 		if consume('+') {
-			lhs = new_binop('+', lhs, mul())
+			lhs = new_binop('+', lhs, mul(), t)
 		} else if consume('-') {
-			lhs = new_binop('-', lhs, mul())
+			lhs = new_binop('-', lhs, mul(), t)
 		} else {
 			return lhs
 		}
 	}
-	return lhs
 }
 
 func shift() *Node {
 	lhs := parse_add()
 	for {
+		t := tokens.data[pos].(*Token)
 		if consume(TK_SHL) {
-			lhs = new_binop(ND_SHL, lhs, parse_add())
+			lhs = new_binop(ND_SHL, lhs, parse_add(), t)
 		} else if consume(TK_SHR) {
-			lhs = new_binop(ND_SHR, lhs, parse_add())
+			lhs = new_binop(ND_SHR, lhs, parse_add(), t)
 		} else {
 			return lhs
 		}
 	}
-	return lhs
 }
 
 func relational() *Node {
 	lhs := shift()
 	for {
+		t := tokens.data[pos].(*Token)
 		if consume('<') {
-			lhs = new_binop('<', lhs, shift())
+			lhs = new_binop('<', lhs, shift(), t)
 		} else if consume('>') {
-			lhs = new_binop('<', shift(), lhs)
+			lhs = new_binop('<', shift(), lhs, t)
 		} else if consume(TK_LE) {
-			lhs = new_binop(ND_LE, lhs, shift())
+			lhs = new_binop(ND_LE, lhs, shift(), t)
 		} else if consume(TK_GE) {
-			lhs = new_binop(ND_LE, shift(), lhs)
+			lhs = new_binop(ND_LE, shift(), lhs, t)
 		} else {
 			return lhs
 		}
@@ -428,10 +1407,11 @@ func relational() *Node {
 func equality() *Node {
 	lhs := relational()
 	for {
+		t := tokens.data[pos].(*Token)
 		if consume(TK_EQ) {
-			lhs = new_binop(ND_EQ, lhs, relational())
+			lhs = new_binop(ND_EQ, lhs, relational(), t)
 		} else if consume(TK_NE) {
-			lhs = new_binop(ND_NE, lhs, relational())
+			lhs = new_binop(ND_NE, lhs, relational(), t)
 		} else {
 			return lhs
 		}
@@ -440,59 +1420,85 @@ func equality() *Node {
 
 func bit_and() *Node {
 	lhs := equality()
-	for consume('&') {
-		lhs = new_binop('&', lhs, equality())
+	for {
+		t := tokens.data[pos].(*Token)
+		if !consume('&') {
+			return lhs
+		}
+		lhs = new_binop('&', lhs, equality(), t)
 	}
-	return lhs
 }
 
 func bit_xor() *Node {
 	lhs := bit_and()
-	for consume('^') {
-		lhs = new_binop('^', lhs, bit_and())
+	for {
+		t := tokens.data[pos].(*Token)
+		if !consume('^') {
+			return lhs
+		}
+		lhs = new_binop('^', lhs, bit_and(), t)
 	}
-	return lhs
 }
 
 func bit_or() *Node {
 	lhs := bit_xor()
-	for consume('|') {
-		lhs = new_binop('|', lhs, bit_xor())
+	for {
+		t := tokens.data[pos].(*Token)
+		if !consume('|') {
+			return lhs
+		}
+		lhs = new_binop('|', lhs, bit_xor(), t)
 	}
-	return lhs
 }
 
 func logand() *Node {
 	lhs := bit_or()
-	for consume(TK_LOGAND) {
-		lhs = new_binop(ND_LOGAND, lhs, bit_or())
+	for {
+		t := tokens.data[pos].(*Token)
+		if !consume(TK_LOGAND) {
+			return lhs
+		}
+		lhs = new_binop(ND_LOGAND, lhs, bit_or(), t)
 	}
-	return lhs
 }
 
 func logor() *Node {
 	lhs := logand()
-	for consume(TK_LOGOR) {
-		lhs = new_binop(ND_LOGOR, lhs, logand())
+	for {
+		t := tokens.data[pos].(*Token)
+		if !consume(TK_LOGOR) {
+			return lhs
+		}
+		lhs = new_binop(ND_LOGOR, lhs, logand(), t)
 	}
-	return lhs
 }
 
 func conditional() *Node {
 	cond := logor()
+	t := tokens.data[pos].(*Token)
 	if !consume('?') {
 		return cond
 	}
 
-	node := new(Node)
-	node.op = '?'
-	node.cond = cond
-	node.then = expr()
-	expect(':')
+	// "a ?: b" (GNU extension) is "a ? a : b" except that a is
+	// evaluated once. It has no cond and a in then.
+	node := new_node('?', t)
+	if consume(':') {
+		node.then = cond
+	} else {
+		node.cond = cond
+		node.then = expr()
+		expect(':')
+	}
 	node.els = conditional()
 	return node
 }
 
+// Reads an integer constant expression and returns its value.
+func const_expr() int {
+	return const_value(conditional())
+}
+
 func assignment_op() int {
 	if consume('=') {
 		return '='
@@ -532,88 +1538,494 @@ func assignment_op() int {
 
 func assign() *Node {
 	lhs := conditional()
+	t := tokens.data[pos].(*Token)
 	op := assignment_op()
 	if op != 0 {
-		return new_binop(op, lhs, assign())
+		return new_binop(op, lhs, assign(), t)
 	}
 	return lhs
 }
 
 func expr() *Node {
 	lhs := assign()
+	t := tokens.data[pos].(*Token)
 	if !consume(',') {
 		return lhs
 	}
-	return new_binop(',', lhs, expr())
+	return new_binop(',', lhs, expr(), t)
 }
 
-func direct_decl(ty *Type) *Node {
+// initializer = assign | "{" (designation ("," designation)* ","?)? "}"
+func initializer() *Node {
 	t := tokens.data[pos].(*Token)
-	var node *Node
-	placeholder := new(Type)
+	if !consume('{') {
+		return assign()
+	}
 
-	if t.ty == TK_IDENT {
-		node = new(Node)
-		node.op = ND_VARDEF
-		node.ty = placeholder
+	node := new_node(ND_INIT_LIST, t)
+	node.stmts = new_vec()
+	for !consume('}') {
+		vec_push(node.stmts, designation())
+		if !consume(',') {
+			expect('}')
+			break
+		}
+	}
+	return node
+}
+
+func designation() *Node {
+	t := tokens.data[pos].(*Token)
+	if t.ty != '[' && t.ty != '.' {
+		return initializer()
+	}
+	return designator()
+}
+
+// designator = ("[" conditional "]" | "." ident) (designator | "=" initializer)
+//
+// A designator list such as `.a[1].b = x` becomes a chain of
+// ND_DESIG nodes whose last expr is the initializer.
+func designator() *Node {
+	node := new_node(ND_DESIG, tokens.data[pos].(*Token))
+	if consume('[') {
+		node.lhs = conditional()
+		expect(']')
+	} else {
+		expect('.')
 		node.name = ident()
-	} else if consume('(') {
-		node = declarator(placeholder)
+	}
+
+	t := tokens.data[pos].(*Token)
+	if t.ty == '[' || t.ty == '.' {
+		node.expr = designator()
+		return node
+	}
+	expect('=')
+	node.expr = initializer()
+	return node
+}
+
+// Skips tokens up to and including the ')' that matches
+// the '(' at the current position.
+func skip_parens() {
+	depth := 0
+	for {
+		t := tokens.data[pos].(*Token)
+		pos++
+		switch t.ty {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return
+			}
+		case TK_EOF:
+			bad_token(t, "unclosed parenthesis")
+		}
+	}
+}
+
+// In an abstract declarator, '(' may start either a nested
+// declarator (e.g. `int (*)(void)`) or a parameter list
+// (e.g. `int (int)`).
+func is_nested_declarator() bool {
+	t := tokens.data[pos+1].(*Token)
+	if t.ty == '*' || t.ty == '(' || t.ty == TK_ATTRIBUTE {
+		return true
+	}
+	return t.ty == TK_IDENT && find_typedef(t.name) == nil
+}
+
+func param_list(ty *Type) *Type {
+	fn := new(Type)
+	fn.ty = FUNC
+	fn.returning = ty
+	fn.params = new_vec()
+
+	if consume(')') {
+		fn.no_proto = true
+		return fn
+	}
+
+	t := tokens.data[pos].(*Token)
+	t2 := tokens.data[pos+1].(*Token)
+	if t.ty == TK_VOID && t2.ty == ')' {
+		pos += 2
+		return fn
+	}
+
+	for {
+		if consume(TK_ELLIPSIS) {
+			fn.is_variadic = true
+			expect(')')
+			return fn
+		}
+		vec_push(fn.params, param_declaration())
+		if consume(')') {
+			return fn
+		}
+		expect(',')
+	}
+}
+
+// Reads the second half of a declarator, i.e. a parameter list
+// or array dimensions (e.g. `(int, char *)` or `[3][5]`).
+func type_suffix(ty *Type) *Type {
+	if consume('(') {
+		return param_list(ty)
+	}
+
+	if !consume('[') {
+		return ty
+	}
+
+	l := -1
+	if !consume(']') {
+		t := tokens.data[pos].(*Token)
+		l = const_expr()
+		if l < 0 {
+			bad_token(t, "size of array is negative")
+		}
+		expect(']')
+	}
+	return ary_of(type_suffix(ty), l)
+}
+
+// The identifier is optional, so this also reads abstract
+// declarators. The resulting node has an empty name in that case.
+func direct_decl(ty *Type) *Node {
+	t := tokens.data[pos].(*Token)
+
+	if t.ty == '(' && is_nested_declarator() {
+		// The suffix after the parentheses applies to the type
+		// the nested declarator is built on (e.g. in `int (*x)[3]`
+		// x is a pointer to an array), so read it first.
+		start := pos + 1
+		skip_parens()
+		ty = type_suffix(ty)
+		end := pos
+
+		pos = start
+		node := declarator(ty)
 		expect(')')
-	} else {
-		bad_token(t, "bad direct-declarator")
+		pos = end
+		return node
 	}
 
-	// Read the second half of type file (e.g. `[3][5]`).
-	*placeholder = *read_array(ty)
+	node := new_node(ND_VARDEF, t)
+	if t.ty == TK_IDENT {
+		node.name = t.name
+		pos++
+	}
 
-	// Read an initializer.
-	if consume('=') {
-		node.init = assign()
+	// C23 attributes after the identifier apply to the declarator.
+	if is_attribute() {
+		node.attrs = new(Attrs)
+		attributes(node.attrs)
 	}
+	node.ty = type_suffix(ty)
 	return node
 }
 
+// Attributes inside a declarator are dropped.
 func declarator(ty *Type) *Node {
+	attributes(new(Attrs))
 	for consume('*') {
-		ty = ptr_to(ty)
+		ty = qualify(ptr_to(ty), qualifiers())
+		attributes(new(Attrs))
 	}
 	return direct_decl(ty)
 }
 
-func declaration() *Node {
-	ty := decl_specifiers()
+func named_declarator(ty *Type) *Node {
+	t := tokens.data[pos].(*Token)
 	node := declarator(ty)
-	expect(';')
+	if node.name == "" {
+		bad_token(t, "identifier expected")
+	}
+	return node
+}
+
+// Declares a variable whose type is inferred from its initializer.
+// Arrays and functions in the initializer decay to pointers.
+func auto_declarator() *Node {
+	node := new_node(ND_VARDEF, tokens.data[pos].(*Token))
+	node.name = ident()
+	t := tokens.data[pos].(*Token)
+	if !consume('=') {
+		bad_token(t, "initializer expected for a variable with an inferred type")
+	}
+	t = tokens.data[pos].(*Token)
+	if t.ty == '{' {
+		bad_token(t, "braced initializer cannot infer a type")
+	}
+	node.init = assign()
+	node.ty = unqual(expr_type(node.init, true))
+	add_pvar(node)
+	return node
+}
+
+// Reads a declarator in a block. A function or an extern variable
+// becomes an ND_DECL, which refers to a global.
+func init_declarator(ty *Type, attr *DeclAttr) *Node {
+	var node *Node
+	if ty == &auto_ty {
+		node = auto_declarator()
+	} else {
+		node = named_declarator(ty)
+		add_pvar(node)
+		attr = declarator_attrs(node, attr)
+	}
+	node.is_static = attr.is_static
+	node.is_tls = attr.is_tls
+	check_noreturn(node, attr)
+	set_align(node, attr)
+
+	if node.ty.ty == FUNC || attr.is_extern {
+		node.op = ND_DECL
+		node.args = node.ty.params
+		node.is_extern = attr.is_extern
+		node.is_noreturn = attr.is_noreturn
+		if node.init != nil || tokens.data[pos].(*Token).ty == '=' {
+			bad_token(tokens.data[pos].(*Token), "extern declaration cannot have an initializer")
+		}
+		return node
+	}
+	if attr.is_tls && !attr.is_static {
+		bad_token(tokens.data[pos].(*Token), "a thread-local variable in a block must be static or extern")
+	}
+	if node.init == nil && consume('=') {
+		node.init = initializer()
+	}
 	return node
 }
 
+// Reads a local declaration. A declaration with more than one
+// declarator (e.g. `int a, *b = &a;`) becomes an ND_DECL_LIST.
+func declaration() *Node {
+	attr := new(DeclAttr)
+	ty := decl_specifiers(attr)
+	if attr.is_typedef {
+		typedef_decl(ty, attr)
+		return &null_stmt
+	}
+	if consume(';') {
+		return &null_stmt
+	}
+
+	node := init_declarator(ty, attr)
+	if consume(';') {
+		return node
+	}
+
+	list := new_node(ND_DECL_LIST, node.tok)
+	list.stmts = new_vec()
+	vec_push(list.stmts, node)
+	for consume(',') {
+		vec_push(list.stmts, init_declarator(ty, attr))
+	}
+	expect(';')
+	return list
+}
+
+// Reads declarators of a typedef. The `typedef` keyword
+// has already been read with the type. Attributes of a typedef name
+// are not supported.
+func typedef_decl(ty *Type, attr *DeclAttr) {
+	for {
+		node := named_declarator(ty)
+		a := declarator_attrs(node, attr)
+		if a.attrs.packed || a.attrs.aligned != 0 {
+			warn_node(W_ATTRIBUTES, node, format("attributes of typedef '%s' ignored", node.name))
+		}
+		map_put(penv.typedefs, node.name, node.ty)
+		if !consume(',') {
+			break
+		}
+	}
+	expect(';')
+}
+
+// Only _Alignas is allowed in the specifiers of a member.
+func struct_decl(members *Vector) {
+	start := tokens.data[pos].(*Token)
+	attr := new(DeclAttr)
+	ty := decl_specifiers(attr)
+	if attr.is_typedef || attr.is_extern || attr.is_static || attr.is_inline || attr.is_noreturn || attr.is_tls {
+		bad_token(start, "storage class specified for a member")
+	}
+	for {
+		t := tokens.data[pos].(*Token)
+		node := declarator(ty)
+		if consume(':') {
+			if attr.align != 0 {
+				bad_token(t, "alignment specified for a bit-field")
+			}
+			bitfield(node, t)
+		} else if node.name == "" {
+			bad_token(t, "identifier expected")
+		}
+		set_align(node, declarator_attrs(node, attr))
+		vec_push(members, node)
+		if !consume(',') {
+			break
+		}
+	}
+	expect(';')
+}
+
+// Reads the width of a bit-field. The name of a bit-field is
+// optional; an unnamed one is padding.
+func bitfield(node *Node, t *Token) {
+	ty := node.ty
+	if !is_integer(ty) {
+		bad_token(t, "bit-field has invalid type")
+	}
+
+	t2 := tokens.data[pos].(*Token)
+	width := const_expr()
+	max := ty.size * 8
+	if ty.ty == BOOL {
+		max = 1
+	}
+	if width < 0 {
+		bad_token(t2, "negative width in bit-field")
+	}
+	if width > max {
+		bad_token(t2, "width of bit-field exceeds its type")
+	}
+	if width == 0 && node.name != "" {
+		bad_token(t2, "zero width for bit-field")
+	}
+	node.is_bitfield = true
+	node.bit_width = width
+}
+
+func type_name() *Type {
+	ty := decl_specifiers(nil)
+	t := tokens.data[pos].(*Token)
+	node := declarator(ty)
+	if node.name != "" {
+		bad_token(t, "unexpected identifier in type name")
+	}
+	return node.ty
+}
+
+// Only "register" is allowed as a storage class of a parameter.
 func param_declaration() *Node {
-	ty := decl_specifiers()
+	t := tokens.data[pos].(*Token)
+	attr := new(DeclAttr)
+	ty := decl_specifiers(attr)
+	if attr.is_typedef || attr.is_extern || attr.is_static || attr.is_inline || attr.is_noreturn || attr.is_tls {
+		bad_token(t, "invalid storage class for a parameter")
+	}
+	if attr.align != 0 {
+		bad_token(t, "alignment specified for a parameter")
+	}
 	node := declarator(ty)
+	declarator_attrs(node, attr)
 	if node.ty.ty == ARY {
 		node.ty = ptr_to(node.ty.ary_of)
+	} else if node.ty.ty == FUNC {
+		node.ty = ptr_to(node.ty)
 	}
 	return node
 }
 
 func expr_stmt() *Node {
-	node := new_expr(ND_EXPR_STMT, expr())
+	t := tokens.data[pos].(*Token)
+	node := new_expr(ND_EXPR_STMT, expr(), t)
 	expect(';')
 	return node
 }
 
-func stmt() *Node {
-	node := new(Node)
+// Reads a statement. After a syntax error, the tokens up to the end
+// of the statement are skipped and a null statement is returned, so
+// that the following statements are still checked.
+func stmt() (node *Node) {
+	orig_penv, orig_switch, start := penv, cur_switch, pos
+	defer func() {
+		if r := recover(); r != nil {
+			recovered(r)
+			penv, cur_switch = orig_penv, orig_switch
+			sync_stmt(start, false)
+			// An error at the end of the file is left to toplevel.
+			if tokens.data[pos].(*Token).ty == TK_EOF {
+				panic(r)
+			}
+			node = &null_stmt
+		}
+	}()
+	return stmt_body()
+}
+
+// Skips the statement or declaration that starts at tokens[start]
+// after an error. It ends at a ';' or with a block, from the last
+// token read on. An unmatched '}' ends the enclosing block, so it is
+// left unread unless the statement is at file scope.
+//
+// An initializer list cannot contain a ';', so a ';' within one
+// ends the statement even if the braces are not closed.
+func sync_stmt(start int, at_top bool) {
+	last := pos - 1
+	depth := 0
+	var is_init []bool // Whether each open brace begins an initializer
+	for i := start; ; i++ {
+		t := tokens.data[i].(*Token)
+		switch t.ty {
+		case TK_EOF:
+			pos = i
+			return
+		case '{':
+			init := false
+			if i > start {
+				switch tokens.data[i-1].(*Token).ty {
+				case '=':
+					init = true
+				case '{', ',':
+					init = depth > 0 && is_init[depth-1]
+				}
+			}
+			is_init = append(is_init, init)
+			depth++
+		case '}':
+			depth--
+			if depth >= 0 {
+				is_init = is_init[:depth]
+			}
+			if depth < 0 {
+				pos = i
+				if at_top {
+					pos++
+				}
+				return
+			}
+			if depth == 0 && i >= last {
+				// The ';' after a struct body ends its declaration.
+				pos = i + 1
+				if tokens.data[pos].(*Token).ty == ';' {
+					pos++
+				}
+				return
+			}
+		case ';':
+			if (depth == 0 || is_init[depth-1]) && i >= last {
+				pos = i + 1
+				return
+			}
+		}
+	}
+}
+
+// Reads a statement without recovering from errors.
+func stmt_body() *Node {
 	t := tokens.data[pos].(*Token)
+	node := new_node(0, t)
 	pos++
 
 	switch t.ty {
-	case TK_TYPEDEF:
-		node := declaration()
-		// assert(node.file)
-		map_put(penv.typedefs, node.name, node.ty)
-		return &null_stmt
 	case TK_IF:
 		node.op = ND_IF
 		expect('(')
@@ -630,6 +2042,7 @@ func stmt() *Node {
 		node.op = ND_FOR
 		expect('(')
 
+		penv = new_penv(penv)
 		if is_typename() {
 			node.init = declaration()
 		} else if consume(';') {
@@ -643,12 +2056,13 @@ func stmt() *Node {
 			expect(';')
 		}
 
-		if !consume(')') {
-			node.inc = new_expr(ND_EXPR_STMT, expr())
+		if t := tokens.data[pos].(*Token); !consume(')') {
+			node.inc = new_expr(ND_EXPR_STMT, expr(), t)
 			expect(')')
 		}
 
 		node.body = stmt()
+		penv = penv.next
 		return node
 	case TK_WHILE:
 		node.op = ND_FOR
@@ -668,126 +2082,266 @@ func stmt() *Node {
 		expect(')')
 		expect(';')
 		return node
+	case TK_SWITCH:
+		node.op = ND_SWITCH
+		node.cases = new_vec()
+		expect('(')
+		node.cond = expr()
+		expect(')')
+
+		orig := cur_switch
+		cur_switch = node
+		node.body = stmt()
+		cur_switch = orig
+		return node
+	case TK_CASE, TK_DEFAULT:
+		if cur_switch == nil {
+			bad_token(t, "case label not within a switch statement")
+		}
+		node.op = ND_CASE
+		if t.ty == TK_CASE {
+			node.val = const_expr()
+			node.case_end = node.val
+			if consume(TK_ELLIPSIS) {
+				node.case_end = const_expr()
+			}
+			vec_push(cur_switch.cases, node)
+		} else {
+			if cur_switch.default_case != nil {
+				bad_token(t, "multiple default labels in one switch")
+			}
+			cur_switch.default_case = node
+		}
+		expect(':')
+		node.body = stmt()
+		return node
 	case TK_BREAK:
-		return &break_stmt
+		node.op = ND_BREAK
+		expect(';')
+		return node
+	case TK_CONTINUE:
+		node.op = ND_CONTINUE
+		expect(';')
+		return node
+	case TK_SASSERT:
+		static_assert_decl()
+		return &null_stmt
+	case TK_ASM:
+		return asm_stmt(node)
+	case TK_EXTENSION:
+		return stmt_body()
 	case TK_RETURN:
 		node.op = ND_RETURN
 		node.expr = expr()
 		expect(';')
 		return node
 	case '{':
-		node.op = ND_COMP_STMT
-		node.stmts = new_vec()
-		for !consume('}') {
-			vec_push(node.stmts, stmt())
-		}
-		return node
+		return compound_stmt()
 	case ';':
 		return &null_stmt
 	default:
 		pos--
+		if is_attribute() && !is_attributed_decl() {
+			// Attributes of a statement, such as fallthrough,
+			// have no effect.
+			attributes(new(Attrs))
+			if consume(';') {
+				return &null_stmt
+			}
+			return stmt_body()
+		}
 		if is_typename() {
 			return declaration()
 		}
 		return expr_stmt()
 	}
-	return nil
 }
 
-func compound_stmt() *Node {
+// Looks ahead whether attributes start a declaration.
+func is_attributed_decl() bool {
+	start := pos
+	skip_attributes()
+	ret := is_typename()
+	pos = start
+	return ret
+}
 
-	node := new(Node)
-	node.op = ND_COMP_STMT
+// The '{' has already been read.
+func compound_stmt() *Node {
+	node := new_node(ND_COMP_STMT, tokens.data[pos-1].(*Token))
 	node.stmts = new_vec()
 
 	penv = new_penv(penv)
 	for !consume('}') {
+		if t := tokens.data[pos].(*Token); t.ty == TK_EOF {
+			bad_token(t, "} expected")
+		}
 		vec_push(node.stmts, stmt())
 	}
+	node.end = tokens.data[pos-1].(*Token)
 	penv = penv.next
 	return node
 }
 
-func toplevel() *Node {
-	is_typedef := consume(TK_TYPEDEF)
-	is_extern := consume(TK_EXTERN)
+// Reads a declarator at file scope. The initializer of a global
+// variable is read later, unless its type is inferred from it.
+func toplevel_declarator(ty *Type) *Node {
+	if ty == &auto_ty {
+		return auto_declarator()
+	}
+	node := named_declarator(ty)
+	add_pvar(node)
+	return node
+}
 
-	ty := decl_specifiers()
-	for consume('*') {
-		ty = ptr_to(ty)
+// Reads `_Static_assert(expr, "message");` or `static_assert`. The
+// message is optional as in C23. The keyword has already been read.
+func static_assert_decl() {
+	expect('(')
+	t := tokens.data[pos].(*Token)
+	val := const_expr()
+	var msg *Token
+	if consume(',') {
+		msg = tokens.data[pos].(*Token)
+		if msg.ty != TK_STR {
+			bad_token(msg, "string literal expected")
+		}
+		pos++
+	}
+	expect(')')
+	expect(';')
+	if val == 0 && msg != nil {
+		bad_token(t, format("static assertion failed: %s", msg.str))
 	}
+	if val == 0 {
+		bad_token(t, "static assertion failed")
+	}
+}
 
-	name := ident()
+// Reads a basic asm statement `asm volatile ("...");`, whose string
+// is emitted to the assembly as is. The keyword has already been read.
+func asm_stmt(node *Node) *Node {
+	for consume(TK_VOLATILE) || consume(TK_INLINE) {
+	}
+	expect('(')
+	t := tokens.data[pos].(*Token)
+	if t.ty != TK_STR {
+		bad_token(t, "string literal expected")
+	}
+	pos++
+	if t2 := tokens.data[pos].(*Token); t2.ty == ':' {
+		bad_token(t2, "extended asm is not supported")
+	}
+	expect(')')
+	expect(';')
+	node.op = ND_ASM
+	node.data = t.str
+	return node
+}
 
-	// Function
-	if consume('(') {
-		node := new(Node)
-		node.name = name
-		node.args = new_vec()
-
-		node.ty = new(Type)
-		node.ty.ty = FUNC
-		node.ty.returning = ty
-
-		if !consume(')') {
-			vec_push(node.args, param_declaration())
-			for consume(',') {
-				vec_push(node.args, param_declaration())
-			}
-			expect(')')
+// Reads a declaration or a function definition at file scope,
+// skipping it after an error.
+func toplevel(v *Vector) {
+	orig_penv, start := penv, pos
+	defer func() {
+		if r := recover(); r != nil {
+			recovered(r)
+			penv, cur_switch = orig_penv, nil
+			sync_stmt(start, true)
 		}
+	}()
+	external_decl(v)
+}
 
-		if consume(';') {
-			node.op = ND_DECL
-			return node
-		}
+// Reads a declaration or a function definition at file scope without
+// recovering from errors.
+func external_decl(v *Vector) {
+	if consume(TK_SASSERT) {
+		static_assert_decl()
+		return
+	}
+
+	attr := new(DeclAttr)
+	ty := decl_specifiers(attr)
+	if attr.is_typedef {
+		typedef_decl(ty, attr)
+		return
+	}
+	if consume(';') {
+		return
+	}
 
+	node := toplevel_declarator(ty)
+	a := declarator_attrs(node, attr)
+	check_noreturn(node, a)
+
+	// Function definition
+	if node.ty.ty == FUNC && consume('{') {
 		node.op = ND_FUNC
-		t := tokens.data[pos].(*Token)
-		expect('{')
-		if is_typedef {
-			bad_token(t, "typedef has function definition")
+		node.is_static = a.is_static
+		node.is_extern = a.is_extern
+		node.is_inline = a.is_inline
+		node.is_noreturn = a.is_noreturn
+		node.args = node.ty.params
+
+		penv = new_penv(penv)
+		for i := 0; i < node.args.len; i++ {
+			param := node.args.data[i].(*Node)
+			add_pvar(param)
 		}
 		node.body = compound_stmt()
-		return node
+		penv = penv.next
+
+		vec_push(v, node)
+		return
 	}
 
-	ty = read_array(ty)
-	expect(';')
+	for {
+		node.is_static = a.is_static
+		node.is_extern = a.is_extern
+		if node.ty.ty == FUNC {
+			node.op = ND_DECL
+			node.args = node.ty.params
+			node.is_inline = a.is_inline
+			node.is_noreturn = a.is_noreturn
+		} else {
+			// Global variable
+			node.is_tls = a.is_tls
+			set_align(node, a)
+			if node.init == nil && consume('=') {
+				node.init = initializer()
+			}
+		}
+		vec_push(v, node)
 
-	if is_typedef {
-		map_put(penv.typedefs, name, ty)
-		return nil
+		if !consume(',') {
+			break
+		}
+		node = toplevel_declarator(ty)
+		a = declarator_attrs(node, attr)
+		check_noreturn(node, a)
 	}
+	expect(';')
+}
 
-	// Global variable
-	node := new(Node)
-	node.op = ND_VARDEF
-	node.ty = ty
-	node.name = name
-	node.is_extern = is_extern
-
-	if !is_extern {
-		node.data = ""
-		node.len = node.ty.size
+// _Noreturn is a function specifier.
+func check_noreturn(node *Node, attr *DeclAttr) {
+	if attr.is_noreturn && node.ty.ty != FUNC {
+		bad_node(node, format("variable '%s' declared '_Noreturn'", node.name))
 	}
-	return node
 }
 
 func Parse(tokens_ *Vector) *Vector {
 	tokens = tokens_
 	pos = 0
 	penv = new_penv(penv)
+	map_put(penv.typedefs, "__builtin_va_list", va_list_tyf())
 
 	v := new_vec()
-	for {
-		t := tokens.data[pos].(*Token)
-		if t.ty == TK_EOF {
-			return v
+	guard(func() {
+		for tokens.data[pos].(*Token).ty != TK_EOF {
+			toplevel(v)
 		}
-		node := toplevel()
-		if node != nil {
-			vec_push(v, node)
-		}
-	}
+	})
+	return v
 }
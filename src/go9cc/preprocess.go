@@ -2,8 +2,37 @@ package go9cc
 
 // C preprocessor
 
+import (
+	"os"
+	"path/filepath"
+)
+
 var (
 	macros *Map
+
+	// Directories searched for included files, those given by -I
+	// first.
+	include_paths     []string
+	sys_include_paths = []string{"/usr/local/include", "/usr/include/x86_64-linux-gnu", "/usr/include"}
+
+	// Headers provided by the compiler itself. They are looked up by
+	// `#include <name>` before the file system.
+	builtin_headers = map[string]string{
+		"stdarg.h": `
+typedef __builtin_va_list va_list;
+#define va_start(ap, last) __builtin_va_start(ap, last)
+#define va_arg(ap, ty) __builtin_va_arg(ap, ty)
+#define va_end(ap) __builtin_va_end(ap)
+#define va_copy(dest, src) __builtin_va_copy(dest, src)
+#define __va_copy(dest, src) __builtin_va_copy(dest, src)
+`,
+		"stddef.h": `
+typedef unsigned long size_t;
+typedef long ptrdiff_t;
+#define NULL ((void *)0)
+#define offsetof(type, member) __builtin_offsetof(type, member)
+`,
+	}
 )
 
 const (
@@ -138,10 +167,10 @@ func replace_params(m *Macro) {
 	v := new_vec()
 	for i := 0; i < tokens.len; i++ {
 		t1 := tokens.data[i].(*Token)
-		t2 := tokens.data[i+1]
 
-		if i != tokens.len-1 && t1.ty == '#' && t2.(*Token).ty == TK_PARAM {
-			t2.(*Token).stringize = true
+		if i != tokens.len-1 && t1.ty == '#' && tokens.data[i+1].(*Token).ty == TK_PARAM {
+			t2 := tokens.data[i+1].(*Token)
+			t2.stringize = true
 			vec_push(v, t2)
 			i++
 		} else {
@@ -257,57 +286,145 @@ func (ctx_p *Context_p)objlike_macro(name string) {
 }
 
 func (ctx_p *Context_p)define() {
-	name := ctx_p.ident_p("macro file expected")
-	if ctx_p.consume_p('(') {
-		ctx_p.funclike_macro(name)
+	t := ctx_p.get(TK_IDENT, "macro name expected")
+
+	// A macro is function-like only if '(' immediately follows
+	// its name, so that `#define NULL ((void *)0)` is object-like.
+	if ctx_p.peek().ty == '(' && ctx_p.peek().start == t.end {
+		ctx_p.pos++
+		ctx_p.funclike_macro(t.name)
 		return
 	}
-	ctx_p.objlike_macro(name)
+	ctx_p.objlike_macro(t.name)
+}
+
+// Adds a directory searched for included files (-I).
+func Add_include_path(dir string) {
+	include_paths = append(include_paths, dir)
+}
+
+// Returns the path of an included file, or "" if it is not found.
+// `#include "name"` is looked up in the directory of the including
+// file and then in the current directory, before the directories
+// that are searched for `#include <name>`.
+func find_include(name, includer string, quoted bool) string {
+	exists := func(path string) bool {
+		info, err := os.Stat(path)
+		return err == nil && !info.IsDir()
+	}
+	if filepath.IsAbs(name) {
+		if exists(name) {
+			return name
+		}
+		return ""
+	}
+
+	var dirs []string
+	if quoted {
+		dirs = append(dirs, filepath.Dir(includer), ".")
+	}
+	dirs = append(dirs, include_paths...)
+	dirs = append(dirs, sys_include_paths...)
+	for _, dir := range dirs {
+		path := filepath.Join(dir, name)
+		if exists(path) {
+			return path
+		}
+	}
+	return ""
 }
 
 func (app *TokenApp) include() {
 	ctx_p := app.ctx_p
 
+	// #include <name>
+	if ctx_p.consume_p('<') {
+		start := ctx_p.peek()
+		sb := new_sb()
+		for !ctx_p.consume_p('>') {
+			t := ctx_p.next_p()
+			if t.ty == '\n' {
+				bad_token(t, "'>' expected")
+			}
+			sb_append(sb, tokstr(t))
+		}
+		name := sb_get(sb)
+		ctx_p.get('\n', "newline expected")
+
+		buf, ok := builtin_headers[name]
+		if ok {
+			ctx_p.append_p(tokenize_buf(name, buf, false, app.ctx))
+			return
+		}
+		path := find_include(name, start.ctx.path, false)
+		if path == "" {
+			bad_token(start, format("%s: No such file or directory", name))
+		}
+		ctx_p.append_p(tokenize_file(path, false, app.ctx))
+		return
+	}
+
 	t := ctx_p.get(TK_STR, "string expected")
-	path := t.str
 	ctx_p.get('\n', "newline expected")
-	ctx_p.append_p(Tokenize(path, false, app.ctx))
-}
-
-func (app *TokenApp) preprocess(tokens *Vector) *Vector {
-	if macros == nil {
-		macros = new_map()
+	path := find_include(t.str, t.ctx.path, true)
+	if path == "" {
+		bad_token(t, format("%s: No such file or directory", t.str))
 	}
-	app.ctx_p = new_ctx_p(app.ctx_p, tokens)
+	ctx_p.append_p(tokenize_file(path, false, app.ctx))
+}
 
+// Processes a token. After an error in a directive, the rest of its
+// line is skipped.
+func (app *TokenApp) preprocess_one() {
 	ctx_p := app.ctx_p
-	for !ctx_p.eof() {
-		t := ctx_p.next_p()
-
-		if t.ty == TK_IDENT {
-			m := map_get(macros, t.name)
-			if m != nil {
-				ctx_p.apply(m.(*Macro), t)
-			} else {
-				ctx_p.add_p(t)
+	directive := false
+	defer func() {
+		if r := recover(); r != nil {
+			recovered(r)
+			if directive && ctx_p.input.data[ctx_p.pos-1].(*Token).ty != '\n' {
+				ctx_p.read_until_eol()
 			}
-			continue
 		}
+	}()
+
+	t := ctx_p.next_p()
 
-		if t.ty != '#' {
+	if t.ty == TK_IDENT {
+		m := map_get(macros, t.name)
+		if m != nil {
+			ctx_p.apply(m.(*Macro), t)
+		} else {
 			ctx_p.add_p(t)
-			continue
 		}
+		return
+	}
 
-		t = ctx_p.get(TK_IDENT, "identifier expected")
+	if t.ty != '#' {
+		ctx_p.add_p(t)
+		return
+	}
 
-		if strcmp(t.name, "define") == 0 {
-			ctx_p.define()
-		} else if strcmp(t.name, "include") == 0 {
-			app.include()
-		} else {
-			bad_token(t, "unknown directive")
-		}
+	directive = true
+	t = ctx_p.get(TK_IDENT, "identifier expected")
+
+	if strcmp(t.name, "define") == 0 {
+		ctx_p.define()
+	} else if strcmp(t.name, "include") == 0 {
+		app.include()
+	} else {
+		bad_token(t, "unknown directive")
+	}
+}
+
+func (app *TokenApp) preprocess(tokens *Vector) *Vector {
+	if macros == nil {
+		macros = new_map()
+	}
+	app.ctx_p = new_ctx_p(app.ctx_p, tokens)
+
+	ctx_p := app.ctx_p
+	for !ctx_p.eof() {
+		app.preprocess_one()
 	}
 
 	v := app.ctx_p.output
@@ -13,12 +13,15 @@ package go9cc
 // registers are exhausted and need to be spilled to memory.
 
 var (
-	used       []bool
-	reg_map    [8192]int
-	reg_map_sz = len(reg_map)
+	used    []bool
+	reg_map []int // IR register -> real register, or -1 if not mapped
 )
 
 func alloc(ir_reg int) int {
+	for len(reg_map) <= ir_reg {
+		reg_map = append(reg_map, -1)
+	}
+
 	if reg_map[ir_reg] != -1 {
 		r := reg_map[ir_reg]
 		//assert("used[r])
@@ -54,9 +57,6 @@ func visit(irv *Vector) {
 			ir.rhs = alloc(ir.rhs)
 		case IR_TY_CALL:
 			ir.lhs = alloc(ir.lhs)
-			for i := 0; i < ir.nargs; i++ {
-				ir.args[i] = alloc(ir.args[i])
-			}
 		}
 
 		if ir.op == IR_KILL {
@@ -70,13 +70,12 @@ func visit(irv *Vector) {
 func Alloc_regs(fns *Vector) {
 
 	used = make([]bool, num_regs)
+	reg_map = nil
 
-	for i := 0; i < reg_map_sz; i++ {
-		reg_map[i] = -1
-	}
-
-	for i := 0; i < fns.len; i++ {
-		fn := fns.data[i].(*Function)
-		visit(fn.ir)
-	}
+	guard(func() {
+		for i := 0; i < fns.len; i++ {
+			fn := fns.data[i].(*Function)
+			visit(fn.ir)
+		}
+	})
 }
@@ -18,18 +18,34 @@ package go9cc
 // - Scales operands for pointer arithmetic. E.g. ptr+1 becomes ptr+4
 //   for integer and becomes ptr+8 for pointer.
 //
+// - Insert nodes to make implicit type conversions explicit, such as
+//   the integer promotions, the usual arithmetic conversions and
+//   conversions to the types of assignment destinations, return
+//   values and function parameters.
+//
 // - Reject bad assignments, such as `1=2+3`.
 
-import (
-	"fmt"
-	"os"
-)
+import "math"
 
 var (
 	globals   *Vector
 	stacksize int
 	str_label int
-	env       *Env
+	// Alignment of the stack frame of the current function
+	frame_align int
+	// Counter for unique names of static local variables.
+	static_label int
+	env          *Env
+	cur_fn       *Node
+
+	// Type of the value of a "return" statement.
+	ret_ty *Type
+
+	// Library functions that never return, even if they are not
+	// declared _Noreturn, as gcc knows them as builtins.
+	noreturn_funcs = map[string]bool{
+		"abort": true, "exit": true, "_exit": true, "_Exit": true, "quick_exit": true,
+	}
 )
 
 type Env struct {
@@ -54,72 +70,743 @@ func new_global(ty *Type, name, data string, len int) *Var {
 	return v
 }
 
+// Looks up a variable, which counts as a use of it.
 func find_var(name string) *Var {
 	for e := env; e != nil; e = e.next {
 		v := map_get(e.vars, name)
 		if v != nil {
+			v.(*Var).used = true
 			return v.(*Var)
 		}
 	}
 	return (*Var)(nil)
 }
 
+// Declares a variable in the current block scope. With -Wshadow, it
+// is reported if it hides a variable of an outer scope.
+func declare_local(node *Node, v *Var) {
+	v.tok = node.tok
+	v.used = node.used
+	for e := env.next; e != nil; e = e.next {
+		prev := map_get(e.vars, node.name)
+		if prev == nil {
+			continue
+		}
+		old := prev.(*Var)
+		msg := "a previous local"
+		if old.is_param {
+			msg = "a parameter"
+		} else if e.next == nil {
+			// A function is hidden by a variable all the time.
+			if old.ty.ty == FUNC {
+				break
+			}
+			msg = "a global declaration"
+		}
+		d := new_warning(W_SHADOW, node_loc(node), format("declaration of '%s' shadows %s", node.name, msg))
+		if d != nil {
+			if old.tok != nil {
+				add_note(d, token_loc(old.tok), "shadowed declaration is here")
+			}
+			report(d)
+		}
+		break
+	}
+	map_put(env.vars, node.name, v)
+}
+
+// Leaves a block scope. Its variables that have never been used are
+// reported.
+func leave_scope() {
+	vars := env.vars
+	for i := 0; i < vars.keys.len; i++ {
+		name := vars.keys.data[i].(string)
+		v := vars.vals.data[i].(*Var)
+		if v.used || v.tok == nil || name == "" {
+			continue
+		}
+		if v.is_param {
+			warn_token(W_UNUSED_PARAMETER, v.tok, format("unused parameter '%s'", name))
+		} else {
+			warn_token(W_UNUSED_VARIABLE, v.tok, format("unused variable '%s'", name))
+		}
+	}
+	env = env.next
+}
+
+// Returns a deep copy of a syntax tree.
+func clone_node(node *Node) *Node {
+	if node == nil {
+		return nil
+	}
+	c := *node
+	c.lhs = clone_node(node.lhs)
+	c.rhs = clone_node(node.rhs)
+	c.expr = clone_node(node.expr)
+	c.cond = clone_node(node.cond)
+	c.then = clone_node(node.then)
+	c.els = clone_node(node.els)
+	c.init = clone_node(node.init)
+	c.body = clone_node(node.body)
+	c.inc = clone_node(node.inc)
+	c.stmts = clone_nodes(node.stmts)
+	c.args = clone_nodes(node.args)
+	return &c
+}
+
+func clone_nodes(v *Vector) *Vector {
+	if v == nil {
+		return nil
+	}
+	ret := new_vec()
+	for i := 0; i < v.len; i++ {
+		vec_push(ret, clone_node(v.data[i].(*Node)))
+	}
+	return ret
+}
+
+// Builds the environment of this pass from a scope of the parser.
+func scope_env(e *PEnv) *Env {
+	if e == nil {
+		return nil
+	}
+	ret := new_env(scope_env(e.next))
+	for i := 0; i < e.vars.keys.len; i++ {
+		name := e.vars.keys.data[i].(string)
+		decl := e.vars.vals.data[i].(*Node)
+		map_put(ret.vars, name, new_global(decl.ty, name, "", 0))
+	}
+	return ret
+}
+
+// Marks the declarations of the variables used in an environment made
+// by scope_env, so that a variable referenced only by typeof counts
+// as used.
+func mark_used(env *Env, e *PEnv) {
+	for ; e != nil; env, e = env.next, e.next {
+		for i := 0; i < e.vars.vals.len; i++ {
+			if env.vars.vals.data[i].(*Var).used {
+				e.vars.vals.data[i].(*Node).used = true
+			}
+		}
+	}
+}
+
+// Analyzes an expression while it is being parsed. A copy of the
+// expression is analyzed in the current scope of the parser, and the
+// state of this pass is restored afterwards.
+func walk_in_parser(node *Node, decay bool) *Node {
+	orig_env, orig_globals := env, globals
+	orig_stacksize, orig_align := stacksize, frame_align
+	orig_label, orig_ret := str_label, ret_ty
+	defer func() {
+		env, globals = orig_env, orig_globals
+		stacksize, frame_align = orig_stacksize, orig_align
+		str_label, ret_ty = orig_label, orig_ret
+		quiet--
+	}()
+
+	// Warnings are reported when the tree is analyzed.
+	quiet++
+	scope := scope_env(penv)
+	env = scope
+	globals = new_vec()
+	node = walk(clone_node(node), decay)
+	mark_used(scope, penv)
+	return node
+}
+
+// Returns the type of an expression while it is being parsed, which
+// is needed for typeof and __auto_type.
+func expr_type(node *Node, decay bool) *Type {
+	return walk_in_parser(node, decay).ty
+}
+
+// Returns the value of an integer constant expression, which is
+// needed for array sizes, bit-field widths, enumerators, case labels
+// and static assertions.
+func const_value(node *Node) int {
+	node = walk_in_parser(node, true)
+	if !is_integer(node.ty) {
+		bad_node(node, "integer constant expression expected")
+	}
+	return eval_const(node)
+}
+
 func swap(p, q **Node) {
 	r := *p
 	*p = *q
 	*q = r
 }
 
+// Arrays decay to pointers to their first elements and function
+// designators to pointers to the functions.
 func maybe_decay(base *Node, decay bool) *Node {
-	if !decay || base.ty.ty != ARY {
+	if !decay {
 		return base
 	}
 
-	node := new(Node)
-	node.op = ND_ADDR
-	node.ty = ptr_to(base.ty.ary_of)
-	node.expr = base
+	node := new_expr(ND_ADDR, base, base.tok)
+	switch base.ty.ty {
+	case ARY:
+		node.ty = ptr_to(base.ty.ary_of)
+	case FUNC:
+		node.ty = ptr_to(base.ty)
+	default:
+		return base
+	}
 	return node
 }
 
 func check_lval(node *Node) {
+	// A member of a struct rvalue is not an lvalue.
+	if node.op == ND_DOT {
+		check_lval(node.expr)
+		return
+	}
 	op := node.op
 	if op != ND_LVAR && op != ND_GVAR && op != ND_DEREF && op != ND_DOT {
-		ErrorReport("not an lvalue: %d (%s)", op, node.name)
+		bad_node(node, "not an lvalue")
+	}
+}
+
+// The operand of an assignment or an increment must be a modifiable
+// lvalue.
+func check_assignable(node *Node) {
+	check_lval(node)
+	if node.ty.qual&QUAL_CONST != 0 {
+		bad_node(node, "cannot assign to const-qualified lvalue")
+	}
+	if name := const_member(node.ty); name != "" {
+		bad_node(node, format("cannot assign to a struct or union with const-qualified member '%s'", name))
+	}
+}
+
+// Returns the name of a const-qualified member of a struct or union,
+// at any depth, or "" if there is none.
+func const_member(ty *Type) string {
+	for ty.ty == ARY {
+		ty = ty.ary_of
+	}
+	if ty.ty != STRUCT || ty.members == nil {
+		return ""
+	}
+	for i := 0; i < ty.members.len; i++ {
+		m := ty.members.data[i].(*Node)
+		if is_const_obj(m.ty) {
+			return m.name
+		}
+		if name := const_member(m.ty); name != "" {
+			return name
+		}
+	}
+	return ""
+}
+
+// Two types are compatible if they are the same type. Qualifiers
+// must match and array lengths may be unknown.
+func is_compatible(t1, t2 *Type) bool {
+	if t1 == t2 {
+		return true
+	}
+	if t1.qual != t2.qual {
+		return false
+	}
+	t1, t2 = unqual(t1), unqual(t2)
+	if t1 == t2 {
+		return true
+	}
+	if t1.ty != t2.ty {
+		return false
+	}
+
+	switch t1.ty {
+	case PTR:
+		return is_compatible(t1.ptr_to, t2.ptr_to)
+	case ARY:
+		if t1.len >= 0 && t2.len >= 0 && t1.len != t2.len {
+			return false
+		}
+		return is_compatible(t1.ary_of, t2.ary_of)
+	case FUNC:
+		if !is_compatible(t1.returning, t2.returning) {
+			return false
+		}
+		if t1.no_proto || t2.no_proto {
+			return is_compatible_noproto(t1) && is_compatible_noproto(t2)
+		}
+		if t1.params.len != t2.params.len || t1.is_variadic != t2.is_variadic {
+			return false
+		}
+		for i := 0; i < t1.params.len; i++ {
+			p1 := t1.params.data[i].(*Node).ty
+			p2 := t2.params.data[i].(*Node).ty
+			if !is_compatible(unqual(p1), unqual(p2)) {
+				return false
+			}
+		}
+		return true
+	case STRUCT:
+		return false
+	}
+	return t1.size == t2.size && t1.is_unsigned == t2.is_unsigned
+}
+
+// A function declared without a prototype is compatible with a
+// prototype only if the parameters are not changed by the default
+// argument promotions and there is no ellipsis.
+func is_compatible_noproto(ty *Type) bool {
+	if ty.no_proto {
+		return true
+	}
+	if ty.is_variadic {
+		return false
+	}
+	for i := 0; i < ty.params.len; i++ {
+		switch ty.params.data[i].(*Node).ty.ty {
+		case BOOL, CHAR, SHORT, FLOAT:
+			return false
+		}
+	}
+	return true
+}
+
+// Declares a global variable or function. A redeclaration must have
+// a compatible type. A declaration without a prototype does not hide
+// an earlier prototype.
+func declare_global(node *Node, v *Var) {
+	v.tok = node.tok
+	prev := map_get(env.vars, v.name)
+	if prev == nil {
+		if node.op == ND_FUNC {
+			v.def = node.tok
+		}
+		map_put(env.vars, v.name, v)
+		return
+	}
+	old := prev.(*Var)
+	if !is_compatible(old.ty, v.ty) {
+		d := new_diag(SEV_ERROR, node_loc(node), format("conflicting types for '%s'", v.name))
+		if old.tok != nil {
+			add_note(d, token_loc(old.tok), format("previous declaration of '%s' was here", v.name))
+		}
+		error_diag(d)
+	}
+
+	// _Noreturn and attributes in any declaration apply to the
+	// function or variable.
+	old.is_noreturn = old.is_noreturn || v.is_noreturn
+	v.is_noreturn = old.is_noreturn
+	old.attrs = merge_attrs(old.attrs, v.attrs)
+	v.attrs = old.attrs
+	if node.op == ND_FUNC {
+		if old.def != nil {
+			d := new_diag(SEV_ERROR, token_loc(node.tok), format("redefinition of '%s'", v.name))
+			add_note(d, token_loc(old.def), format("previous definition of '%s' was here", v.name))
+			error_diag(d)
+		}
+		old.def = node.tok
+	}
+	v.def = old.def
+	if v.ty.ty == FUNC && v.ty.no_proto && !old.ty.no_proto {
+		return
+	}
+	v.used = v.used || old.used
+	map_put(env.vars, v.name, v)
+}
+
+// Returns the attributes of two declarations of the same entity.
+// Those of the later one take precedence.
+func merge_attrs(a, b *Attrs) *Attrs {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	m := *a
+	m.packed = a.packed || b.packed
+	m.is_weak = a.is_weak || b.is_weak
+	m.noreturn = a.noreturn || b.noreturn
+	m.unused = a.unused || b.unused
+	if m.aligned < b.aligned {
+		m.aligned = b.aligned
+	}
+	if b.section != "" {
+		m.section = b.section
+	}
+	if b.visibility != "" {
+		m.visibility = b.visibility
+	}
+	if b.constructor != 0 {
+		m.constructor = b.constructor
+	}
+	if b.destructor != 0 {
+		m.destructor = b.destructor
+	}
+	if b.fmt_idx != 0 {
+		m.fmt_idx, m.fmt_first = b.fmt_idx, b.fmt_first
+	}
+	return &m
+}
+
+// Pointers are compatible if they point to compatible types,
+// ignoring the qualifiers of the pointed-to types.
+func is_compatible_ptr(t1, t2 *Type) bool {
+	return is_compatible(unqual(t1.ptr_to), unqual(t2.ptr_to))
+}
+
+func is_void_ptr(ty *Type) bool {
+	return ty.ty == PTR && ty.ptr_to.ty == VOID
+}
+
+// A null pointer constant is an integer constant 0, optionally
+// cast to `void *`.
+func is_null_const(node *Node) bool {
+	if node.op == ND_CAST && (is_void_ptr(node.ty) || is_integer(node.ty)) {
+		return is_null_const(node.expr)
+	}
+	return node.op == ND_NUM && is_integer(node.ty) && node.val == 0
+}
+
+// Size of the objects a pointer points to. As a GNU extension,
+// arithmetic on `void *` works as if on `char *`.
+func elem_size(ty *Type) int {
+	if ty.ptr_to.ty == VOID {
+		return 1
+	}
+	return ty.ptr_to.size
+}
+
+// Converts a value as if by assignment to an object of type ty. A
+// pointer conversion must not drop qualifiers of the pointed-to
+// type, e.g. from `const char *` to `char *`. `void *` converts to
+// and from any object pointer without a cast.
+func assign_conv(node *Node, ty *Type) *Node {
+	return conv_as_assign(node, ty, nil, 0, nil)
+}
+
+// Converts an argument of a call to the type of its parameter. The
+// diagnostics name the argument and point to the parameter.
+func arg_conv(node *Node, ty *Type, call *Node, i int, param *Node) *Node {
+	return conv_as_assign(node, ty, call, i, param)
+}
+
+// The conversion of assign_conv. call is the call if node is its
+// i-th argument (0-origin), nil otherwise.
+func conv_as_assign(node *Node, ty *Type, call *Node, i int, param *Node) *Node {
+	what, arg := "assignment", ""
+	if call != nil {
+		arg = format("argument %d", i+1)
+		if name := call_name(call); name != "" {
+			arg = format("%s of '%s'", arg, name)
+		}
+		what = "passing " + arg
+	}
+
+	// An error or a warning (w >= 0), with a note at the parameter.
+	diag := func(w int, msg string) {
+		var d *Diag
+		if w < 0 {
+			d = new_diag(SEV_ERROR, node_loc(node), msg)
+		} else if d = new_warning(w, node_loc(node), msg); d == nil {
+			return
+		}
+		if param != nil && param.tok != nil {
+			add_note(d, token_loc(param.tok), format("expected '%s' but argument is of type '%s'", type_str(ty), type_str(node.ty)))
+		}
+		if w < 0 {
+			error_diag(d)
+		}
+		report(d)
+	}
+
+	if (ty.ty == STRUCT || node.ty.ty == STRUCT) && unqual(ty) != unqual(node.ty) {
+		if call != nil {
+			diag(-1, "incompatible type for "+arg)
+		}
+		diag(-1, "incompatible types when assigning a struct or union")
+	}
+	if ty.ty == PTR && node.ty.ty == PTR {
+		subject := "conversion"
+		if call != nil {
+			subject = what
+		}
+		lost := node.ty.ptr_to.qual &^ ty.ptr_to.qual
+		if lost&QUAL_CONST != 0 {
+			diag(-1, format("%s discards 'const' qualifier from pointer target type", subject))
+		}
+		if lost&QUAL_VOLATILE != 0 {
+			diag(-1, format("%s discards 'volatile' qualifier from pointer target type", subject))
+		}
+		if !is_void_ptr(ty) && !is_void_ptr(node.ty) && !is_compatible_ptr(ty, node.ty) {
+			diag(W_INCOMPATIBLE_POINTER_TYPES, format("%s from incompatible pointer type", what))
+		}
+	}
+	if ty.ty == PTR && is_integer(node.ty) && !is_null_const(node) {
+		diag(W_INT_CONVERSION, format("%s makes pointer from integer without a cast", what))
+	}
+	if is_integer(ty) && ty.ty != BOOL && node.ty.ty == PTR {
+		diag(W_INT_CONVERSION, format("%s makes integer from pointer without a cast", what))
+	}
+	return new_cast(node, ty)
+}
+
+// Checks the operands of a comparison of pointers. Pointers to
+// compatible types, `void *` and null pointer constants can be
+// compared. Relational operators need object pointers on both
+// sides.
+func check_ptr_cmp(node *Node) {
+	lhs, rhs := node.lhs, node.rhs
+	if lhs.ty.ty != PTR {
+		lhs, rhs = rhs, lhs
+	}
+	if rhs.ty.ty != PTR {
+		if !is_integer(rhs.ty) {
+			bad_node(node, "invalid operands to comparison")
+		}
+		if !is_null_const(rhs) {
+			warn_node(W_POINTER_INTEGER_COMPARE, node, "comparison between pointer and integer")
+		}
+		return
+	}
+	if is_void_ptr(lhs.ty) || is_void_ptr(rhs.ty) {
+		return
+	}
+	if !is_compatible_ptr(lhs.ty, rhs.ty) {
+		warn_node(W_COMPARE_DISTINCT_POINTER_TYPES, node, "comparison of distinct pointer types lacks a cast")
+	}
+}
+
+// Warns about a comparison in which a signed integer is converted to
+// unsigned. A nonnegative constant or a value of a narrower unsigned
+// type does not change.
+func check_sign_compare(node *Node) {
+	if !is_integer(node.lhs.ty) || !is_integer(node.rhs.ty) {
+		return
+	}
+	if !common_type(node.lhs.ty, node.rhs.ty).is_unsigned {
+		return
+	}
+	for _, e := range []*Node{node.lhs, node.rhs} {
+		if e.ty.is_unsigned || is_nonneg_const(e) {
+			continue
+		}
+		warn_node(W_SIGN_COMPARE, node, "comparison of integer expressions of different signedness")
+		return
+	}
+}
+
+func is_nonneg_const(node *Node) bool {
+	for node.op == ND_CAST {
+		node = node.expr
+	}
+	return node.op == ND_NUM && node.val >= 0
+}
+
+// Alignment of a variable or a member, which may be raised by _Alignas.
+func var_align(node *Node) int {
+	if node.align > node.ty.align {
+		return node.align
+	}
+	return node.ty.align
+}
+
+// Reserves a temporary area in the stack frame for a struct value.
+// Its size is rounded up to eightbytes so that gen_x86 can access it
+// by 8-byte loads and stores.
+func alloc_temp(ty *Type) int {
+	align := ty.align
+	if align < 8 {
+		align = 8
 	}
+	stacksize = roundup(stacksize, align)
+	stacksize += roundup(ty.size, 8)
+	return stacksize
 }
 
 func new_int(val int) *Node {
 	node := new(Node)
 	node.op = ND_NUM
-	node.ty = new(Type)
-	node.ty.ty = INT
+	node.ty = int_tyf()
 	node.val = val
 	return node
 }
 
+func new_cast(node *Node, ty *Type) *Node {
+	if ty.ty == VOID || is_aggregate(ty) {
+		return node
+	}
+	check_void(node)
+	if node.ty.ty == ty.ty && node.ty.is_unsigned == ty.is_unsigned {
+		return node
+	}
+
+	e := new_expr(ND_CAST, node, node.tok)
+	e.ty = ty
+	return e
+}
+
+// The value of a void expression, such as a call to a void function
+// or a statement expression without a value, cannot be used.
+func check_void(node *Node) {
+	if node.ty.ty == VOID {
+		bad_node(node, "void value not ignored as it ought to be")
+	}
+}
+
+// Integer types narrower than int are promoted to int.
+func promoted(ty *Type) *Type {
+	if is_integer(ty) && ty.size < 4 {
+		return int_tyf()
+	}
+	return unqual(ty)
+}
+
+func int_promote(node *Node) *Node {
+	check_void(node)
+	return new_cast(node, promoted(node.ty))
+}
+
+// Returns the type that both operands of an arithmetic operator are
+// converted to. A floating-point type wins over integer types. After
+// the promotions, the wider type wins. If both have the same width,
+// the unsigned one wins.
+func common_type(t1, t2 *Type) *Type {
+	if t1.ty == DOUBLE || t2.ty == DOUBLE {
+		return double_tyf()
+	}
+	if t1.ty == FLOAT || t2.ty == FLOAT {
+		return float_tyf()
+	}
+
+	t1 = promoted(t1)
+	t2 = promoted(t2)
+	if t1.size != t2.size {
+		if t1.size > t2.size {
+			return t1
+		}
+		return t2
+	}
+	if t2.is_unsigned {
+		return t2
+	}
+	return t1
+}
+
+// The usual arithmetic conversions
+func arith_conv(node *Node) *Type {
+	ty := common_type(node.lhs.ty, node.rhs.ty)
+	node.lhs = new_cast(node.lhs, ty)
+	node.rhs = new_cast(node.rhs, ty)
+	return ty
+}
+
+func is_arith_binop(node *Node) bool {
+	return is_arith(node.lhs.ty) && is_arith(node.rhs.ty)
+}
+
+func check_integer(node *Node) {
+	if !is_integer(node.ty) {
+		bad_node(node, "integer operand expected")
+	}
+}
+
+// Default argument promotions for arguments that have no
+// corresponding parameters.
+func default_promote(node *Node) *Node {
+	if node.ty.ty == FLOAT {
+		return new_cast(node, double_tyf())
+	}
+	return int_promote(node)
+}
+
+// Converts a scalar used as a condition to an int that is zero or
+// non-zero. Only floating-point values need an explicit comparison,
+// since -0.0 is false but its bit pattern is not zero.
+func to_bool(node *Node) *Node {
+	check_void(node)
+	if !is_flonum(node.ty) {
+		return node
+	}
+	zero := new_node(ND_NUM, node.tok)
+	zero.ty = node.ty
+	e := new_binop(ND_NE, node, zero, node.tok)
+	e.ty = int_tyf()
+	return e
+}
+
+// A call to an undeclared function implicitly declares it as
+// `int name()` at file scope.
+func implicit_decl(node *Node) *Type {
+	warn_token(W_IMPLICIT_FUNCTION_DECLARATION, node.tok, format("implicit declaration of function '%s'", node.name))
+	ty := new(Type)
+	ty.ty = FUNC
+	ty.returning = int_tyf()
+	ty.params = new_vec()
+	ty.no_proto = true
+
+	e := env
+	for e.next != nil {
+		e = e.next
+	}
+	map_put(e.vars, node.name, new_global(ty, node.name, "", 0))
+	return ty
+}
+
+func call_name(node *Node) string {
+	if node.expr != nil && node.expr.op == ND_GVAR {
+		return node.expr.name
+	}
+	return node.name
+}
+
 func scale_ptr(node *Node, ty *Type) *Node {
-	e := new(Node)
-	e.op = '*'
-	e.lhs = node
-	e.rhs = new_int(ty.ptr_to.size)
+	e := new_binop('*', node, new_int(elem_size(ty)), node.tok)
+	e.ty = long_tyf()
 	return e
 }
 
+// Analyzes a node. Nodes made by this pass take the location of the
+// nodes they replace.
 func walk(node *Node, decay bool) *Node {
+	ret := walk_without_loc(node, decay)
+	if ret != nil && ret.tok == nil && ret.op != ND_NULL {
+		ret.tok = node.tok
+	}
+	return ret
+}
+
+// Analyzes a statement of a block. After an error, the statement is
+// replaced with a null statement and the analysis continues.
+func walk_stmt(node *Node) (ret *Node) {
+	orig_env, orig_ret := env, ret_ty
+	defer func() {
+		if r := recover(); r != nil {
+			recovered(r)
+			env, ret_ty = orig_env, orig_ret
+			ret = &null_stmt
+		}
+	}()
+	return walk(node, true)
+}
+
+// Does the analysis of walk, but the node it returns may have no
+// location if it has been made by this pass.
+func walk_without_loc(node *Node, decay bool) *Node {
 	switch node.op {
-	case ND_NUM, ND_NULL, ND_BREAK:
+	case ND_NUM, ND_NULL, ND_BREAK, ND_CONTINUE, ND_ASM:
 		return node
 	case ND_STR:
 		{
 			// A string literal is converted to a reference to an anonymous
 			// global variable of type char array.
 			v := new_global(node.ty, format(".L.str%d", str_label), node.data, node.len)
+			v.is_static = true
 			str_label++
 			vec_push(globals, v)
 
-			ret := new(Node)
-			ret.op = ND_GVAR
+			ret := new_node(ND_GVAR, node.tok)
 			ret.ty = node.ty
 			ret.name = v.name
 			return maybe_decay(ret, decay)
@@ -128,41 +815,78 @@ func walk(node *Node, decay bool) *Node {
 		{
 			v := find_var(node.name)
 			if v == nil {
-				ErrorReport("undefined variable: %s", node.name)
+				bad_node(node, format("undefined variable: %s", node.name))
 			}
 
 			if v.is_local {
-				ret := new(Node)
-				ret.op = ND_LVAR
+				ret := new_node(ND_LVAR, node.tok)
 				ret.offset = v.offset
 				ret.ty = v.ty
 				return maybe_decay(ret, decay)
 			}
 
-			ret := new(Node)
-			ret.op = ND_GVAR
+			ret := new_node(ND_GVAR, node.tok)
 			ret.ty = v.ty
 			ret.name = v.name
+			ret.is_tls = v.is_tls
 			return maybe_decay(ret, decay)
 		}
 	case ND_VARDEF:
 		{
-			stacksize = roundup(stacksize, node.ty.align)
-			stacksize += node.ty.size
+			if node.is_static {
+				static_local(node)
+				return &null_stmt
+			}
+
+			// The size of an array of unknown length is determined
+			// by its initializer, so it has to be read first.
+			var items *Vector
+			if node.init != nil && node.ty.ty == ARY && node.ty.len < 0 {
+				items = init_items(node)
+			}
+			if node.ty.ty == ARY && node.ty.len < 0 {
+				bad_node(node, format("array size missing: %s", node.name))
+			}
+
+			// The variable is at BP - offset, so the offset is a
+			// multiple of its alignment. BP is aligned at 16, or
+			// at the alignment of the frame if it is greater.
+			align := var_align(node)
+			if frame_align < align {
+				frame_align = align
+			}
+			stacksize = roundup(stacksize+node.ty.size, align)
 			node.offset = stacksize
 			v := new(Var)
 			v.ty = node.ty
 			v.is_local = true
 			v.offset = stacksize
-			map_put(env.vars, node.name, v)
+			declare_local(node, v)
 
 			if node.init != nil {
-				node.init = walk(node.init, true)
+				if items == nil {
+					items = init_items(node)
+				}
+				node.inits = lower_init(node.offset, items)
 			}
 			return node
 		}
+	case ND_DECL:
+		{
+			v := new_global(node.ty, node.name, "", 0)
+			v.is_tls = node.is_tls
+			v.is_noreturn = node.is_noreturn
+			v.attrs = node.attrs
+			map_put(env.vars, node.name, v)
+			return &null_stmt
+		}
+	case ND_DECL_LIST:
+		for i := 0; i < node.stmts.len; i++ {
+			node.stmts.data[i] = walk(node.stmts.data[i].(*Node), true)
+		}
+		return node
 	case ND_IF:
-		node.cond = walk(node.cond, true)
+		node.cond = to_bool(walk(node.cond, true))
 		node.then = walk(node.then, true)
 		if node.els != nil {
 			node.els = walk(node.els, true)
@@ -172,135 +896,365 @@ func walk(node *Node, decay bool) *Node {
 		env = new_env(env)
 		node.init = walk(node.init, true)
 		if node.cond != nil {
-			node.cond = walk(node.cond, true)
+			node.cond = to_bool(walk(node.cond, true))
 		}
 		if node.inc != nil {
 			node.inc = walk(node.inc, true)
 		}
 		node.body = walk(node.body, true)
-		env = env.next
+		leave_scope()
 		return node
 	case ND_DO_WHILE:
-		node.cond = walk(node.cond, true)
+		node.cond = to_bool(walk(node.cond, true))
+		node.body = walk(node.body, true)
+		return node
+	case ND_SWITCH:
+		node.cond = int_promote(walk(node.cond, true))
+		check_integer(node.cond)
+		ty := node.cond.ty
+		for i := 0; i < node.cases.len; i++ {
+			c := node.cases.data[i].(*Node)
+			c.val = cast_val(c.val, ty)
+			c.case_end = cast_val(c.case_end, ty)
+			if !case_le(c.val, c.case_end, ty) {
+				continue // An empty range
+			}
+			for j := 0; j < i; j++ {
+				d := node.cases.data[j].(*Node)
+				if !case_le(d.val, d.case_end, ty) {
+					continue
+				}
+				if case_le(c.val, d.case_end, ty) && case_le(d.val, c.case_end, ty) {
+					if c.val != c.case_end || d.val != d.case_end {
+						bad_node(c, "duplicate (or overlapping) case value")
+					}
+					bad_node(c, "duplicate case value")
+				}
+			}
+		}
+		node.body = walk(node.body, true)
+		return node
+	case ND_CASE:
 		node.body = walk(node.body, true)
 		return node
 	case '+', '-':
 		node.lhs = walk(node.lhs, true)
 		node.rhs = walk(node.rhs, true)
+		check_void(node.lhs)
+		check_void(node.rhs)
 
-		if node.rhs.ty.ty == PTR {
+		// The difference of two pointers is the number of elements
+		// between them.
+		if node.op == '-' && node.lhs.ty.ty == PTR && node.rhs.ty.ty == PTR {
+			if !is_compatible_ptr(node.lhs.ty, node.rhs.ty) {
+				bad_node(node, "invalid operands to binary - (pointers to incompatible types)")
+			}
+			node.ty = long_tyf()
+			e := new_binop('/', node, new_int(elem_size(node.lhs.ty)), node.tok)
+			e.ty = long_tyf()
+			return e
+		}
+
+		if node.op == '+' && node.rhs.ty.ty == PTR {
 			swap(&node.lhs, &node.rhs)
 		}
 		if node.rhs.ty.ty == PTR {
-			ErrorReport("pointer %c pointer' is not defined", node.op)
+			bad_node(node, format("invalid operands to binary %c", node.op))
 		}
 
 		if node.lhs.ty.ty == PTR {
 			node.rhs = scale_ptr(node.rhs, node.lhs.ty)
+			node.ty = unqual(node.lhs.ty)
+			return node
 		}
 
-		node.ty = node.lhs.ty
+		node.ty = arith_conv(node)
+		return node
+	case '=':
+		node.lhs = walk(node.lhs, false)
+		check_assignable(node.lhs)
+		node.rhs = assign_conv(walk(node.rhs, true), node.lhs.ty)
+		node.ty = unqual(node.lhs.ty)
 		return node
-	case ND_ADD_EQ, ND_SUB_EQ:
+	case ND_ADD_EQ, ND_SUB_EQ, ND_MUL_EQ, ND_DIV_EQ, ND_MOD_EQ, ND_SHL_EQ, ND_SHR_EQ, ND_BITAND_EQ, ND_XOR_EQ, ND_BITOR_EQ:
+		// `a op= b` is computed in the common type of a and b (or in
+		// the promoted type of a for shifts) and the result is
+		// converted back to the type of a. gen_ir takes the type of
+		// the operation from the converted rhs.
 		node.lhs = walk(node.lhs, false)
-		check_lval(node.lhs)
+		check_assignable(node.lhs)
 		node.rhs = walk(node.rhs, true)
 		node.ty = node.lhs.ty
 
-		if node.lhs.ty.ty == PTR {
+		switch node.op {
+		case ND_MOD_EQ, ND_SHL_EQ, ND_SHR_EQ, ND_BITAND_EQ, ND_XOR_EQ, ND_BITOR_EQ:
+			check_integer(node.lhs)
+			check_integer(node.rhs)
+		}
+
+		if node.lhs.ty.ty == PTR && (node.op == ND_ADD_EQ || node.op == ND_SUB_EQ) {
 			node.rhs = scale_ptr(node.rhs, node.lhs.ty)
+		} else if node.op == ND_SHL_EQ || node.op == ND_SHR_EQ {
+			node.rhs = new_cast(node.rhs, promoted(node.lhs.ty))
+		} else {
+			node.rhs = new_cast(node.rhs, common_type(node.lhs.ty, node.rhs.ty))
 		}
 		return node
-	case '=', ND_MUL_EQ, ND_DIV_EQ, ND_MOD_EQ, ND_SHL_EQ, ND_SHR_EQ, ND_BITAND_EQ, ND_XOR_EQ, ND_BITOR_EQ:
-		node.lhs = walk(node.lhs, false)
-		check_lval(node.lhs)
-		node.rhs = walk(node.rhs, true)
-		node.ty = node.lhs.ty
-		return node
 
 	case ND_DOT:
 		node.expr = walk(node.expr, true)
 		if node.expr.ty.ty != STRUCT {
-			ErrorReport("struct expected before '.'")
+			bad_node(node, "struct or union expected before '.'")
 		}
 
-		ty := node.expr.ty
+		// A member of a qualified struct has the same qualifiers.
+		// The struct may have been completed after the qualified
+		// type was made, so look at the unqualified one.
+		ty := unqual(node.expr.ty)
 		if ty.members == nil {
-			ErrorReport("incomplete type")
+			bad_node(node, "incomplete type")
 		}
 		for i := 0; i < ty.members.len; i++ {
 			m := ty.members.data[i].(*Node)
 			if m.name != node.name {
 				continue
 			}
-			node.ty = m.ty
-			node.offset = m.ty.offset
+			node.ty = qualify(m.ty, node.expr.ty.qual)
+			node.offset = m.offset
+			node.is_bitfield = m.is_bitfield
+			node.bit_width = m.bit_width
+			node.bit_offset = m.bit_offset
 			return maybe_decay(node, decay)
 		}
-		ErrorReport("member missing: %s", node.name)
+		bad_node(node, format("member missing: %s", node.name))
 	case '?':
-		node.cond = walk(node.cond, true)
+		// In "a ?: b", gen_ir tests the value of a converted to the
+		// result type, which is never narrower.
+		if node.cond != nil {
+			node.cond = to_bool(walk(node.cond, true))
+		}
 		node.then = walk(node.then, true)
 		node.els = walk(node.els, true)
-		node.ty = node.then.ty
+
+		if is_arith(node.then.ty) && is_arith(node.els.ty) {
+			node.ty = common_type(node.then.ty, node.els.ty)
+			node.then = new_cast(node.then, node.ty)
+			node.els = new_cast(node.els, node.ty)
+		} else if node.then.ty.ty == PTR && is_null_const(node.els) {
+			node.ty = unqual(node.then.ty)
+		} else if node.els.ty.ty == PTR && is_null_const(node.then) {
+			node.ty = unqual(node.els.ty)
+		} else if is_void_ptr(node.then.ty) || is_void_ptr(node.els.ty) {
+			node.ty = ptr_to(void_tyf())
+		} else {
+			if node.then.ty.ty == PTR && node.els.ty.ty == PTR &&
+				!is_compatible_ptr(node.then.ty, node.els.ty) {
+				warn_node(W_COMPARE_DISTINCT_POINTER_TYPES, node, "pointer type mismatch in conditional expression")
+			}
+			node.ty = unqual(node.then.ty)
+		}
 		return node
-	case '*', '/', '%', '<', '|', '^', '&', ND_EQ, ND_NE, ND_LE, ND_SHL, ND_SHR, ND_LOGAND, ND_LOGOR:
+	case '*', '/':
 		node.lhs = walk(node.lhs, true)
 		node.rhs = walk(node.rhs, true)
-		node.ty = node.lhs.ty
+		node.ty = arith_conv(node)
 		return node
-	case ',':
+	case '%', '|', '^', '&':
 		node.lhs = walk(node.lhs, true)
 		node.rhs = walk(node.rhs, true)
-		node.ty = node.rhs.ty
-		return node
-	case ND_POST_INC, ND_POST_DEC, ND_NEG, '!', '~':
-		node.expr = walk(node.expr, true)
-		node.ty = node.expr.ty
+		check_integer(node.lhs)
+		check_integer(node.rhs)
+		node.ty = arith_conv(node)
 		return node
-	case ND_ADDR:
+	case '<', ND_EQ, ND_NE, ND_LE:
+		node.lhs = walk(node.lhs, true)
+		node.rhs = walk(node.rhs, true)
+		check_void(node.lhs)
+		check_void(node.rhs)
+		if is_arith_binop(node) {
+			check_sign_compare(node)
+			arith_conv(node)
+		} else if node.lhs.ty.ty == PTR || node.rhs.ty.ty == PTR {
+			check_ptr_cmp(node)
+			// An integer operand is converted to the pointer type,
+			// so that the comparison is unsigned.
+			if node.lhs.ty.ty != PTR {
+				node.lhs = new_cast(node.lhs, node.rhs.ty)
+			}
+		} else {
+			bad_node(node, "invalid operands to comparison")
+		}
+		node.ty = int_tyf()
+		return node
+	case ND_SHL, ND_SHR:
+		node.lhs = int_promote(walk(node.lhs, true))
+		node.rhs = int_promote(walk(node.rhs, true))
+		check_integer(node.lhs)
+		check_integer(node.rhs)
+		node.ty = node.lhs.ty
+		return node
+	case ND_LOGAND, ND_LOGOR:
+		node.lhs = to_bool(walk(node.lhs, true))
+		node.rhs = to_bool(walk(node.rhs, true))
+		node.ty = int_tyf()
+		return node
+	case ',':
+		node.lhs = walk(node.lhs, true)
+		node.rhs = walk(node.rhs, true)
+		node.ty = unqual(node.rhs.ty)
+		return node
+	case ND_POST_INC, ND_POST_DEC:
 		node.expr = walk(node.expr, true)
+		check_assignable(node.expr)
+		node.ty = unqual(node.expr.ty)
+		return node
+	case ND_NEG:
+		node.expr = int_promote(walk(node.expr, true))
+		node.ty = node.expr.ty
+		return node
+	case '~':
+		node.expr = int_promote(walk(node.expr, true))
+		check_integer(node.expr)
+		node.ty = node.expr.ty
+		return node
+	case '!':
+		node.expr = to_bool(walk(node.expr, true))
+		node.ty = int_tyf()
+		return node
+	case ND_ADDR:
+		node.expr = walk(node.expr, false)
 		check_lval(node.expr)
+		if node.expr.is_bitfield {
+			bad_node(node, format("cannot take address of bit-field '%s'", node.expr.name))
+		}
 		node.ty = ptr_to(node.expr.ty)
 		return node
 	case ND_DEREF:
 		node.expr = walk(node.expr, true)
 
 		if node.expr.ty.ty != PTR {
-			ErrorReport("operand must be a pointer")
+			bad_node(node, "operand must be a pointer")
 		}
 
 		if node.expr.ty.ptr_to.ty == VOID {
-			ErrorReport("cannot dereference void pointer")
+			bad_node(node, "cannot dereference void pointer")
 		}
 
 		node.ty = node.expr.ty.ptr_to
 		return maybe_decay(node, decay)
-	case ND_RETURN, ND_EXPR_STMT:
+	case ND_RETURN:
+		if cur_fn != nil && cur_fn.is_noreturn {
+			warn_node(W_INVALID_NORETURN, node, "function declared 'noreturn' has a 'return' statement")
+		}
+		node.expr = assign_conv(walk(node.expr, true), ret_ty)
+		return node
+	case ND_GENERIC:
+		return walk(generic_assoc(node), decay)
+	case ND_EXPR_STMT:
 		node.expr = walk(node.expr, true)
 		return node
 	case ND_SIZEOF:
 		{
-			expr := walk(node.expr, false)
-			return new_int(expr.ty.size)
+			ty := node.ty
+			if node.expr != nil {
+				expr := walk(node.expr, false)
+				if expr.is_bitfield {
+					bad_node(node, "'sizeof' applied to a bit-field")
+				}
+				ty = expr.ty
+			}
+			return new_int(ty.size)
 		}
 	case ND_ALIGNOF:
 		{
-			expr := walk(node.expr, false)
-			return new_int(expr.ty.align)
+			ty := node.ty
+			if node.expr != nil {
+				ty = walk(node.expr, false).ty
+			}
+			return new_int(ty.align)
+		}
+	case ND_CAST:
+		// An explicit cast. Conversions inserted by sema are not
+		// walked again.
+		node.expr = walk(node.expr, true)
+		if node.ty.ty == VOID {
+			return node
 		}
+		if !is_scalar(node.ty) {
+			bad_node(node, "conversion to non-scalar type requested")
+		}
+		check_void(node.expr)
+		if !is_scalar(node.expr.ty) {
+			bad_node(node, "operand of a cast must have scalar type")
+		}
+		if (node.ty.ty == PTR && is_flonum(node.expr.ty)) ||
+			(is_flonum(node.ty) && node.expr.ty.ty == PTR) {
+			bad_node(node, "invalid cast between pointer and floating-point type")
+		}
+		return node
 	case ND_CALL:
 		{
-			v := find_var(node.name)
-			if v != nil && v.ty.ty == FUNC {
-				node.ty = v.ty.returning
-			} else {
-				fmt.Fprintf(os.Stderr, "bad function: %s\n", node.name)
-				node.ty = &int_ty
+			var fn *Type
+			var attrs *Attrs
+			if node.expr == nil {
+				v := find_var(node.name)
+				if v != nil && v.ty.ty != FUNC {
+					// A call through a function pointer variable
+					node.expr = new_node(ND_IDENT, node.tok)
+					node.expr.name = node.name
+				} else if v != nil {
+					fn = v.ty
+					attrs = v.attrs
+					node.ty = v.ty.returning
+					node.is_noreturn = v.is_noreturn || noreturn_funcs[node.name]
+				} else {
+					fn = implicit_decl(node)
+					node.ty = fn.returning
+					node.is_noreturn = noreturn_funcs[node.name]
+				}
 			}
 
+			if node.expr != nil {
+				node.expr = walk(node.expr, true)
+				ty := node.expr.ty
+				if ty.ty != PTR || ty.ptr_to.ty != FUNC {
+					bad_node(node, "called object is not a function")
+				}
+				fn = ty.ptr_to
+				node.ty = fn.returning
+			}
+
+			if !fn.no_proto {
+				if node.args.len < fn.params.len {
+					bad_token(node.tok, format("too few arguments to function '%s'", call_name(node)))
+				}
+				if node.args.len > fn.params.len && !fn.is_variadic {
+					bad_token(node.tok, format("too many arguments to function '%s'", call_name(node)))
+				}
+			}
+
+			// Arguments are converted to the types of the parameters.
+			// The ones without parameters (variadic arguments or
+			// arguments to a function declared without a parameter
+			// list) are promoted.
+			fmt_str, has_fmt := format_literal(node, attrs)
 			for i := 0; i < node.args.len; i++ {
-				node.args.data[i] = walk(node.args.data[i].(*Node), true)
+				arg := walk(node.args.data[i].(*Node), true)
+				if i < fn.params.len {
+					param := fn.params.data[i].(*Node)
+					arg = arg_conv(arg, param.ty, node, i, param)
+				} else {
+					arg = default_promote(arg)
+				}
+				node.args.data[i] = arg
+			}
+			if has_fmt {
+				check_format(node, fmt_str, attrs.fmt_first)
+			}
+
+			// A struct return value is stored to a temporary.
+			if node.ty.ty == STRUCT {
+				node.offset = alloc_temp(node.ty)
 			}
 			return node
 		}
@@ -308,14 +1262,62 @@ func walk(node *Node, decay bool) *Node {
 		{
 			env = new_env(env)
 			for i := 0; i < node.stmts.len; i++ {
-				node.stmts.data[i] = walk(node.stmts.data[i].(*Node), true)
+				node.stmts.data[i] = walk_stmt(node.stmts.data[i].(*Node))
 			}
-			env = env.next
+			leave_scope()
 			return node
 		}
 	case ND_STMT_EXPR:
-		node.body = walk(node.body, true)
-		node.ty = &int_ty
+		{
+			// The value of a statement expression is that of its
+			// last statement if it is an expression statement, and
+			// it is void otherwise.
+			node.body = walk(node.body, true)
+			stmts := node.body.stmts
+			if stmts.len > 0 && stmts.data[stmts.len-1].(*Node).op == ND_EXPR_STMT {
+				stmts.len--
+				node.expr = stmts.data[stmts.len].(*Node).expr
+				node.ty = node.expr.ty
+				return node
+			}
+			node.ty = void_tyf()
+			return node
+		}
+	case ND_VA_START:
+		node.expr = walk(node.expr, true)
+		node.rhs = walk(node.rhs, true)
+		if node.expr.ty.ty != PTR {
+			bad_node(node, "va_list expected in va_start")
+		}
+		if !cur_fn.ty.is_variadic {
+			bad_node(node, "va_start used in function with fixed args")
+		}
+		// Named parameters consume argument registers before
+		// the variadic ones.
+		node.args = cur_fn.args
+		node.offset = cur_fn.va_area
+		node.ty = void_tyf()
+		return node
+	case ND_VA_ARG:
+		node.expr = walk(node.expr, true)
+		if node.expr.ty.ty != PTR {
+			bad_node(node, "va_list expected in va_arg")
+		}
+		if node.ty.ty == STRUCT || node.ty.ty == ARY || node.ty.ty == VOID {
+			bad_node(node, "va_arg of this type is not supported")
+		}
+		return node
+	case ND_VA_COPY:
+		node.lhs = walk(node.lhs, true)
+		node.rhs = walk(node.rhs, true)
+		if node.lhs.ty.ty != PTR || node.rhs.ty.ty != PTR {
+			bad_node(node, "va_list expected in va_copy")
+		}
+		node.ty = void_tyf()
+		return node
+	case ND_VA_END:
+		node.expr = walk(node.expr, true)
+		node.ty = void_tyf()
 		return node
 	default:
 		//assert(0 && "unknouwn node type")
@@ -323,39 +1325,976 @@ func walk(node *Node, decay bool) *Node {
 	return nil
 }
 
+// Initializers
+//
+// An initializer is flattened to a list of Initializers, one for
+// each scalar that is explicitly initialized. Brace elision and
+// designators are resolved here because both depend on the type of
+// the object being initialized.
+
+func is_aggregate(ty *Type) bool {
+	return ty.ty == ARY || ty.ty == STRUCT
+}
+
+// Returns true if an object of the type can never be modified, which
+// is the case for const types and arrays of them.
+func is_const_obj(ty *Type) bool {
+	if ty.ty == ARY {
+		return is_const_obj(ty.ary_of)
+	}
+	return ty.qual&QUAL_CONST != 0
+}
+
+func is_scalar(ty *Type) bool {
+	return is_arith(ty) || ty.ty == PTR
+}
+
+func is_char_array(ty *Type) bool {
+	return ty.ty == ARY && ty.ary_of.ty == CHAR
+}
+
+func add_init(items *Vector, ty *Type, offset int, expr *Node) {
+	init := new(Initializer)
+	init.ty = ty
+	init.offset = offset
+	init.expr = assign_conv(expr, ty)
+	vec_push(items, init)
+}
+
+// Flattens the initializer of a variable definition. An array of
+// unknown length gets its length from the initializer.
+func init_items(node *Node) *Vector {
+	items := new_vec()
+	ty := node.ty
+	init := node.init
+
+	if ty.ty == STRUCT && unqual(ty).members == nil {
+		bad_node(node, "initializing incomplete type")
+	}
+
+	n := 0
+	if init.op == ND_INIT_LIST {
+		n = init_braced(items, ty, 0, init)
+	} else if is_char_array(ty) && init.op == ND_STR {
+		n = init_string(items, ty, 0, init)
+	} else if ty.ty == STRUCT {
+		// A struct may be initialized by a struct value.
+		add_init(items, ty, 0, walk(init, true))
+	} else if is_aggregate(ty) {
+		bad_node(node, format("invalid initializer: %s", node.name))
+	} else {
+		add_init(items, ty, 0, walk(init, true))
+	}
+
+	if ty.ty == ARY && ty.len < 0 {
+		node.ty = ary_of(ty.ary_of, n)
+	}
+	return items
+}
+
+// Returns the number of array elements initialized.
+func init_string(items *Vector, ty *Type, offset int, node *Node) int {
+	n := node.len + 1
+	if ty.len >= 0 && n > ty.len {
+		n = ty.len
+	}
+	for i := 0; i < n; i++ {
+		c := 0
+		if i < node.len {
+			c = int(node.data[i])
+		}
+		add_init(items, ty.ary_of, offset+i, new_int(c))
+	}
+	return n
+}
+
+// Initializes an object from a brace-enclosed list. Returns the
+// number of array elements initialized.
+func init_braced(items *Vector, ty *Type, offset int, node *Node) int {
+	// Designators are replaced with their values while the list is
+	// read, so a copy is read to leave the tree unchanged.
+	list := new_vec()
+	for i := 0; i < node.stmts.len; i++ {
+		vec_push(list, node.stmts.data[i])
+	}
+
+	if is_char_array(ty) && list.len == 1 && list.data[0].(*Node).op == ND_STR {
+		return init_string(items, ty, offset, list.data[0].(*Node))
+	}
+
+	i := 0
+	if is_aggregate(ty) {
+		return init_aggregate(items, ty, offset, list, &i, true, false)
+	}
+
+	// A scalar may be enclosed in braces.
+	if list.len == 0 {
+		bad_node(node, "empty scalar initializer")
+	}
+	init_elem(items, ty, offset, list, &i)
+	if i < list.len {
+		bad_node(node, "excess elements in scalar initializer")
+	}
+	return 0
+}
+
+// Initializes a subobject from list[*i]. If the subobject is an
+// aggregate but the initializer is not enclosed in braces, the
+// aggregate takes as many elements of the list as it needs.
+func init_elem(items *Vector, ty *Type, offset int, list *Vector, i *int) {
+	node := list.data[*i].(*Node)
+
+	if node.op == ND_INIT_LIST {
+		*i++
+		init_braced(items, ty, offset, node)
+		return
+	}
+
+	if is_char_array(ty) && node.op == ND_STR {
+		*i++
+		init_string(items, ty, offset, node)
+		return
+	}
+
+	if is_aggregate(ty) {
+		init_aggregate(items, ty, offset, list, i, false, node.op == ND_DESIG)
+		return
+	}
+
+	if node.op == ND_DESIG {
+		bad_node(node, "designator for non-aggregate type")
+	}
+	*i++
+	add_init(items, ty, offset, walk(node, true))
+}
+
+// Initializes the elements or members of an aggregate in order.
+//
+// If the list is not enclosed in braces for this aggregate (brace
+// elision), it stops when the aggregate is full or when it reaches
+// a designator, which belongs to an enclosing aggregate. Only the
+// first element may be a designator in that case, when the rest of
+// a designation continues into this aggregate.
+//
+// Returns the number of array elements initialized.
+func init_aggregate(items *Vector, ty *Type, offset int, list *Vector, i *int, braced, desig bool) int {
+	idx := 0
+	max := 0
+	for *i < list.len {
+		node := list.data[*i].(*Node)
+
+		// Unnamed bit-fields are not initialized.
+		for ty.ty == STRUCT && idx < ty.members.len && ty.members.data[idx].(*Node).name == "" {
+			idx++
+		}
+
+		if node.op == ND_DESIG {
+			if !braced && !desig {
+				break
+			}
+			idx = designate(ty, node)
+			list.data[*i] = node.expr
+		} else if (ty.ty == ARY && ty.len >= 0 && idx >= ty.len) ||
+			(ty.ty == STRUCT && idx >= ty.members.len) ||
+			(ty.is_union && max > 0) {
+			// Only one member of a union is initialized.
+			if braced {
+				bad_node(node, "excess elements in initializer")
+			}
+			break
+		}
+		desig = false
+
+		if ty.ty == ARY {
+			init_elem(items, ty.ary_of, offset+idx*ty.ary_of.size, list, i)
+		} else {
+			m := ty.members.data[idx].(*Node)
+			start := items.len
+			init_elem(items, m.ty, offset+m.offset, list, i)
+			for j := start; j < items.len; j++ {
+				init := items.data[j].(*Initializer)
+				init.bit_width = m.bit_width
+				init.bit_offset = m.bit_offset
+			}
+		}
+
+		idx++
+		if max < idx {
+			max = idx
+		}
+	}
+	return max
+}
+
+// Returns the index of the element or member a designator refers to.
+func designate(ty *Type, node *Node) int {
+	if ty.ty == ARY {
+		if node.lhs == nil {
+			bad_node(node, "array index expected in designator")
+		}
+		idx := eval_const(walk(node.lhs, true))
+		if idx < 0 || (ty.len >= 0 && idx >= ty.len) {
+			bad_node(node, format("array index in designator out of range: %d", idx))
+		}
+		return idx
+	}
+
+	if node.lhs != nil {
+		bad_node(node, "array index in non-array initializer")
+	}
+	for i := 0; i < ty.members.len; i++ {
+		m := ty.members.data[i].(*Node)
+		if m.name == node.name {
+			return i
+		}
+	}
+	bad_node(node, format("member missing: %s", node.name))
+	return 0
+}
+
+// Local variables are initialized by assignments to their elements.
+func lower_init(offset int, items *Vector) *Vector {
+	v := new_vec()
+	for i := 0; i < items.len; i++ {
+		init := items.data[i].(*Initializer)
+
+		lhs := new(Node)
+		lhs.op = ND_LVAR
+		lhs.ty = init.ty
+		lhs.offset = offset - init.offset
+		if init.bit_width > 0 {
+			lhs = bitfield_ref(lhs, init)
+		}
+
+		node := new_binop('=', lhs, init.expr, init.expr.tok)
+		node.ty = init.ty
+		vec_push(v, node)
+	}
+	return v
+}
+
+// Refers to a bit-field in the storage unit of var.
+func bitfield_ref(lvar *Node, init *Initializer) *Node {
+	node := new_expr(ND_DOT, lvar, nil)
+	node.ty = init.ty
+	node.is_bitfield = true
+	node.bit_width = init.bit_width
+	node.bit_offset = init.bit_offset
+	return node
+}
+
+// Global variables are initialized by their image in the data
+// section. Pointers to other globals in it are recorded as
+// relocations.
+func init_global(v *Var, items *Vector) {
+	buf := make([]byte, v.ty.size)
+	v.rels = new_vec()
+	v.inits = items
+	for i := 0; i < items.len; i++ {
+		init := items.data[i].(*Initializer)
+		if is_flonum(init.ty) {
+			fval := eval_double(init.expr)
+			val := uint64(math.Float64bits(fval))
+			if init.ty.ty == FLOAT {
+				val = uint64(math.Float32bits(float32(fval)))
+			}
+			for j := 0; j < init.ty.size; j++ {
+				buf[init.offset+j] = byte(val >> uint(j*8))
+			}
+			continue
+		}
+
+		label := ""
+		val := eval_addr_const(init.expr, &label)
+
+		if label != "" {
+			if init.ty.size != 8 {
+				bad_node(init.expr, format("initializer element is not computable at load time: %s", v.name))
+			}
+			rel := new(Reloc)
+			rel.offset = init.offset
+			rel.label = label
+			rel.addend = val
+			vec_push(v.rels, rel)
+			continue
+		}
+
+		if init.bit_width > 0 {
+			// Merge the bits into the storage unit.
+			unit := 0
+			for j := 0; j < init.ty.size; j++ {
+				unit |= int(buf[init.offset+j]) << uint(j*8)
+			}
+			mask := (1<<uint(init.bit_width) - 1) << uint(init.bit_offset)
+			val = unit&^mask | (val<<uint(init.bit_offset))&mask
+		}
+
+		for j := 0; j < init.ty.size; j++ {
+			buf[init.offset+j] = byte(val >> uint(j*8))
+		}
+	}
+
+	// Trailing zeros are emitted as .zero.
+	n := len(buf)
+	for n > 0 && buf[n-1] == 0 {
+		n--
+	}
+	v.data = string(buf[:n])
+	v.len = n
+}
+
+// Converts a constant to an integer type by truncating it to
+// the width of the type.
+func cast_val(val int, ty *Type) int {
+	if !is_integer(ty) {
+		return val
+	}
+	if ty.ty == BOOL {
+		return bool_to_int(val != 0)
+	}
+	switch ty.size {
+	case 1:
+		if ty.is_unsigned {
+			return int(uint8(val))
+		}
+		return int(int8(val))
+	case 2:
+		if ty.is_unsigned {
+			return int(uint16(val))
+		}
+		return int(int16(val))
+	case 4:
+		if ty.is_unsigned {
+			return int(uint32(val))
+		}
+		return int(int32(val))
+	}
+	return val
+}
+
+// Evaluates a constant expression of floating-point type.
+func eval_double(node *Node) float64 {
+	switch node.op {
+	case ND_NUM:
+		if is_flonum(node.ty) {
+			return node.fval
+		}
+		if node.ty.is_unsigned {
+			return float64(uint64(node.val))
+		}
+		return float64(node.val)
+	case ND_CAST:
+		if is_flonum(node.expr.ty) {
+			if node.ty.ty == FLOAT {
+				return float64(float32(eval_double(node.expr)))
+			}
+			return eval_double(node.expr)
+		}
+		if node.expr.ty.is_unsigned {
+			return float64(uint64(eval_const(node.expr)))
+		}
+		return float64(eval_const(node.expr))
+	case '+':
+		return eval_double(node.lhs) + eval_double(node.rhs)
+	case '-':
+		return eval_double(node.lhs) - eval_double(node.rhs)
+	case '*':
+		return eval_double(node.lhs) * eval_double(node.rhs)
+	case '/':
+		return eval_double(node.lhs) / eval_double(node.rhs)
+	case ND_NEG:
+		return -eval_double(node.expr)
+	case '?':
+		if node.cond == nil {
+			if val := eval_double(node.then); val != 0 {
+				return val
+			}
+		} else if eval_const(node.cond) != 0 {
+			return eval_double(node.then)
+		}
+		return eval_double(node.els)
+	case ',':
+		return eval_double(node.rhs)
+	}
+	bad_node(node, "not a compile-time constant")
+	return 0
+}
+
+func eval_fcmp(node *Node) int {
+	lhs, rhs := eval_double(node.lhs), eval_double(node.rhs)
+	switch node.op {
+	case ND_EQ:
+		return bool_to_int(lhs == rhs)
+	case ND_NE:
+		return bool_to_int(lhs != rhs)
+	case '<':
+		return bool_to_int(lhs < rhs)
+	}
+	return bool_to_int(lhs <= rhs)
+}
+
+// Evaluates an integer constant expression.
+func eval_const(node *Node) int {
+	return eval_addr_const(node, nil)
+}
+
+// Evaluates a constant expression. If label is not nil, an address
+// constant, that is the address of a global variable or function
+// plus or minus an integer, is also accepted. Then the name of the
+// global is stored to *label and the offset is returned.
+func eval_addr_const(node *Node, label *string) int {
+	val := eval_op(node, label)
+	if (label == nil || *label == "") && node.ty != nil && is_integer(node.ty) {
+		return cast_val(val, node.ty)
+	}
+	return val
+}
+
+// Evaluates the operator of a node in 64 bits, without truncating the
+// result to the type of the node as eval_addr_const does.
+func eval_op(node *Node, label *string) int {
+	switch node.op {
+	case ND_EQ, ND_NE, '<', ND_LE:
+		// Comparisons of floating-point numbers
+		if is_flonum(node.lhs.ty) {
+			return eval_fcmp(node)
+		}
+	}
+
+	switch node.op {
+	case ND_NUM:
+		return node.val
+	case '+':
+		lhs, rhs := eval_addr_const(node.lhs, label), eval_const(node.rhs)
+		check_overflow(node, label, lhs, rhs, lhs+rhs)
+		return lhs + rhs
+	case '-':
+		lhs, rhs := eval_addr_const(node.lhs, label), eval_const(node.rhs)
+		check_overflow(node, label, lhs, rhs, lhs-rhs)
+		return lhs - rhs
+	case '*':
+		lhs, rhs := eval_const(node.lhs), eval_const(node.rhs)
+		check_overflow(node, nil, lhs, rhs, lhs*rhs)
+		return lhs * rhs
+	case '/', '%':
+		{
+			lhs, rhs := eval_const(node.lhs), eval_const(node.rhs)
+			if rhs == 0 {
+				bad_node(node, "division by zero in constant expression")
+			}
+			if is_unsigned(node.lhs.ty) {
+				if node.op == '/' {
+					return int(uint64(lhs) / uint64(rhs))
+				}
+				return int(uint64(lhs) % uint64(rhs))
+			}
+			if node.op == '/' {
+				return lhs / rhs
+			}
+			return lhs % rhs
+		}
+	case '&':
+		return eval_const(node.lhs) & eval_const(node.rhs)
+	case '|':
+		return eval_const(node.lhs) | eval_const(node.rhs)
+	case '^':
+		return eval_const(node.lhs) ^ eval_const(node.rhs)
+	case ND_SHL:
+		return eval_const(node.lhs) << uint(eval_const(node.rhs))
+	case ND_SHR:
+		if node.lhs.ty.is_unsigned {
+			return int(uint64(eval_const(node.lhs)) >> uint(eval_const(node.rhs)))
+		}
+		return eval_const(node.lhs) >> uint(eval_const(node.rhs))
+	case ND_EQ:
+		return bool_to_int(eval_const(node.lhs) == eval_const(node.rhs))
+	case ND_NE:
+		return bool_to_int(eval_const(node.lhs) != eval_const(node.rhs))
+	case '<':
+		if is_unsigned(node.lhs.ty) {
+			return bool_to_int(uint64(eval_const(node.lhs)) < uint64(eval_const(node.rhs)))
+		}
+		return bool_to_int(eval_const(node.lhs) < eval_const(node.rhs))
+	case ND_LE:
+		if is_unsigned(node.lhs.ty) {
+			return bool_to_int(uint64(eval_const(node.lhs)) <= uint64(eval_const(node.rhs)))
+		}
+		return bool_to_int(eval_const(node.lhs) <= eval_const(node.rhs))
+	case ND_LOGAND:
+		return bool_to_int(eval_const(node.lhs) != 0 && eval_const(node.rhs) != 0)
+	case ND_LOGOR:
+		return bool_to_int(eval_const(node.lhs) != 0 || eval_const(node.rhs) != 0)
+	case '?':
+		if node.cond == nil {
+			if val := eval_addr_const(node.then, label); val != 0 || (label != nil && *label != "") {
+				return val
+			}
+		} else if eval_const(node.cond) != 0 {
+			return eval_addr_const(node.then, label)
+		}
+		return eval_addr_const(node.els, label)
+	case ',':
+		return eval_addr_const(node.rhs, label)
+	case ND_CAST:
+		{
+			if is_flonum(node.expr.ty) {
+				if node.ty.ty == BOOL {
+					return bool_to_int(eval_double(node.expr) != 0)
+				}
+				return cast_val(int(eval_double(node.expr)), node.ty)
+			}
+			val := eval_addr_const(node.expr, label)
+			if label != nil && *label != "" {
+				// An address is never null.
+				if node.ty.ty == BOOL {
+					*label = ""
+					return 1
+				}
+				return val
+			}
+			return cast_val(val, node.ty)
+		}
+	case ND_NEG:
+		val := eval_const(node.expr)
+		check_overflow(node, nil, val, 0, -val)
+		return -val
+	case '!':
+		return bool_to_int(eval_const(node.expr) == 0)
+	case '~':
+		return ^eval_const(node.expr)
+	case ND_ADDR:
+		if label != nil {
+			return eval_addr(node.expr, label)
+		}
+	case ND_GVAR:
+		// A function designator is its address.
+		if label != nil && node.ty.ty == FUNC {
+			*label = node.name
+			return 0
+		}
+	}
+	bad_node(node, "not a compile-time constant")
+	return 0
+}
+
+// Warns if a signed integer operation in a constant expression
+// overflows. val is the result of lhs op rhs computed in 64 bits,
+// which is exact for narrower types. Offsets from addresses are not
+// checked.
+func check_overflow(node *Node, label *string, lhs, rhs, val int) {
+	ty := node.ty
+	if (label != nil && *label != "") || ty == nil || !is_integer(ty) || ty.is_unsigned {
+		return
+	}
+
+	ovf := false
+	if ty.size < 8 {
+		ovf = val != cast_val(val, ty)
+	} else {
+		switch node.op {
+		case '+':
+			ovf = (lhs < 0) == (rhs < 0) && (val < 0) != (lhs < 0)
+		case '-':
+			ovf = (lhs < 0) != (rhs < 0) && (val < 0) != (lhs < 0)
+		case '*':
+			ovf = lhs != 0 && (val/lhs != rhs || (lhs == -1 && rhs == math.MinInt64))
+		case ND_NEG:
+			ovf = lhs == math.MinInt64
+		}
+	}
+	if ovf {
+		// Operands are promoted, so the type is int or long.
+		name := "int"
+		if ty.size == 8 {
+			name = "long"
+		}
+		warn_node(W_OVERFLOW, node, format("integer overflow in expression of type '%s'", name))
+	}
+}
+
+func eval_addr(node *Node, label *string) int {
+	switch node.op {
+	case ND_GVAR:
+		// The address of a thread-local variable differs by thread.
+		if node.is_tls {
+			bad_node(node, "not a compile-time constant")
+		}
+		*label = node.name
+		return 0
+	case ND_DEREF:
+		return eval_addr_const(node.expr, label)
+	case ND_DOT:
+		return eval_addr(node.expr, label) + node.offset
+	}
+	bad_node(node, "not a compile-time constant")
+	return 0
+}
+
+// A static local variable is a global variable with a unique name,
+// which is visible only in its block.
+func static_local(node *Node) {
+	v := new_global(node.ty, format("%s.%d", node.name, static_label), "", 0)
+	static_label++
+	v.is_static = true
+	v.is_tls = node.is_tls
+	v.is_rodata = is_const_obj(node.ty)
+	v.align = node.align
+	v.attrs = node.attrs
+	vec_push(globals, v)
+	declare_local(node, v)
+
+	if node.init != nil {
+		items := init_items(node)
+		v.ty = node.ty
+		init_global(v, items)
+	}
+	if v.ty.ty == ARY && v.ty.len < 0 {
+		bad_node(node, format("array size missing: %s", node.name))
+	}
+}
+
+// Decides the linkage of each function. A function is local to this
+// file if it is declared static, or if all of its declarations are
+// inline without extern, in which case the definition is an inline
+// definition and another file provides the external one.
+func func_linkage(nodes *Vector) {
+	is_static := new_map()
+	is_external := new_map()
+	for i := 0; i < nodes.len; i++ {
+		node := nodes.data[i].(*Node)
+		if node.op != ND_FUNC && node.op != ND_DECL {
+			continue
+		}
+		if node.is_static {
+			map_put(is_static, node.name, true)
+		}
+		if node.is_extern || !node.is_inline {
+			map_put(is_external, node.name, true)
+		}
+	}
+
+	for i := 0; i < nodes.len; i++ {
+		node := nodes.data[i].(*Node)
+		if node.op == ND_FUNC {
+			node.is_static = map_get(is_static, node.name) != nil ||
+				map_get(is_external, node.name) == nil
+		}
+	}
+}
+
 func Sema(nodes *Vector) *Vector {
 	env = new_env(nil)
 	globals = new_vec()
+	func_linkage(nodes)
 
-	for i := 0; i < nodes.len; i++ {
-		node := nodes.data[i].(*Node)
+	guard(func() {
+		for i := 0; i < nodes.len; i++ {
+			walk_toplevel(nodes.data[i].(*Node))
+		}
+		check_unused(nodes)
+	})
+	return globals
+}
+
+// Analyzes a declaration or a function definition at file scope.
+// After an error, the analysis continues with the next one.
+func walk_toplevel(node *Node) {
+	orig := env
+	defer func() {
+		if r := recover(); r != nil {
+			recovered(r)
+			env = orig
+		}
+	}()
+
+	if node.op == ND_VARDEF {
+		v := new_global(node.ty, node.name, node.data, node.len)
+		v.is_extern = node.is_extern
+		v.is_static = node.is_static
+		v.is_tls = node.is_tls
+		v.is_rodata = is_const_obj(node.ty)
+		v.align = node.align
+		v.attrs = node.attrs
+		v.used = node.used
+		vec_push(globals, v)
+		declare_global(node, v)
+
+		if node.init != nil {
+			items := init_items(node)
+			v.ty = node.ty
+			init_global(v, items)
+		}
+		return
+	}
+
+	//assert(node.op == ND_FUNC || node.op == ND_FUNC)
+
+	v := new_global(node.ty, node.name, "", 0)
+	v.is_tls = node.is_tls
+	v.is_noreturn = node.is_noreturn
+	v.attrs = node.attrs
+	v.used = node.used
+	declare_global(node, v)
+	node.is_noreturn = v.is_noreturn
+	node.attrs = v.attrs
 
-		if node.op == ND_VARDEF {
-			v := new_global(node.ty, node.name, node.data, node.len)
-			v.is_extern = node.is_extern
+	if node.op == ND_DECL {
+		// A weak reference is declared in the assembly even if
+		// the function is not defined.
+		if v.attrs != nil && v.attrs.is_weak {
+			v.is_extern = true
 			vec_push(globals, v)
-			map_put(env.vars, node.name, v)
+		}
+		return
+	}
+
+	cur_fn = node
+	ret_ty = node.ty.returning
+	stacksize = 0
+	frame_align = 16
+
+	// A variadic function spills its argument registers to the
+	// register save area in its prologue: 6 general-purpose
+	// registers (48 bytes) followed by 8 vector registers
+	// (128 bytes).
+	if node.ty.is_variadic {
+		stacksize += 176
+		node.va_area = stacksize
+	}
+
+	// A struct return value is copied to a buffer, from which
+	// it is loaded to registers. If it is returned in memory,
+	// the buffer holds the address of the caller's one instead.
+	if ret_ty.ty == STRUCT {
+		node.ret_buf = alloc_temp(ret_ty)
+	}
+
+	// Parameters are in the scope of the function.
+	env = new_env(env)
+	for i := 0; i < node.args.len; i++ {
+		// A struct parameter passed in registers is stored by
+		// eightbytes, so its area is padded.
+		arg := node.args.data[i].(*Node)
+		if arg.ty.ty == STRUCT {
+			stacksize += roundup(arg.ty.size, 8) - arg.ty.size
+		}
+		node.args.data[i] = walk(arg, true)
+		if v := map_get(env.vars, arg.name); v != nil {
+			v.(*Var).is_param = true
+		}
+	}
+	nerr := nerrors
+	node.body = walk(node.body, true)
+	leave_scope()
+	node.stacksize = stacksize
+	node.frame_align = frame_align
+
+	// Statements with errors have been replaced with null
+	// statements, so the flow of the function is not checked.
+	if nerrors > nerr {
+		return
+	}
+	if flows_out(node.body) {
+		if node.is_noreturn {
+			warn_token(W_INVALID_NORETURN, node.body.end, "'noreturn' function does return")
+		} else if ret_ty.ty != VOID && node.name != "main" {
+			warn_token(W_RETURN_TYPE, node.body.end, "control reaches end of non-void function")
+		}
+	}
+	check_uninit(node)
+}
+
+// Reports the static functions and variables of this file that have
+// never been used.
+func check_unused(nodes *Vector) {
+	for i := 0; i < nodes.len; i++ {
+		node := nodes.data[i].(*Node)
+		if !node.is_static || node.is_inline || node.op == ND_DECL {
+			continue
+		}
+		v := map_get(env.vars, node.name)
+		if v == nil || v.(*Var).used {
 			continue
 		}
+		w := W_UNUSED_VARIABLE
+		if node.op == ND_FUNC {
+			w = W_UNUSED_FUNCTION
+		}
+		warn_node(w, node, format("'%s' defined but not used", node.name))
+	}
+}
 
-		//assert(node.op == ND_FUNC || node.op == ND_FUNC)
+// A call to a _Noreturn function, possibly cast to void.
+func is_noreturn_call(node *Node) bool {
+	for node.op == ND_CAST {
+		node = node.expr
+	}
+	return node.op == ND_CALL && node.is_noreturn
+}
 
-		v := new_global(node.ty, node.name, "", 0)
-		map_put(env.vars, node.name, v)
+// Compares two case values as values of the switch operand type.
+func case_le(a, b int, ty *Type) bool {
+	if ty.is_unsigned {
+		return uint64(a) <= uint64(b)
+	}
+	return a <= b
+}
 
-		if node.op == ND_DECL {
+// Selects the association of _Generic whose type is compatible with
+// the type of the controlling expression, after array and function
+// to pointer conversions and without qualifiers. The controlling
+// expression is not evaluated.
+func generic_assoc(node *Node) *Node {
+	ty := unqual(walk(node.expr, true).ty)
+	var sel, def *Node
+	for i := 0; i < node.args.len; i++ {
+		a := node.args.data[i].(*Node)
+		if a.ty == nil {
+			if def != nil {
+				bad_node(a, "duplicate 'default' case in '_Generic'")
+			}
+			def = a
 			continue
 		}
+		if a.ty.ty == FUNC || a.ty.ty == VOID || (a.ty.ty == ARY && a.ty.len < 0) {
+			bad_node(a, "'_Generic' association has incomplete or function type")
+		}
+		for j := 0; j < i; j++ {
+			b := node.args.data[j].(*Node)
+			if b.ty != nil && is_compatible(a.ty, b.ty) {
+				bad_node(a, "'_Generic' specifies two compatible types")
+			}
+		}
+		if is_compatible(a.ty, ty) {
+			sel = a
+		}
+	}
+	if sel == nil {
+		sel = def
+	}
+	if sel == nil {
+		bad_node(node.expr, "'_Generic' selector is not compatible with any association")
+	}
+	return sel.expr
+}
 
-		stacksize = 0
+// Reports whether control can reach the end of a statement. A call
+// to a _Noreturn function does not return. With -Wunreachable-code,
+// statements that cannot be reached are reported.
+func flows_out(node *Node) bool {
+	switch node.op {
+	case ND_RETURN, ND_BREAK, ND_CONTINUE:
+		return false
+	case ND_EXPR_STMT:
+		return !is_noreturn_call(node.expr)
+	case ND_COMP_STMT:
+		reachable := true
+		for i := 0; i < node.stmts.len; i++ {
+			s := node.stmts.data[i].(*Node)
+			// A case label can be reached from its switch.
+			if s.op == ND_CASE {
+				reachable = true
+			}
+			if reachable {
+				reachable = flows_out(s)
+				continue
+			}
+			if is_code(s) {
+				warn_node(W_UNREACHABLE_CODE, s, "will never be executed")
+				for i+1 < node.stmts.len && node.stmts.data[i+1].(*Node).op != ND_CASE {
+					i++
+				}
+			}
+		}
+		return reachable
+	case ND_IF:
+		then := flows_out(node.then)
+		els := node.els == nil || flows_out(node.els)
+		return then || els
+	case ND_FOR:
+		flows_out(node.body)
+		if node.cond == nil || is_true_const(node.cond) {
+			return has_break(node.body)
+		}
+		return true
+	case ND_DO_WHILE:
+		body := flows_out(node.body)
+		if is_true_const(node.cond) {
+			return has_break(node.body)
+		}
+		return body || has_break(node.body) || has_continue(node.body)
+	case ND_SWITCH:
+		body := flows_out(node.body)
+		return body || node.default_case == nil || has_break(node.body)
+	case ND_CASE:
+		return flows_out(node.body)
+	}
+	return true
+}
 
-		for i := 0; i < node.args.len; i++ {
-			node.args.data[i] = walk(node.args.data[i].(*Node), true)
+// Statements that only declare something are not code that can be
+// unreachable, and neither is a "break" after a "return" in a switch.
+func is_code(node *Node) bool {
+	switch node.op {
+	case ND_NULL, ND_BREAK:
+		return false
+	case ND_VARDEF:
+		return node.init != nil
+	case ND_DECL_LIST:
+		for i := 0; i < node.stmts.len; i++ {
+			if is_code(node.stmts.data[i].(*Node)) {
+				return true
+			}
 		}
-		node.body = walk(node.body, true)
+		return false
+	}
+	return true
+}
 
-		node.stacksize = stacksize
+func is_true_const(node *Node) bool {
+	for node.op == ND_CAST {
+		node = node.expr
 	}
+	return node.op == ND_NUM && node.val != 0
+}
 
-	return globals
+// Reports whether the body of a loop or switch has a "break" that
+// leaves it. A break in a nested loop or switch leaves that one.
+func has_break(node *Node) bool {
+	switch node.op {
+	case ND_BREAK:
+		return true
+	case ND_FOR, ND_DO_WHILE, ND_SWITCH:
+		return false
+	}
+	return has_stmt(node, has_break)
+}
+
+// Reports whether a statement has a "continue" of the loop it is the
+// body of.
+func has_continue(node *Node) bool {
+	switch node.op {
+	case ND_CONTINUE:
+		return true
+	case ND_FOR, ND_DO_WHILE:
+		return false
+	}
+	return has_stmt(node, has_continue)
+}
+
+// Reports whether any substatement of a statement satisfies f.
+func has_stmt(node *Node, f func(*Node) bool) bool {
+	switch node.op {
+	case ND_COMP_STMT:
+		for i := 0; i < node.stmts.len; i++ {
+			if f(node.stmts.data[i].(*Node)) {
+				return true
+			}
+		}
+	case ND_IF:
+		return f(node.then) || (node.els != nil && f(node.els))
+	case ND_SWITCH, ND_CASE:
+		return f(node.body)
+	}
+	return false
 }
@@ -2,7 +2,6 @@ package go9cc
 
 import (
 	"fmt"
-	"log"
 	"os"
 	"strconv"
 	"strings"
@@ -13,24 +12,68 @@ const symbols_c = "+-*/;=(),{}<>[]&.!?:|^%~#"
 var (
 	keywords = map[string]int{
 		"_Alignof": TK_ALIGNOF,
+		"_Alignas": TK_ALIGNAS,
+		"_Atomic":  TK_ATOMIC,
+		"_Generic": TK_GENERIC,
+		"_Noreturn": TK_NORETURN,
 		"_Bool":    TK_BOOL,
+		"_Static_assert": TK_SASSERT,
+		"_Thread_local": TK_THREAD,
+		"__thread": TK_THREAD,
+		"__auto_type": TK_AUTO,
+		"alignas":  TK_ALIGNAS,
+		"alignof":  TK_ALIGNOF,
+		"auto":     TK_AUTO,
+		"bool":     TK_BOOL,
 		"break":    TK_BREAK,
 		"case":     TK_CASE,
+		"__asm":    TK_ASM,
+		"__asm__":  TK_ASM,
+		"__attribute":   TK_ATTRIBUTE,
+		"__attribute__": TK_ATTRIBUTE,
+		"__extension__": TK_EXTENSION,
+		"__inline": TK_INLINE,
+		"__inline__": TK_INLINE,
+		"__restrict": TK_RESTRICT,
+		"__restrict__": TK_RESTRICT,
+		"__typeof": TK_TYPEOF,
+		"__typeof__": TK_TYPEOF,
+		"asm":      TK_ASM,
 		"char":     TK_CHAR,
+		"const":    TK_CONST,
 		"continue": TK_CONTINUE,
+		"default":  TK_DEFAULT,
 		"do":       TK_DO,
+		"double":   TK_DOUBLE,
 		"else":     TK_ELSE,
+		"enum":     TK_ENUM,
 		"extern":   TK_EXTERN,
+		"false":    TK_FALSE,
+		"float":    TK_FLOAT,
 		"for":      TK_FOR,
 		"if":       TK_IF,
+		"inline":   TK_INLINE,
 		"int":      TK_INT,
+		"long":     TK_LONG,
+		"register": TK_REGISTER,
+		"restrict": TK_RESTRICT,
 		"return":   TK_RETURN,
+		"short":    TK_SHORT,
+		"signed":   TK_SIGNED,
 		"sizeof":   TK_SIZEOF,
+		"static":   TK_STATIC,
+		"static_assert": TK_SASSERT,
 		"struct":   TK_STRUCT,
 		"switch":   TK_SWITCH,
+		"thread_local": TK_THREAD,
+		"true":     TK_TRUE,
 		"typedef":  TK_TYPEDEF,
 		"typeof":   TK_TYPEOF,
+		"typeof_unqual": TK_UNQUAL,
+		"union":    TK_UNION,
+		"unsigned": TK_UNSIGNED,
 		"void":     TK_VOID,
+		"volatile": TK_VOLATILE,
 		"while":    TK_WHILE,
 	}
 
@@ -57,6 +100,7 @@ var (
 	}
 
 	symbols_3 = map[string]int{
+		"...": TK_ELLIPSIS,
 		"<<=": TK_SHL_EQ,
 		">>=": TK_SHR_EQ,
 	}
@@ -92,7 +136,7 @@ func read_file(path string) string {
 	if path != "-" {
 		f2, err := os.Open(path)
 		if err != nil {
-			log.Fatal(err)
+			ErrorReport("%s", err)
 		}
 		f = f2
 		defer f2.Close()
@@ -129,53 +173,6 @@ func new_ctx(next *Context, path, buf string) *Context {
 	return ctx
 }
 
-// Error reporting
-
-// Finds a line pointed by a given pointer from the input line
-// to print it out.
-func print_line(buf string, path string, pos int) {
-	curline, s := buf, buf
-	line, col := 0, 0
-	pos_ := buf[pos:]
-
-	for i, c := range buf {
-
-		if c == '\n' {
-			curline = buf[i+1:]
-			line++
-			col = 0
-			s = buf[i+1:]
-			continue
-		}
-
-		if s != pos_ {
-			col++
-			s = buf[i+1:]
-			continue
-		}
-
-		fmt.Fprintf(os.Stderr, "errorReport at %s:%d:%d\n\n", path, line+1, col+1)
-		for i, c2 := range curline {
-			if c2 == '\n' {
-				curline = curline[:i]
-				break
-			}
-		}
-		fmt.Fprintf(os.Stderr, "%s\n", curline)
-
-		for i := 0; i < col-1; i++ {
-			fmt.Fprintf(os.Stderr, " ")
-		}
-		fmt.Fprintf(os.Stderr, "^\n\n")
-		return
-	}
-}
-
-func bad_token(t *Token, msg string) {
-	print_line(t.ctx.buf, t.ctx.path, t.start)
-	ErrorReport(msg)
-}
-
 func tokstr(t *Token) string {
 	// assert(t.start && t.end)
 	buf := t.ctx.buf
@@ -211,14 +208,16 @@ func (ctx *Context) add_t(ty, start int) *Token {
 func (ctx *Context) block_comment(idx int) int {
 	buf := ctx.buf
 	ll := len(buf)
+	start := idx
 	for ; idx < ll; idx++ {
 		if startswith("*/", idx, buf) {
 			return idx + 2
 		}
 	}
 
-	ErrorReport("unclosed comment")
-	return -1
+	// The rest of the file is skipped.
+	ctx.report_error(start, start+2, "unclosed comment")
+	return ll
 }
 
 func (ctx *Context) c_char(val *int, idx int) int {
@@ -275,7 +274,12 @@ func (ctx *Context) char_literal(idx int) int {
 
 	char := buf[idx]
 	if char != '\'' {
-		ErrorReport("unclosed character literal")
+		ctx.report_error(t.start-1, idx, "unclosed character literal")
+		for buf[idx] != '\n' {
+			idx++
+		}
+		t.end = idx
+		return idx
 	}
 	idx += 1
 	t.end = idx
@@ -293,7 +297,7 @@ func (ctx *Context) string_literal(idx int) int {
 	for char != '"' {
 		tmp := 0
 		idx = ctx.c_char(&tmp, idx)
-		sb_add(sb, string(tmp))
+		sb_add(sb, string([]byte{byte(tmp)}))
 
 		if idx >= ll {
 			bad_token(t, "unclosed string literal")
@@ -313,10 +317,10 @@ func (ctx *Context) string_literal(idx int) int {
 func (ctx *Context) ident_t(idx int) int {
 	buf := ctx.buf
 	ilen := 1
-	char := buf[ilen]
+	char := buf[idx+ilen]
 	for isalpha_char(char) || isdigit_char(char) || char == '_' {
 		ilen++
-		char = buf[ilen]
+		char = buf[idx+ilen]
 	}
 
 	name := buf[idx : idx+ilen]
@@ -390,24 +394,152 @@ func (ctx *Context) decimal(idx int) int {
 	return idx
 }
 
+// Returns true if the number at idx is a floating-point literal,
+// i.e. it has a decimal point or an exponent.
+func is_float_literal(buf string, idx int) bool {
+	hex := startswith("0x", idx, buf) || startswith("0X", idx, buf)
+	if hex {
+		idx += 2
+	}
+	for ; idx < len(buf); idx++ {
+		c := buf[idx]
+		switch {
+		case c == '.':
+			return true
+		case !hex && (c == 'e' || c == 'E'):
+			return true
+		case hex && (c == 'p' || c == 'P'):
+			return true
+		case isalpha_char(c) || isdigit_char(c):
+			continue
+		}
+		return false
+	}
+	return false
+}
+
+// Reads a floating-point literal such as "1.5", ".5e-3", "2.f"
+// or "0x1.8p3".
+func (ctx *Context) float_number(idx int) int {
+	buf := ctx.buf
+	t := ctx.add_t(TK_NUM, idx)
+	t.is_float = true
+
+	start := idx
+	hex := startswith("0x", idx, buf) || startswith("0X", idx, buf)
+	if hex {
+		idx += 2
+	}
+	for idx < len(buf) {
+		c := buf[idx]
+		exp := (!hex && (c == 'e' || c == 'E')) || (hex && (c == 'p' || c == 'P'))
+		if exp && (buf[idx+1] == '+' || buf[idx+1] == '-') {
+			idx += 2
+			continue
+		}
+		if c == '.' || (hex && isxdigit_char(c)) || isdigit_char(c) || exp {
+			idx++
+			continue
+		}
+		break
+	}
+
+	val, err := strconv.ParseFloat(buf[start:idx], 64)
+	if err != nil {
+		bad_token(t, "invalid floating-point literal")
+	}
+	t.fval = val
+
+	switch buf[idx] {
+	case 'f', 'F':
+		t.is_single = true
+		idx++
+	case 'l', 'L':
+		t.is_long = true
+		idx++
+	}
+	if isalpha_char(buf[idx]) || isdigit_char(buf[idx]) {
+		bad_token(t, "invalid floating-point suffix")
+	}
+	t.end = idx
+	return idx
+}
+
 func (ctx *Context) number(idx int) int {
 	buf := ctx.buf
+	if is_float_literal(buf, idx) {
+		return ctx.float_number(idx)
+	}
+
 	if startswith("0x", idx, buf) || startswith("0X", idx, buf) {
-		return ctx.hexadecimal(idx)
+		idx = ctx.hexadecimal(idx)
+	} else if buf[idx] == '0' {
+		idx = ctx.octal(idx)
+	} else {
+		idx = ctx.decimal(idx)
+		ctx.tokens.data[ctx.tokens.len-1].(*Token).is_decimal = true
 	}
+	return ctx.int_suffix(idx)
+}
 
-	char := buf[idx]
-	if char == '0' {
-		return ctx.octal(idx)
+// Reads an integer suffix such as "u", "l", "ul" or "llu".
+func (ctx *Context) int_suffix(idx int) int {
+	buf := ctx.buf
+	t := ctx.tokens.data[ctx.tokens.len-1].(*Token)
+
+	if buf[idx] == 'u' || buf[idx] == 'U' {
+		t.is_unsigned = true
+		idx++
 	}
+	if startswith("ll", idx, buf) || startswith("LL", idx, buf) {
+		t.is_long = true
+		idx += 2
+	} else if buf[idx] == 'l' || buf[idx] == 'L' {
+		t.is_long = true
+		idx++
+	}
+	if !t.is_unsigned && (buf[idx] == 'u' || buf[idx] == 'U') {
+		t.is_unsigned = true
+		idx++
+	}
+
+	if isalpha_char(buf[idx]) || isdigit_char(buf[idx]) {
+		bad_token(t, "invalid integer suffix")
+	}
+	t.end = idx
+	return idx
+}
 
-	return ctx.decimal(idx)
+// Reports an error at buf[start:end] that does not stop the
+// tokenizer.
+func (ctx *Context) report_error(start, end int, msg string) {
+	loc := &Loc{ctx: ctx, pos: start, start: start, end: end}
+	report(new_diag(SEV_ERROR, loc, msg))
 }
 
 // Tokenized input is stored to this array
 func (ctx *Context) scan() {
-	buf := ctx.buf
 	idx := 0
+	for idx < len(ctx.buf) {
+		idx = ctx.scan_from(idx)
+	}
+}
+
+// Scans tokens from buf[idx]. If a token is malformed, it is dropped
+// and the scan is resumed at the end of its line.
+func (ctx *Context) scan_from(idx int) (next int) {
+	defer func() {
+		if r := recover(); r != nil {
+			recovered(r)
+			ctx.tokens.len--
+			next = ctx.tokens.data[ctx.tokens.len].(*Token).start
+			for next < len(ctx.buf) && ctx.buf[next] != '\n' {
+				next++
+			}
+		}
+	}()
+
+	buf := ctx.buf
 	ll := len(buf)
 	for idx < ll {
 		char := buf[idx]
@@ -445,9 +577,9 @@ func (ctx *Context) scan() {
 			continue
 		}
 
-		if idx+1 < ll {
-			symbol := buf[idx : idx+2]
-			ty, ok := symbols_2[symbol]
+		if idx+2 < ll {
+			symbol := buf[idx : idx+3]
+			ty, ok := symbols_3[symbol]
 			if ok {
 				t := ctx.add_t(ty, idx)
 				idx += len(symbol)
@@ -456,9 +588,9 @@ func (ctx *Context) scan() {
 			}
 		}
 
-		if idx+2 < ll {
-			symbol := buf[idx : idx+3]
-			ty, ok := symbols_3[symbol]
+		if idx+1 < ll {
+			symbol := buf[idx : idx+2]
+			ty, ok := symbols_2[symbol]
 			if ok {
 				t := ctx.add_t(ty, idx)
 				idx += len(symbol)
@@ -467,6 +599,12 @@ func (ctx *Context) scan() {
 			}
 		}
 
+		// A floating-point literal may start with '.' (e.g. ".5").
+		if char == '.' && isdigit_char(buf[idx+1]) {
+			idx = ctx.number(idx)
+			continue
+		}
+
 		if strchr("+-*/;=(),{}<>[]&.!?:|^%~#", char) >= 0 {
 			t := ctx.add_t(int(char), idx)
 			idx += 1
@@ -484,9 +622,10 @@ func (ctx *Context) scan() {
 			continue
 		}
 
-		print_line(ctx.buf, ctx.path, idx)
-		ErrorReport("cannot Tokenize")
+		ctx.report_error(idx, idx+1, "cannot Tokenize")
+		idx++
 	}
+	return idx
 }
 
 func canonicalize_newline(p string) string {
@@ -539,8 +678,19 @@ func join_string_literals(tokens *Vector) *Vector {
 	return v
 }
 
+// Errors are reported to the diagnostics engine. The result is nil
+// if the file cannot be read or too many errors are found.
 func Tokenize(path string, add_eof bool, ctx *Context) *Vector {
-	buf := read_file(path)
+	var v *Vector
+	guard(func() { v = tokenize_file(path, add_eof, ctx) })
+	return v
+}
+
+func tokenize_file(path string, add_eof bool, ctx *Context) *Vector {
+	return tokenize_buf(path, read_file(path), add_eof, ctx)
+}
+
+func tokenize_buf(path, buf string, add_eof bool, ctx *Context) *Vector {
 	buf = canonicalize_newline(buf)
 	buf = remove_backslash_newline(buf)
 	buf = remove_pragma_newline(buf)
@@ -605,6 +755,35 @@ func Print_tokens(tokens *Vector) {
 		TK_TYPEOF:  "TK_TYPEOF  ",
 		TK_PARAM:   "TK_PARAM    ",
 		TK_EOF:     "TK_EOF      ",
+		TK_ELLIPSIS: "TK_ELLIPSIS ",
+		TK_SHORT:    "TK_SHORT    ",
+		TK_LONG:     "TK_LONG     ",
+		TK_SIGNED:   "TK_SIGNED   ",
+		TK_UNSIGNED: "TK_UNSIGNED ",
+		TK_FLOAT:    "TK_FLOAT    ",
+		TK_DOUBLE:   "TK_DOUBLE   ",
+		TK_TRUE:     "TK_TRUE     ",
+		TK_FALSE:    "TK_FALSE    ",
+		TK_UNQUAL:   "TK_UNQUAL   ",
+		TK_AUTO:     "TK_AUTO     ",
+		TK_CONST:    "TK_CONST    ",
+		TK_VOLATILE: "TK_VOLATILE ",
+		TK_RESTRICT: "TK_RESTRICT ",
+		TK_ATOMIC:   "TK_ATOMIC   ",
+		TK_STATIC:   "TK_STATIC   ",
+		TK_REGISTER: "TK_REGISTER ",
+		TK_INLINE:   "TK_INLINE   ",
+		TK_THREAD:   "TK_THREAD   ",
+		TK_UNION:    "TK_UNION    ",
+		TK_ENUM:     "TK_ENUM     ",
+		TK_DEFAULT:  "TK_DEFAULT  ",
+		TK_SASSERT:  "TK_SASSERT  ",
+		TK_ASM:      "TK_ASM      ",
+		TK_EXTENSION: "TK_EXTENSION",
+		TK_ATTRIBUTE: "TK_ATTRIBUTE",
+		TK_ALIGNAS:  "TK_ALIGNAS  ",
+		TK_NORETURN: "TK_NORETURN ",
+		TK_GENERIC:  "TK_GENERIC  ",
 	}
 	for i := 0; i < tokens.len; i++ {
 		t := tokens.data[i].(*Token)
@@ -0,0 +1,365 @@
+package go9cc
+
+// Analysis of uninitialized local variables
+//
+// After a function is analyzed by sema, its body is interpreted
+// abstractly to find out which local variables are initialized at
+// each point. The control flow of the language is structured (there
+// is no goto), so the flow graph follows the syntax tree: branches
+// are joined after "if", "?:", "&&" and "||", and loops are iterated
+// until the state at their heads does not change. "break" and
+// "continue" carry their state to the end and to the next iteration
+// of their loop.
+//
+// Only scalar variables whose addresses are never taken are tracked,
+// since a variable may be written through a pointer anywhere.
+
+// The state at a point of a function. For each tracked variable, def
+// says it is initialized on all paths that reach the point and maybe
+// says it is initialized on some path.
+type Flow struct {
+	dead  bool // The point cannot be reached.
+	def   []bool
+	maybe []bool
+}
+
+type UVar struct {
+	name     string
+	tok      *Token
+	reported bool
+}
+
+var (
+	uvars   []*UVar
+	uvar_of map[int]int // Offset to index of uvars
+
+	// Warnings are reported only in the last round of a loop.
+	flow_report bool
+
+	// States at "break" and "continue" of the innermost loop or
+	// switch, and at the entry of the innermost switch.
+	flow_breaks  *Flow
+	flow_conts   *Flow
+	switch_entry *Flow
+)
+
+func dead_flow() *Flow {
+	return &Flow{dead: true}
+}
+
+func new_flow() *Flow {
+	f := new(Flow)
+	f.def = make([]bool, len(uvars))
+	f.maybe = make([]bool, len(uvars))
+	return f
+}
+
+func copy_flow(f *Flow) *Flow {
+	if f.dead {
+		return dead_flow()
+	}
+	c := new_flow()
+	copy(c.def, f.def)
+	copy(c.maybe, f.maybe)
+	return c
+}
+
+// Merges the states of two paths.
+func join_flow(a, b *Flow) *Flow {
+	if a.dead {
+		return copy_flow(b)
+	}
+	if b.dead {
+		return copy_flow(a)
+	}
+	f := new_flow()
+	for i := range uvars {
+		f.def[i] = a.def[i] && b.def[i]
+		f.maybe[i] = a.maybe[i] || b.maybe[i]
+	}
+	return f
+}
+
+func flow_equal(a, b *Flow) bool {
+	if a.dead || b.dead {
+		return a.dead == b.dead
+	}
+	for i := range uvars {
+		if a.def[i] != b.def[i] || a.maybe[i] != b.maybe[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// Checks the local variables of a function definition.
+func check_uninit(fn *Node) {
+	if !is_enabled(W_UNINITIALIZED) && !is_enabled(W_MAYBE_UNINITIALIZED) {
+		return
+	}
+
+	addr_taken := make(map[int]bool)
+	find_addr_taken(fn.body, addr_taken)
+	uvars = nil
+	uvar_of = make(map[int]int)
+	find_uvars(fn.body, addr_taken)
+	if len(uvars) == 0 {
+		return
+	}
+
+	flow_report = true
+	flow_breaks, flow_conts, switch_entry = dead_flow(), dead_flow(), dead_flow()
+	flow_stmt(new_flow(), fn.body)
+}
+
+// Calls f for each child of a node.
+func each_child(node *Node, f func(*Node)) {
+	for _, c := range []*Node{node.lhs, node.rhs, node.expr, node.cond, node.then, node.els, node.init, node.body, node.inc} {
+		if c != nil {
+			f(c)
+		}
+	}
+	for _, v := range []*Vector{node.stmts, node.args, node.inits} {
+		if v == nil {
+			continue
+		}
+		for i := 0; i < v.len; i++ {
+			f(v.data[i].(*Node))
+		}
+	}
+}
+
+func find_addr_taken(node *Node, m map[int]bool) {
+	if node.op == ND_ADDR {
+		e := node.expr
+		for e.op == ND_DOT {
+			e = e.expr
+		}
+		if e.op == ND_LVAR {
+			m[e.offset] = true
+		}
+	}
+	each_child(node, func(c *Node) { find_addr_taken(c, m) })
+}
+
+func find_uvars(node *Node, addr_taken map[int]bool) {
+	// va_start refers to the parameters, which are initialized.
+	if node.op == ND_VA_START {
+		return
+	}
+	if node.op == ND_VARDEF && (is_arith(node.ty) || node.ty.ty == PTR) && !addr_taken[node.offset] {
+		uvar_of[node.offset] = len(uvars)
+		uvars = append(uvars, &UVar{name: node.name, tok: node.tok})
+	}
+	each_child(node, func(c *Node) { find_uvars(c, addr_taken) })
+}
+
+func flow_read(f *Flow, node *Node) {
+	i, ok := uvar_of[node.offset]
+	if !ok || f.dead || f.def[i] || !flow_report || uvars[i].reported {
+		return
+	}
+
+	v := uvars[i]
+	var d *Diag
+	if f.maybe[i] {
+		d = new_warning(W_MAYBE_UNINITIALIZED, node_loc(node), format("'%s' may be used uninitialized", v.name))
+	} else {
+		d = new_warning(W_UNINITIALIZED, node_loc(node), format("'%s' is used uninitialized", v.name))
+	}
+	if d == nil {
+		return
+	}
+	if v.tok != nil {
+		add_note(d, token_loc(v.tok), format("'%s' was declared here", v.name))
+	}
+	report(d)
+	v.reported = true
+}
+
+func flow_write(f *Flow, node *Node) {
+	if i, ok := uvar_of[node.offset]; ok && !f.dead {
+		f.def[i] = true
+		f.maybe[i] = true
+	}
+}
+
+// Analyzes an expression that is assigned to or whose address is
+// taken. The variable itself is not read.
+func flow_lvalue(f *Flow, node *Node) *Flow {
+	switch node.op {
+	case ND_LVAR:
+		return f
+	case ND_DOT:
+		return flow_lvalue(f, node.expr)
+	}
+	return flow_expr(f, node)
+}
+
+func flow_expr(f *Flow, node *Node) *Flow {
+	if f.dead {
+		return f
+	}
+
+	switch node.op {
+	case ND_LVAR:
+		flow_read(f, node)
+		return f
+	case '=':
+		f = flow_lvalue(f, node.lhs)
+		f = flow_expr(f, node.rhs)
+		if node.lhs.op == ND_LVAR {
+			flow_write(f, node.lhs)
+		}
+		return f
+	case ND_ADDR, ND_DOT:
+		return flow_lvalue(f, node.expr)
+	case ND_VA_START:
+		f = flow_expr(f, node.expr)
+		return flow_expr(f, node.rhs)
+	case ND_LOGAND, ND_LOGOR:
+		f = flow_expr(f, node.lhs)
+		rhs := flow_expr(copy_flow(f), node.rhs)
+		return join_flow(f, rhs)
+	case '?':
+		if node.cond == nil {
+			f = flow_expr(f, node.then)
+			return join_flow(f, flow_expr(copy_flow(f), node.els))
+		}
+		f = flow_expr(f, node.cond)
+		then := flow_expr(copy_flow(f), node.then)
+		els := flow_expr(f, node.els)
+		return join_flow(then, els)
+	case ND_STMT_EXPR:
+		f = flow_stmt(f, node.body)
+		if node.expr != nil {
+			f = flow_expr(f, node.expr)
+		}
+		return f
+	}
+
+	each_child(node, func(c *Node) { f = flow_expr(f, c) })
+	return f
+}
+
+func flow_stmt(f *Flow, node *Node) *Flow {
+	switch node.op {
+	case ND_VARDEF:
+		// A declaration in a loop is uninitialized in each round.
+		if i, ok := uvar_of[node.offset]; ok && !f.dead {
+			f.def[i] = false
+			f.maybe[i] = false
+		}
+		if node.inits != nil {
+			for i := 0; i < node.inits.len; i++ {
+				f = flow_expr(f, node.inits.data[i].(*Node))
+			}
+		}
+		return f
+	case ND_DECL_LIST, ND_COMP_STMT:
+		for i := 0; i < node.stmts.len; i++ {
+			f = flow_stmt(f, node.stmts.data[i].(*Node))
+		}
+		return f
+	case ND_EXPR_STMT:
+		f = flow_expr(f, node.expr)
+		if is_noreturn_call(node.expr) {
+			return dead_flow()
+		}
+		return f
+	case ND_RETURN:
+		if node.expr != nil {
+			f = flow_expr(f, node.expr)
+		}
+		return dead_flow()
+	case ND_BREAK:
+		flow_breaks = join_flow(flow_breaks, f)
+		return dead_flow()
+	case ND_CONTINUE:
+		flow_conts = join_flow(flow_conts, f)
+		return dead_flow()
+	case ND_IF:
+		f = flow_expr(f, node.cond)
+		then := flow_stmt(copy_flow(f), node.then)
+		if node.els != nil {
+			f = flow_stmt(f, node.els)
+		}
+		return join_flow(then, f)
+	case ND_FOR:
+		return flow_loop(flow_stmt(f, node.init), node)
+	case ND_DO_WHILE:
+		return flow_loop(f, node)
+	case ND_SWITCH:
+		{
+			f = flow_expr(f, node.cond)
+			orig_breaks, orig_entry := flow_breaks, switch_entry
+			flow_breaks, switch_entry = dead_flow(), f
+
+			// The body is entered only by the case labels.
+			out := flow_stmt(dead_flow(), node.body)
+			out = join_flow(out, flow_breaks)
+			if node.default_case == nil {
+				out = join_flow(out, f)
+			}
+			flow_breaks, switch_entry = orig_breaks, orig_entry
+			return out
+		}
+	case ND_CASE:
+		return flow_stmt(join_flow(f, switch_entry), node.body)
+	}
+	return f
+}
+
+// Analyzes a loop until the state at its head is stable, with
+// warnings disabled, and then once more with them.
+func flow_loop(entry *Flow, node *Node) *Flow {
+	orig := flow_report
+	flow_report = false
+	head := entry
+	for {
+		_, back := flow_round(head, node)
+		next := join_flow(entry, back)
+		if flow_equal(next, head) {
+			break
+		}
+		head = next
+	}
+	flow_report = orig
+
+	out, _ := flow_round(head, node)
+	return out
+}
+
+// Analyzes a round of a loop from the state at its head. Returns the
+// states after the loop and at the back edge.
+func flow_round(head *Flow, node *Node) (*Flow, *Flow) {
+	orig_breaks, orig_conts := flow_breaks, flow_conts
+	flow_breaks, flow_conts = dead_flow(), dead_flow()
+	defer func() {
+		flow_breaks, flow_conts = orig_breaks, orig_conts
+	}()
+
+	f := copy_flow(head)
+	exit := dead_flow()
+	if node.op == ND_FOR {
+		if node.cond != nil {
+			f = flow_expr(f, node.cond)
+			if !is_true_const(node.cond) {
+				exit = copy_flow(f)
+			}
+		}
+		f = flow_stmt(f, node.body)
+		f = join_flow(f, flow_conts)
+		if node.inc != nil {
+			f = flow_stmt(f, node.inc)
+		}
+	} else {
+		f = flow_stmt(f, node.body)
+		f = join_flow(f, flow_conts)
+		f = flow_expr(f, node.cond)
+		if !is_true_const(node.cond) {
+			exit = copy_flow(f)
+		}
+	}
+	return join_flow(exit, flow_breaks), f
+}
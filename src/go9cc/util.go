@@ -47,6 +47,13 @@ func sb_get(sb *StringBuilder) string {
 	return sb.data
 }
 
+func bool_to_int(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
 func roundup(x, align int) int {
 	return (x + align - 1) & ^(align - 1)
 }
@@ -142,7 +149,6 @@ func copy_type(src, dst *Type) {
 	dst.len = src.len
 	dst.size = src.size
 	dst.align = src.align
-	dst.offset = src.offset
 
 	// Type
 	copy_type(src.ptr_to, dst.ptr_to)
@@ -221,13 +227,6 @@ func vec_push(v *Vector, elem interface{}) {
 	v.len++
 }
 
-// An errorReport reporting function
-func ErrorReport(format string, a ...interface{}) {
-	fmt.Fprintf(os.Stderr, format, a...)
-	fmt.Fprintf(os.Stderr, "\n")
-	os.Exit(1)
-}
-
 func popCount(x uint) int {
 	ret := 0
 	for n := uint(0); n < uint(unsafe.Sizeof(x))*8; n++ {
@@ -315,6 +314,9 @@ func isalpha_char(c uint8) bool {
 }
 
 func startswith(str string, idx int, buf string) bool {
+	if idx+len(str) > len(buf) {
+		return false
+	}
 	tmp := buf[idx : idx+len(str)]
 	return tmp == str
 }
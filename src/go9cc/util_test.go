@@ -72,7 +72,7 @@ func Test_isgraph(t *testing.T) {
 	}
 
 	for _, c := range cases {
-		ret := isgraph(c.c)
+		ret := isgraph(uint8(c.c))
 		if ret != c.ret {
 			t.Errorf("c: %s, expected: %v, got: %v\n", string(c.c), ret, c.ret)
 		}
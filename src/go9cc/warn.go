@@ -0,0 +1,231 @@
+package go9cc
+
+// Named warnings. Each warning can be enabled by -W<name>, disabled
+// by -Wno-<name> and turned into an error by -Werror=<name>. Some are
+// enabled by default and others by -Wall or -Wextra.
+
+import "strings"
+
+const (
+	W_IMPLICIT_FUNCTION_DECLARATION = iota
+	W_INCOMPATIBLE_POINTER_TYPES
+	W_INT_CONVERSION
+	W_POINTER_INTEGER_COMPARE
+	W_COMPARE_DISTINCT_POINTER_TYPES
+	W_RETURN_TYPE
+	W_OVERFLOW
+	W_UNUSED_VARIABLE
+	W_UNUSED_FUNCTION
+	W_UNUSED_PARAMETER
+	W_SIGN_COMPARE
+	W_SHADOW
+	W_UNREACHABLE_CODE
+	W_UNINITIALIZED
+	W_MAYBE_UNINITIALIZED
+	W_INVALID_NORETURN
+	W_ATTRIBUTES
+	W_FORMAT
+	NUM_WARNINGS
+)
+
+// Warning levels
+const (
+	WL_DEFAULT  = iota // Enabled by default
+	WL_ALL             // Enabled by -Wall
+	WL_EXTRA           // Enabled by -Wextra
+	WL_EXPLICIT        // Enabled only by its own option
+)
+
+type Warning struct {
+	name  string
+	level int
+
+	// Set by options: 1 for on, -1 for off and 0 if not set.
+	enabled  int
+	is_error int
+}
+
+var (
+	warnings = [NUM_WARNINGS]Warning{
+		W_IMPLICIT_FUNCTION_DECLARATION:  {name: "implicit-function-declaration", level: WL_DEFAULT},
+		W_INCOMPATIBLE_POINTER_TYPES:     {name: "incompatible-pointer-types", level: WL_DEFAULT},
+		W_INT_CONVERSION:                 {name: "int-conversion", level: WL_DEFAULT},
+		W_POINTER_INTEGER_COMPARE:        {name: "pointer-integer-compare", level: WL_DEFAULT},
+		W_COMPARE_DISTINCT_POINTER_TYPES: {name: "compare-distinct-pointer-types", level: WL_DEFAULT},
+		W_RETURN_TYPE:                    {name: "return-type", level: WL_DEFAULT},
+		W_OVERFLOW:                       {name: "overflow", level: WL_DEFAULT},
+		W_UNUSED_VARIABLE:                {name: "unused-variable", level: WL_ALL},
+		W_UNUSED_FUNCTION:                {name: "unused-function", level: WL_ALL},
+		W_UNUSED_PARAMETER:               {name: "unused-parameter", level: WL_EXTRA},
+		W_SIGN_COMPARE:                   {name: "sign-compare", level: WL_EXTRA},
+		W_SHADOW:                         {name: "shadow", level: WL_EXPLICIT},
+		W_UNREACHABLE_CODE:               {name: "unreachable-code", level: WL_EXPLICIT},
+		W_UNINITIALIZED:                  {name: "uninitialized", level: WL_ALL},
+		W_MAYBE_UNINITIALIZED:            {name: "maybe-uninitialized", level: WL_ALL},
+		W_INVALID_NORETURN:               {name: "invalid-noreturn", level: WL_DEFAULT},
+		W_ATTRIBUTES:                     {name: "attributes", level: WL_DEFAULT},
+		W_FORMAT:                         {name: "format", level: WL_ALL},
+	}
+
+	// Groups of warnings that are controlled together.
+	warning_groups = map[string][]int{
+		"unused": {W_UNUSED_VARIABLE, W_UNUSED_FUNCTION},
+	}
+
+	wall     = false // -Wall
+	wextra   = false // -Wextra
+	werror   = false // -Werror
+	no_warns = false // -w
+
+	// Warnings are not reported while this is positive.
+	quiet = 0
+)
+
+func find_warning(name string) []int {
+	if g, ok := warning_groups[name]; ok {
+		return g
+	}
+	for i := range warnings {
+		if warnings[i].name == name {
+			return []int{i}
+		}
+	}
+	return nil
+}
+
+func is_enabled(w int) bool {
+	if no_warns || quiet > 0 {
+		return false
+	}
+	switch warnings[w].enabled {
+	case 1:
+		return true
+	case -1:
+		return false
+	}
+	switch warnings[w].level {
+	case WL_DEFAULT:
+		return true
+	case WL_ALL:
+		return wall || wextra
+	case WL_EXTRA:
+		return wextra
+	}
+	return false
+}
+
+func is_werror(w int) bool {
+	if warnings[w].is_error != 0 {
+		return warnings[w].is_error > 0
+	}
+	return werror
+}
+
+// Sets the state of a warning or a group of warnings to "on", "off"
+// or "error", as the Warn map of a build config does. The names
+// "all", "extra" and "error" stand for -Wall, -Wextra and -Werror.
+// Returns false for an unknown name or state.
+func Set_warning(name, state string) bool {
+	on := 0
+	switch state {
+	case "on", "error":
+		on = 1
+	case "off":
+		on = -1
+	default:
+		return false
+	}
+
+	flags := map[string]*bool{"all": &wall, "extra": &wextra, "error": &werror}
+	if flag, ok := flags[name]; ok {
+		if state == "error" {
+			return false
+		}
+		*flag = on > 0
+		return true
+	}
+
+	ws := find_warning(name)
+	if ws == nil {
+		return false
+	}
+	for _, w := range ws {
+		warnings[w].enabled = on
+		if state == "error" {
+			warnings[w].is_error = 1
+		} else if on < 0 {
+			warnings[w].is_error = 0
+		}
+	}
+	return true
+}
+
+// Handles a warning option: -w, -Wall, -Wextra, -Werror,
+// -Werror=<name>, -Wno-error=<name>, -W<name> or -Wno-<name>.
+// Returns false if opt is not a warning option. Like gcc, unknown
+// names after -Wno- are ignored.
+func Warning_option(opt string) bool {
+	switch opt {
+	case "-w":
+		no_warns = true
+		return true
+	case "-Wall":
+		wall = true
+		return true
+	case "-Wextra":
+		wextra = true
+		return true
+	case "-Werror":
+		werror = true
+		return true
+	case "-Wno-error":
+		werror = false
+		return true
+	}
+
+	if strings.HasPrefix(opt, "-Werror=") {
+		return Set_warning(strings.TrimPrefix(opt, "-Werror="), "error")
+	}
+	if strings.HasPrefix(opt, "-Wno-error=") {
+		ws := find_warning(strings.TrimPrefix(opt, "-Wno-error="))
+		for _, w := range ws {
+			warnings[w].is_error = -1
+		}
+		return ws != nil
+	}
+	if strings.HasPrefix(opt, "-Wno-") {
+		Set_warning(strings.TrimPrefix(opt, "-Wno-"), "off")
+		return true
+	}
+	if strings.HasPrefix(opt, "-W") {
+		return Set_warning(strings.TrimPrefix(opt, "-W"), "on")
+	}
+	return false
+}
+
+// Returns a diagnostic for a warning, or nil if it is disabled. A
+// warning turned into an error is counted as an error, but does not
+// stop the compilation.
+func new_warning(w int, loc *Loc, msg string) *Diag {
+	if !is_enabled(w) {
+		return nil
+	}
+	if is_werror(w) {
+		return new_diag(SEV_ERROR, loc, format("%s [-Werror=%s]", msg, warnings[w].name))
+	}
+	return new_diag(SEV_WARNING, loc, format("%s [-W%s]", msg, warnings[w].name))
+}
+
+func warn_at(w int, loc *Loc, msg string) {
+	if d := new_warning(w, loc, msg); d != nil {
+		report(d)
+	}
+}
+
+func warn_token(w int, t *Token, msg string) {
+	warn_at(w, token_loc(t), msg)
+}
+
+func warn_node(w int, node *Node, msg string) {
+	warn_at(w, node_loc(node), msg)
+}
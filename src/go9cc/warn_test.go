@@ -0,0 +1,82 @@
+package go9cc
+
+import "testing"
+
+func Test_warnings(t *testing.T) {
+	cases := []struct {
+		opts   []string
+		src    string
+		errors int
+		warns  int
+	}{
+		{nil, "int f() { int x; return 0; }\n", 0, 0},
+		{nil, "void g(int *p, long l);\nint f(int *p) { g(3, p); g(0, 0); return 0; }\n", 0, 2},
+		{[]string{"-Wall"}, "int f() { int x; return 0; }\n", 0, 1},
+		{[]string{"-Wall", "-Wno-unused-variable"}, "int f() { int x; return 0; }\n", 0, 0},
+		{[]string{"-Werror=unused-variable"}, "int f() { int x; return 0; }\n", 1, 0},
+		{[]string{"-Wall"}, "int f() { int x; return sizeof(x) + sizeof(typeof(x)); }\n", 0, 0},
+		{[]string{"-Wextra"}, "int f(int a, int b) { return a; }\n", 0, 1},
+		{[]string{"-Wall"}, "static int f() { return 0; }\nstatic int g() { return 0; }\nint h() { return g(); }\n", 0, 1},
+		{nil, "int f(int x) { if (x) return 1; }\n", 0, 1},
+		{nil, "int f(int x) { if (x) return 1 +; return 0; }\n", 1, 0},
+		{nil, "int f(int x) { if (x) return g; else return 1; }\n", 1, 0},
+		{[]string{"-Wuninitialized"}, "int f(int x) { int y; y = g; return y; }\n", 1, 0},
+		{nil, "int f(int x) { if (x) return 1; else return 2; }\n", 0, 0},
+		{nil, "int f(int x) { for (;;) if (x) return 1; }\n", 0, 0},
+		{nil, "int f(int x) { while (1) if (x) break; }\n", 0, 1},
+		{nil, "int f(int x) { switch (x) { case 1: return 1; default: return 0; } }\n", 0, 0},
+		{nil, "int f(int x) { switch (x) { case 1: return 1; } }\n", 0, 1},
+		{[]string{"-Wunreachable-code"}, "int f() { return 1; f(); }\n", 0, 1},
+		{[]string{"-Wunreachable-code"}, "int f(int x) { switch (x) { case 1: return 1; break; case 2: x++; } return x; }\n", 0, 0},
+		{[]string{"-Wextra"}, "int f(unsigned u, int i) { return u < i; }\n", 0, 1},
+		{[]string{"-Wextra"}, "int f(unsigned u, long l, unsigned char c) { return (u < 1) + (u < l) + (u < c); }\n", 0, 0},
+		{[]string{"-Wshadow"}, "int x; int f(int y) { int x = 1; { int y = 2; return x + y; } }\n", 0, 2},
+		{[]string{"-Wuninitialized"}, "int f() { int x; return x; }\n", 0, 1},
+		{[]string{"-Wall"}, "int f(int c) { int x; if (c) x = 1; else x = 2; return x; }\n", 0, 0},
+		{[]string{"-Wall"}, "int f(int c) { int x; if (c) x = 1; return x + x; }\n", 0, 1},
+		{[]string{"-Wall"}, "int f(int c) { int x; for (;;) { x = c; break; } return x; }\n", 0, 0},
+		{[]string{"-Wall"}, "int f(int n) { int s; for (int i = 0; i < n; i++) s = i; return s; }\n", 0, 1},
+		{[]string{"-Wall"}, "int f(int c) { int x; switch (c) { case 1: x = 1; break; default: x = 2; } return x; }\n", 0, 0},
+		{[]string{"-Wall"}, "int f() { int x; int *p = &x; *p = 1; return x; }\n", 0, 0},
+		{[]string{"-Wall"}, "int f() { int x; int y = ({ x = 1; x; }); return x + y; }\n", 0, 0},
+		{[]string{"-Wall"}, "int f(int c) { int x; return (c ?: (x = 1)) + x; }\n", 0, 1},
+		{[]string{"-Wall", "-Wno-maybe-uninitialized"}, "int f(int c) { int x; c && (x = 1); return x; }\n", 0, 0},
+		{nil, "_Noreturn void g(); int f(int x) { if (x) return 1; g(); }\n", 0, 0},
+		{nil, "void exit(int); int f(int x) { if (x) return 1; exit(1); }\n", 0, 0},
+		{nil, "_Noreturn int f(int x) { if (x) return 1; }\n", 0, 2},
+		{[]string{"-Wall"}, "void abort(); int f(int c) { int x; if (c) x = 1; else abort(); return x; }\n", 0, 0},
+		{nil, "int x __attribute__((foo, noinline, __packed__));\nint y [[vendor::bar]];\n", 0, 2},
+		{nil, "int x __attribute__((noreturn));\nvoid f() __attribute__((noreturn)); int g(int x) { if (x) return 1; f(); }\n", 0, 1},
+		{[]string{"-Wall", "-Wextra"}, "static int f(int x __attribute__((unused))) { [[maybe_unused]] int y; return 0; }\n", 0, 1},
+		{[]string{"-Wall", "-Wextra"}, "__attribute__((unused)) static int f(int x [[maybe_unused]]) { __attribute__((unused)) int y; return 0; }\n", 0, 0},
+		{[]string{"-Wall"}, "__attribute__((constructor)) static void f() {}\n", 0, 0},
+		{[]string{"-Wall"}, "void p(int, const char *, ...) __attribute__((format(printf, 2, 3)));\nvoid f() { p(1, \"%d %s %5.*f %%\", 1, \"a\", 2, 1.0f); p(1, \"%ld %p\", 1L, &f); }\n", 0, 0},
+		{[]string{"-Wall"}, "void p(int, const char *, ...) __attribute__((format(printf, 2, 3)));\nvoid f() { p(1, \"%d %s\", \"a\", 1); p(1, \"%d\"); p(1, \"%d\", 1, 2); p(1, \"%ld %y\", 1); }\n", 0, 6},
+		{nil, "void p(const char *, ...) __attribute__((format(printf, 1, 2)));\nvoid f() { p(\"%d\", \"a\"); }\n", 0, 0},
+		{[]string{"-Wall"}, "void p(const char *, ...) __attribute__((format(printf, 1, 2)));\nvoid f(long double x) { p(\"%Lf %f\", x, x); }\n", 0, 1},
+		{nil, "int a[2147483647 + 1 > 0];\n", 0, 1},
+		{[]string{"-w"}, "int a[2147483647 + 1 > 0];\n", 0, 0},
+		{[]string{"-Werror"}, "int a[-2147483647 - 1 < 0];\nlong b[-9223372036854775807L - 1 < 0];\n", 0, 0},
+	}
+
+	for _, c := range cases {
+		orig := warnings
+		for _, opt := range c.opts {
+			if !Warning_option(opt) {
+				t.Errorf("unknown option: %s\n", opt)
+			}
+		}
+		errors, warns := count_diags(t, c.src, 0)
+		if errors != c.errors || warns != c.warns {
+			t.Errorf("%v %q: expected %d errors and %d warnings, got: %d and %d\n", c.opts, c.src, c.errors, c.warns, errors, warns)
+		}
+		warnings = orig
+		wall, wextra, werror, no_warns = false, false, false, false
+	}
+
+	for _, opt := range []string{"-Wfoo", "-Werror=foo", "-O2"} {
+		if Warning_option(opt) {
+			t.Errorf("expected %s to be rejected\n", opt)
+		}
+	}
+}
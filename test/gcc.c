@@ -2,3 +2,140 @@
 
 int global_arr[1] = {5};
 
+
+int add10_gcc(int a, int b, int c, int d, int e, int f, int g, int h, int i, int j) {
+  return a + b*2 + c*3 + d*4 + e*5 + f*6 + g*7 + h*8 + i*9 + j*10;
+}
+
+int add10_9cc(int a, int b, int c, int d, int e, int f, int g, int h, int i, int j);
+
+int call_add10_9cc() { return add10_9cc(1, 2, 3, 4, 5, 6, 7, 8, 9, 10); }
+
+double fmix_gcc(double a, float b, int c, double d) { return a + b * c - d; }
+
+double fmix_9cc(double a, float b, int c, double d);
+
+double call_fmix_9cc() { return fmix_9cc(1.5, 2.0f, 3, 0.25); }
+
+_Bool bool_gcc(_Bool b) { return b; }
+
+static int helper_static(void) { return 2; }
+
+int call_helper_gcc() { return helper_static(); }
+
+_Thread_local int tls_gcc = 11;
+
+extern _Thread_local int tls_9cc;
+
+int get_tls_9cc_gcc() { return tls_9cc; }
+
+extern int g_9cc_var;
+
+int get_9cc_var_gcc() { return g_9cc_var; }
+
+struct bf1 { unsigned a : 3; unsigned b : 5; int c : 4; };
+struct bf2 { char x; int y : 20; int z : 20; };
+struct bf3 { char x; int : 0; char y; };
+struct bf4 { char x; int : 12; char y; };
+struct bf5 { long a : 40; unsigned long b : 24; _Bool f : 1; };
+struct bf6 { short a; int b : 17; char c : 3; };
+struct bfall { unsigned char a : 2; signed char b : 3; int c : 9; unsigned d : 30; long e : 33; _Bool f : 1; };
+
+int bf_size_gcc(int i) {
+  int sz[] = { sizeof(struct bf1), sizeof(struct bf2), sizeof(struct bf3), sizeof(struct bf4),
+               sizeof(struct bf5), sizeof(struct bf6), sizeof(struct bfall) };
+  return sz[i];
+}
+
+int bf_read_gcc(struct bfall *p, int i) {
+  switch (i) {
+  case 0: return p->a;
+  case 1: return p->b;
+  case 2: return p->c;
+  case 3: return p->d;
+  case 4: return p->e;
+  default: return p->f;
+  }
+}
+
+void bf_write_gcc(struct bfall *p) {
+  p->a = 2; p->b = 3; p->c = 255; p->d = 12345; p->e = -1; p->f = 0;
+}
+
+struct s1 { int a; int b; };
+struct s2 { long a; long b; };
+struct s3 { double x; double y; };
+struct s4 { int a; double d; };
+struct s5 { double d; char a; };
+struct s6 { char c[3]; };
+struct s7 { float f; float g; float h; };
+struct s8 { long a; long b; long c; };
+struct s9 { char c[20]; };
+
+long s1_gcc(struct s1 s) { return s.a * 10 + s.b; }
+long s2_gcc(struct s2 s) { return s.a * 10 + s.b; }
+double s3_gcc(struct s3 s) { return s.x * 10 + s.y; }
+double s4_gcc(struct s4 s) { return s.a * 10 + s.d; }
+double s5_gcc(struct s5 s) { return s.d * 10 + s.a; }
+int s6_gcc(struct s6 s) { return s.c[0] * 100 + s.c[1] * 10 + s.c[2]; }
+double s7_gcc(struct s7 s) { return s.f * 100 + s.g * 10 + s.h; }
+long s8_gcc(struct s8 s) { return s.a * 100 + s.b * 10 + s.c; }
+int s9_gcc(struct s9 s) { return s.c[0] + s.c[19]; }
+long s_many_gcc(long a, long b, long c, long d, long e, struct s2 s, long f) { return a + b + c + d + e + s.a * 10 + s.b * 100 + f * 1000; }
+double s_many_dbl_gcc(double a, double b, double c, double d, double e, double f, double g, struct s3 s, double h) { return a + b + c + d + e + f + g + s.x * 10 + s.y * 100 + h * 1000; }
+long s_mem_gcc(struct s8 s, int m, struct s1 t) { return s.a * 1000 + s.c * 100 + m * 10 + t.b; }
+
+struct s1 ret_s1_gcc(int a, int b) { struct s1 s = { a, b }; return s; }
+struct s2 ret_s2_gcc(long a, long b) { struct s2 s = { a, b }; return s; }
+struct s3 ret_s3_gcc(double x, double y) { struct s3 s = { x, y }; return s; }
+struct s4 ret_s4_gcc(int a, double d) { struct s4 s = { a, d }; return s; }
+struct s5 ret_s5_gcc(double d, int a) { struct s5 s = { d, a }; return s; }
+struct s6 ret_s6_gcc(int a) { struct s6 s = { a, a + 1, a + 2 }; return s; }
+struct s7 ret_s7_gcc(float f) { struct s7 s = { f, f * 2, f * 3 }; return s; }
+struct s8 ret_s8_gcc(long a) { struct s8 s = { a, a * 2, a * 3 }; return s; }
+struct s9 ret_s9_gcc(int a) { struct s9 s; for (int i = 0; i < 20; i++) s.c[i] = a + i; return s; }
+
+long s1_9cc(struct s1 s);
+long s2_9cc(struct s2 s);
+double s3_9cc(struct s3 s);
+double s4_9cc(struct s4 s);
+double s5_9cc(struct s5 s);
+int s6_9cc(struct s6 s);
+double s7_9cc(struct s7 s);
+long s8_9cc(struct s8 s);
+int s9_9cc(struct s9 s);
+long s_many_9cc(long a, long b, long c, long d, long e, struct s2 s, long f);
+double s_many_dbl_9cc(double a, double b, double c, double d, double e, double f, double g, struct s3 s, double h);
+long s_mem_9cc(struct s8 s, int m, struct s1 t);
+struct s1 ret_s1_9cc(int a, int b);
+struct s2 ret_s2_9cc(long a, long b);
+struct s3 ret_s3_9cc(double x, double y);
+struct s4 ret_s4_9cc(int a, double d);
+struct s5 ret_s5_9cc(double d, int a);
+struct s6 ret_s6_9cc(int a);
+struct s7 ret_s7_9cc(float f);
+struct s8 ret_s8_9cc(long a);
+struct s9 ret_s9_9cc(int a);
+
+int call_struct_9cc() {
+  struct s1 a = { 1, 2 }; if (s1_9cc(a) != 12) return 1;
+  struct s2 b = { 3, 4 }; if (s2_9cc(b) != 34) return 2;
+  struct s3 c = { 1.5, 2.5 }; if (s3_9cc(c) != 17.5) return 3;
+  struct s4 d = { 5, 0.5 }; if (s4_9cc(d) != 50.5) return 4;
+  struct s5 e = { 0.5, 3 }; if (s5_9cc(e) != 8) return 5;
+  struct s6 f = { 1, 2, 3 }; if (s6_9cc(f) != 123) return 6;
+  struct s7 g = { 1, 2, 3 }; if (s7_9cc(g) != 123) return 7;
+  struct s8 h = { 1, 2, 3 }; if (s8_9cc(h) != 123) return 8;
+  struct s9 i = { { 4 } }; i.c[19] = 5; if (s9_9cc(i) != 9) return 9;
+  if (s_many_9cc(1, 2, 3, 4, 5, b, 6) != 6445) return 10;
+  if (s_many_dbl_9cc(1, 2, 3, 4, 5, 6, 7, c, 8) != 8293) return 11;
+  if (s_mem_9cc(h, 4, a) != 1342) return 19;
+  struct s1 ra = ret_s1_9cc(1, 2); if (ra.a != 1 || ra.b != 2) return 12;
+  struct s4 rd = ret_s4_9cc(5, 6.5); if (rd.a != 5 || rd.d != 6.5) return 13;
+  struct s5 re = ret_s5_9cc(7.5, 8); if (re.d != 7.5 || re.a != 8) return 14;
+  struct s6 rf = ret_s6_9cc(1); if (rf.c[0] != 1 || rf.c[2] != 3) return 15;
+  struct s7 rg = ret_s7_9cc(1.5); if (rg.f != 1.5 || rg.h != 4.5) return 16;
+  struct s8 rh = ret_s8_9cc(2); if (rh.a != 2 || rh.c != 6) return 17;
+  struct s9 ri = ret_s9_9cc(3); if (ri.c[0] != 3 || ri.c[19] != 22) return 18;
+  return 0;
+}
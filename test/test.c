@@ -1,8 +1,13 @@
+#include <stdarg.h>
+#include <stddef.h>
+
 extern void *stderr;
 
 int printf();
 int fprintf();
 int exit();
+int strcmp();
+int vsprintf();
 
 #define EXPECT(expected, expr)                                  \
   do {                                                          \
@@ -22,16 +27,559 @@ int two() { return 2; }
 int plus(int x, int y) { return x + y; }
 int mul(int x, int y) { return x * y; }
 int add(int a, int b, int c, int d, int e, int f) { return a+b+c+d+e+f; }
+int add10_gcc();
+int call_add10_9cc();
+int add10_9cc(int a, int b, int c, int d, int e, int f, int g, int h, int i, int j) {
+  return a + b*2 + c*3 + d*4 + e*5 + f*6 + g*7 + h*8 + i*9 + j*10;
+}
+int sub7(int a, int b, int c, int d, int e, int f, int g) { return a-b-c-d-e-f-g; }
+int sprintf();
 int add2(int (*a)[2]) { return a[0][0] + a[1][0]; }
 int add3(int a[][2]) { return a[0][0] + a[1][0]; }
 int add4(int a[2][2]) { return a[0][0] + a[1][0]; }
 void nop() {}
 
+int sum_va(int n, ...) {
+  va_list ap;
+  va_start(ap, n);
+  int sum = 0;
+  for (int i = 0; i < n; i++)
+    sum = sum + va_arg(ap, int);
+  va_end(ap);
+  return sum;
+}
+
+int sum_va2(int n, ...) {
+  va_list ap;
+  va_list ap2;
+  va_start(ap, n);
+  va_arg(ap, int);
+  va_copy(ap2, ap);
+  int sum = va_arg(ap, int) + va_arg(ap2, int);
+  va_end(ap);
+  va_end(ap2);
+  return sum;
+}
+
+char *fmt_va(char *buf, char *fmt, ...) {
+  va_list ap;
+  va_start(ap, fmt);
+  vsprintf(buf, fmt, ap);
+  va_end(ap);
+  return buf;
+}
+
 int var1;
 int var2[5];
 extern int global_arr[1];
 typedef int myint;
 
+int g_arr[] = {1, 2, 3};
+int g_arr2[5] = {1, 2};
+char g_str[] = "abc";
+char g_str2[8] = "xy";
+int g_scalar = 3 * 4 + 1;
+int g_mat[2][3] = {{1, 2, 3}, {4, 5, 6}};
+int g_flat[2][2] = {1, 2, 3, 4};
+struct { char a; int b; int c[2]; } g_st = {1, 2, {3, 4}};
+struct { int x; int y; } g_desig = {.y = 7};
+int g_desig_arr[6] = {[4] = 9, 8, [1] = 2};
+char *g_msg = "hi";
+int g_x = 10;
+int *g_px = &g_x;
+int g_ys[4] = {1, 2, 3, 4};
+int *g_py = &g_ys[1] + 2;
+int *g_py2 = g_ys + 1;
+char *g_strs[] = {"ab", "cd", 0};
+struct { int a; char *s; int *p; } g_rel = {1, "xyz", &g_ys[2]};
+struct { int a; int b; } g_pair = {3, 4};
+int *g_pb = &g_pair.b;
+int g_big[100] = {1};
+int g_a, *g_b = &g_a, g_c[3] = {1, 2, 3};
+int (*g_table[4])() = {one, two, plus, mul};
+int (*g_pmat)[3] = g_mat;
+int three(void), four(void);
+int three(void) { return 3; }
+int four(void) { return 4; }
+int apply(int (*)(int, int), int, int);
+int apply(int (*fn)(int, int), int x, int y) { return fn(x, y); }
+int apply2(int fn(int, int), int x, int y) { return (*fn)(x, y); }
+typedef int binop_t(int, int);
+binop_t *pick(int i) { return i ? mul : plus; }
+int (*pick2(int i))(int, int) { return i ? mul : plus; }
+struct { int a, b, *c; } g_st2 = {1, 2, &g_a};
+short g_short = -3;
+unsigned char g_uchar = 200;
+long g_long = 1234567890123;
+unsigned long long g_ull = -1;
+int sub_short(short a, short b, short c) { return a - b - c; }
+long mul_long(long a, long b) { return a * b; }
+unsigned char to_uchar(int x) { unsigned char c = x; return c; }
+char ret_trunc(int x) { return x; }
+long ret_widen(int x) { return x; }
+double g_dbl = 2.5;
+float g_flt = 1.25f;
+double g_dbls[2] = {1, 0.5f};
+double dadd(double a, float b) { return a + b; }
+float fhalf(float x) { return x / 2; }
+int dtoi(double d) { return d; }
+double dsum10(double a, double b, double c, double d, double e, double f,
+              double g, double h, int i, double j) {
+  return a + b + c + d + e + f + g + h + i + j;
+}
+double dsum_va(int n, ...) {
+  va_list ap;
+  va_start(ap, n);
+  double sum = 0;
+  for (int i = 0; i < n; i++)
+    sum += va_arg(ap, double);
+  va_end(ap);
+  return sum;
+}
+_Bool g_bool = 5;
+_Bool g_bool2 = 0.5;
+bool g_bool3 = &g_x;
+_Bool to_bool(int x) { return x; }
+int bool_arg(_Bool b) { return b; }
+_Bool bool_gcc(_Bool b);
+typeof(int) g_typeof = 7;
+typeof(g_typeof) *g_typeof_p = &g_typeof;
+__auto_type g_auto = 3L;
+auto g_auto2 = g_arr;
+typeof(char[4]) g_typeof_arr;
+#define max(a, b) ({ typeof(a) a_ = (a); typeof(b) b_ = (b); a_ > b_ ? a_ : b_; })
+#define swap_vals(a, b) do { __auto_type t_ = (a); (a) = (b); (b) = t_; } while (0)
+int max_int(int a, int b) { return max(a, b); }
+double max_dbl(double a, double b) { return max(a, b); }
+long max_mixed(int a, long b) { return max(a, b); }
+int swap_test(int a, int b) { swap_vals(a, b); return a * 10 + b; }
+const int g_const = 42;
+const char g_const_str[] = "ro";
+const int g_const_arr[3] = {1, 2, 3};
+const char *g_const_ptr = "rw";
+int *const g_ptr_const = &g_x;
+volatile int g_volatile = 5;
+_Atomic int g_atomic = 6;
+_Atomic(long) g_atomic2 = 7;
+int const_len(const char *restrict s) { int n = 0; while (s[n]) n++; return n; }
+int const_sum(const int *a, int n) { int s = 0; for (int i = 0; i < n; i++) s += a[i]; return s; }
+const char *const_pass(const char *s) { return s + 1; }
+struct fwd;
+int fwd_get(const struct fwd *p);
+struct fwd { int a; int b; };
+int fwd_get(const struct fwd *p) { return p->b; }
+int counter() { static int n; return ++n; }
+int counter_init() { static int n = 10; n += 5; return n; }
+int *static_addr() { static int a[3] = {1, 2, 3}; return a; }
+int static_shadow() { static int n = 1; { static int n = 2; n++; } return n; }
+static int g_static = 8;
+static int static_fn(int x) { return x + g_static; }
+static inline int static_inl(int x) { return x * 3; }
+inline int inl_twice(int x) { return x * 2; }
+int helper_static(void);
+static int helper_static(void) { return 1; }
+int call_helper_gcc();
+int extern_local() { extern int g_x; return g_x; }
+int register_sum(register int n) { register int s = 0; for (register int i = 0; i < n; i++) s += i; return s; }
+int auto_local() { auto int a = 4; return a; }
+int g_9cc_var = 21;
+_Thread_local int tls_9cc = 13;
+__thread int tls_bss;
+thread_local char tls_str[4] = "ab";
+extern _Thread_local int tls_gcc;
+int get_tls_9cc_gcc();
+int get_9cc_var_gcc();
+int *tls_local_addr() { static _Thread_local int n = 3; n++; return &n; }
+struct bf1 { unsigned a : 3; unsigned b : 5; int c : 4; };
+struct bf2 { char x; int y : 20; int z : 20; };
+struct bf3 { char x; int : 0; char y; };
+struct bf4 { char x; int : 12; char y; };
+struct bf5 { long a : 40; unsigned long b : 24; _Bool f : 1; };
+struct bf6 { short a; int b : 17; char c : 3; };
+struct bfall { unsigned char a : 2; signed char b : 3; int c : 9; unsigned d : 30; long e : 33; _Bool f : 1; };
+int bf_size_gcc(int i);
+int bf_read_gcc(struct bfall *p, int i);
+void bf_write_gcc(struct bfall *p);
+int bf_sizes() {
+  int sz[6] = { sizeof(struct bf1), sizeof(struct bf2), sizeof(struct bf3), sizeof(struct bf4), sizeof(struct bf5), sizeof(struct bf6) };
+  for (int i = 0; i < 6; i++)
+    if (sz[i] != bf_size_gcc(i))
+      return i + 1;
+  return sizeof(struct bfall) == bf_size_gcc(6) ? 0 : 7;
+}
+int bf_signed() { struct bf1 s; s.c = 7; s.c++; return s.c; }
+int bf_unsigned_wrap() { struct bf1 s; s.a = 7; s.a++; return s.a; }
+int bf_post_inc() { struct bf1 s; s.a = 7; int old = s.a++; return old * 10 + s.a; }
+int bf_neighbors() { struct bf1 s; s.a = 0; s.b = 31; s.c = -1; s.a = 5; return s.a * 1000 + s.b * 10 + (s.c == -1); }
+int bf_assign_value() { struct bf1 s; return s.a = 9; }
+int bf_compound() { struct bf1 s; s.b = 20; s.b += 15; return s.b; }
+int bf_ptr() { struct bf2 s; struct bf2 *p = &s; p->y = -5; p->z = 300000; return p->y + (p->z == 300000); }
+long bf_long() { struct bf5 s; s.a = -3; s.b = 0xabcdef; s.f = 5; return s.a * 100 + (s.b == 0xabcdef) * 10 + s.f; }
+int bf_interop() {
+  struct bfall s;
+  s.a = 3; s.b = -4; s.c = -200; s.d = 1000000; s.e = -70000; s.f = 1;
+  if (bf_read_gcc(&s, 0) != 3) return 1;
+  if (bf_read_gcc(&s, 1) != -4) return 2;
+  if (bf_read_gcc(&s, 2) != -200) return 3;
+  if (bf_read_gcc(&s, 3) != 1000000) return 4;
+  if (bf_read_gcc(&s, 4) != -70000) return 5;
+  if (bf_read_gcc(&s, 5) != 1) return 6;
+  bf_write_gcc(&s);
+  if (s.a != 2 || s.b != 3 || s.c != 255 || s.d != 12345 || s.e != -1 || s.f != 0) return 7;
+  return 0;
+}
+struct bf1 g_bf1 = { 5, 17, -2 };
+struct bf3 g_bf3 = { 1, 2 };
+int bf_global() { return g_bf1.a * 1000 + g_bf1.b * 10 - g_bf1.c + g_bf3.y * 10000; }
+int bf_local_init() { struct bf1 s = { 6, 30, -8 }; struct bf3 t = { 3, 4 }; return s.a * 1000 + s.b * 10 - s.c + t.y * 10000; }
+int bf_desig() { struct bf1 s = { .c = 3, .a = 1 }; return s.a * 10 + s.c; }
+union u1 { int i; char c[4]; long l; };
+union u2 { char c; int bf : 5; };
+union u1 g_u1 = { 0x01020304 };
+int union_char() { union u1 u; u.i = 0x01020304; return u.c[0] * 10 + u.c[3]; }
+int union_desig() { union u1 u = { .l = 0x100000005 }; return u.i; }
+int union_bf() { union u2 u; u.c = 0; u.bf = -1; return u.c; }
+struct with_union { int tag; union { int i; double d; } v; };
+int union_member() { struct with_union w; w.tag = 1; w.v.d = 2.5; return w.v.d * 2 + sizeof(w); }
+struct s1 { int a; int b; };
+struct s2 { long a; long b; };
+struct s3 { double x; double y; };
+struct s4 { int a; double d; };
+struct s5 { double d; char a; };
+struct s6 { char c[3]; };
+struct s7 { float f; float g; float h; };
+struct s8 { long a; long b; long c; };
+struct s9 { char c[20]; };
+long s1_gcc(struct s1 s);
+long s2_gcc(struct s2 s);
+double s3_gcc(struct s3 s);
+double s4_gcc(struct s4 s);
+double s5_gcc(struct s5 s);
+int s6_gcc(struct s6 s);
+double s7_gcc(struct s7 s);
+long s8_gcc(struct s8 s);
+int s9_gcc(struct s9 s);
+long s_many_gcc(long a, long b, long c, long d, long e, struct s2 s, long f);
+double s_many_dbl_gcc(double a, double b, double c, double d, double e, double f, double g, struct s3 s, double h);
+long s_mem_gcc(struct s8 s, int m, struct s1 t);
+struct s1 ret_s1_gcc(int a, int b);
+struct s2 ret_s2_gcc(long a, long b);
+struct s3 ret_s3_gcc(double x, double y);
+struct s4 ret_s4_gcc(int a, double d);
+struct s5 ret_s5_gcc(double d, int a);
+struct s6 ret_s6_gcc(int a);
+struct s7 ret_s7_gcc(float f);
+struct s8 ret_s8_gcc(long a);
+struct s9 ret_s9_gcc(int a);
+int call_struct_9cc();
+long s1_9cc(struct s1 s) { return s.a * 10 + s.b; }
+long s2_9cc(struct s2 s) { return s.a * 10 + s.b; }
+double s3_9cc(struct s3 s) { return s.x * 10 + s.y; }
+double s4_9cc(struct s4 s) { return s.a * 10 + s.d; }
+double s5_9cc(struct s5 s) { return s.d * 10 + s.a; }
+int s6_9cc(struct s6 s) { return s.c[0] * 100 + s.c[1] * 10 + s.c[2]; }
+double s7_9cc(struct s7 s) { return s.f * 100 + s.g * 10 + s.h; }
+long s8_9cc(struct s8 s) { return s.a * 100 + s.b * 10 + s.c; }
+int s9_9cc(struct s9 s) { return s.c[0] + s.c[19]; }
+long s_many_9cc(long a, long b, long c, long d, long e, struct s2 s, long f) { return a + b + c + d + e + s.a * 10 + s.b * 100 + f * 1000; }
+double s_many_dbl_9cc(double a, double b, double c, double d, double e, double f, double g, struct s3 s, double h) { return a + b + c + d + e + f + g + s.x * 10 + s.y * 100 + h * 1000; }
+long s_mem_9cc(struct s8 s, int m, struct s1 t) { return s.a * 1000 + s.c * 100 + m * 10 + t.b; }
+struct s1 ret_s1_9cc(int a, int b) { struct s1 s = { a, b }; return s; }
+struct s2 ret_s2_9cc(long a, long b) { struct s2 s = { a, b }; return s; }
+struct s3 ret_s3_9cc(double x, double y) { struct s3 s = { x, y }; return s; }
+struct s4 ret_s4_9cc(int a, double d) { struct s4 s = { a, d }; return s; }
+struct s5 ret_s5_9cc(double d, int a) { struct s5 s = { d, a }; return s; }
+struct s6 ret_s6_9cc(int a) { struct s6 s = { a, a + 1, a + 2 }; return s; }
+struct s7 ret_s7_9cc(float f) { struct s7 s = { f, f * 2, f * 3 }; return s; }
+struct s8 ret_s8_9cc(long a) { struct s8 s = { a, a * 2, a * 3 }; return s; }
+struct s9 ret_s9_9cc(int a) { struct s9 s; for (int i = 0; i < 20; i++) s.c[i] = a + i; return s; }
+int struct_copy() { struct s8 a = { 1, 2, 3 }; struct s8 b; b = a; a.b = 9; return b.a * 100 + b.b * 10 + b.c; }
+int struct_copy_chain() { struct s1 a = { 4, 5 }, b, c; c = b = a; return c.a * 10 + c.b; }
+int struct_copy_ptr() { struct s6 a = { 1, 2, 3 }, b; struct s6 *p = &b; *p = a; return p->c[0] * 100 + p->c[1] * 10 + p->c[2]; }
+struct s9 g_s9;
+int struct_copy_global() { struct s9 a; for (int i = 0; i < 20; i++) a.c[i] = i; g_s9 = a; return g_s9.c[19]; }
+int struct_init_expr() { struct s4 a = { 7, 0.5 }; struct s4 b = a; return b.a + b.d * 2; }
+int struct_ret_member() { return ret_s8_9cc(2).c + ret_s1_gcc(3, 4).b; }
+int struct_cond(int x) { struct s1 a = { 1, 2 }, b = { 3, 4 }, c; c = x ? a : b; return c.a * 10 + c.b; }
+int struct_ret_9cc() {
+  struct s1 a = ret_s1_9cc(1, 2); if (a.a != 1 || a.b != 2) return 1;
+  struct s2 b = ret_s2_9cc(3, 4); if (b.a != 3 || b.b != 4) return 2;
+  struct s3 c = ret_s3_9cc(1.5, 2.5); if (c.x != 1.5 || c.y != 2.5) return 3;
+  struct s4 d = ret_s4_9cc(5, 6.5); if (d.a != 5 || d.d != 6.5) return 4;
+  struct s5 e = ret_s5_9cc(7.5, 8); if (e.d != 7.5 || e.a != 8) return 5;
+  struct s6 f = ret_s6_9cc(1); if (f.c[0] != 1 || f.c[2] != 3) return 6;
+  struct s7 g = ret_s7_9cc(1.5); if (g.f != 1.5 || g.h != 4.5) return 7;
+  struct s8 h = ret_s8_9cc(2); if (h.a != 2 || h.c != 6) return 8;
+  struct s9 i = ret_s9_9cc(3); if (i.c[0] != 3 || i.c[19] != 22) return 9;
+  return 0;
+}
+int struct_ret_gcc() {
+  struct s1 a = ret_s1_gcc(1, 2); if (a.a != 1 || a.b != 2) return 1;
+  struct s2 b = ret_s2_gcc(3, 4); if (b.a != 3 || b.b != 4) return 2;
+  struct s3 c = ret_s3_gcc(1.5, 2.5); if (c.x != 1.5 || c.y != 2.5) return 3;
+  struct s4 d = ret_s4_gcc(5, 6.5); if (d.a != 5 || d.d != 6.5) return 4;
+  struct s5 e = ret_s5_gcc(7.5, 8); if (e.d != 7.5 || e.a != 8) return 5;
+  struct s6 f = ret_s6_gcc(1); if (f.c[0] != 1 || f.c[2] != 3) return 6;
+  struct s7 g = ret_s7_gcc(1.5); if (g.f != 1.5 || g.h != 4.5) return 7;
+  struct s8 h = ret_s8_gcc(2); if (h.a != 2 || h.c != 6) return 8;
+  struct s9 i = ret_s9_gcc(3); if (i.c[0] != 3 || i.c[19] != 22) return 9;
+  return 0;
+}
+int struct_arg_gcc() {
+  struct s1 a = { 1, 2 }; if (s1_gcc(a) != 12) return 1;
+  struct s2 b = { 3, 4 }; if (s2_gcc(b) != 34) return 2;
+  struct s3 c = { 1.5, 2.5 }; if (s3_gcc(c) != 17.5) return 3;
+  struct s4 d = { 5, 0.5 }; if (s4_gcc(d) != 50.5) return 4;
+  struct s5 e = { 0.5, 3 }; if (s5_gcc(e) != 8) return 5;
+  struct s6 f = { 1, 2, 3 }; if (s6_gcc(f) != 123) return 6;
+  struct s7 g = { 1, 2, 3 }; if (s7_gcc(g) != 123) return 7;
+  struct s8 h = { 1, 2, 3 }; if (s8_gcc(h) != 123) return 8;
+  struct s9 i; i.c[0] = 4; i.c[19] = 5; if (s9_gcc(i) != 9) return 9;
+  if (s_many_gcc(1, 2, 3, 4, 5, b, 6) != 6445) return 10;
+  if (s_many_dbl_gcc(1, 2, 3, 4, 5, 6, 7, c, 8) != 8293) return 11;
+  if (s_mem_gcc(h, 4, a) != 1342) return 12;
+  return 0;
+}
+#define N_ELEMS 3
+int const_ary_size() { int a[N_ELEMS*2]; return sizeof(a); }
+int const_ary_sizeof() { char a[sizeof(struct { int x; char y; })]; return sizeof(a); }
+int const_ary_cond() { char a[1 < 2 ? 5 : 7]; return sizeof(a); }
+int const_ary_cast() { char a[(char)257]; return sizeof(a); }
+int const_unsigned_div() { char a[-1U / 0x10000000U]; return sizeof(a); }
+int const_unsigned_shr() { char a[-1U >> 29]; return sizeof(a); }
+int const_unsigned_lt() { char a[(-1 < 0U) + 1]; return sizeof(a); }
+int const_signed_lt() { char a[(-1 < 0) + 1]; return sizeof(a); }
+
+enum color { RED, GREEN = 5, BLUE, ALPHA = BLUE * 2 };
+enum { ONE = 1, TWO };
+enum color g_color = BLUE;
+int enum_val() { return RED + GREEN + BLUE + ALPHA; }
+int enum_var() { enum color c = GREEN; return c; }
+int enum_size() { enum color c; return sizeof(c) + sizeof(enum color); }
+int enum_anon() { return ONE * 10 + TWO; }
+int enum_ary() { int a[ALPHA]; return sizeof(a) / sizeof(a[0]); }
+int enum_bf() { struct { int a : TWO; int b : ALPHA; } x; x.b = 100; return x.b; }
+int enum_shadow() { int RED = 7; return RED; }
+int enum_scope() { { enum { RED = 9 }; if (RED != 9) return 0; } return RED + 1; }
+int enum_trailing() { enum { A, B, C, }; return C; }
+
+int sw(int x) {
+  int r = 0;
+  switch (x) {
+  case 1: r += 1;
+  case 2: r += 2; break;
+  case 3: return 30;
+  case ONE + TWO + 1: r = 40; break;
+  default: r = 99;
+  }
+  return r;
+}
+int sw_nodefault(int x) {
+  int r = 5;
+  switch (x) { case 1: r = 10; }
+  return r;
+}
+int sw_loop() {
+  int sum = 0;
+  for (int i = 0; i < 10; i++) {
+    switch (i % 3) {
+    case 0: continue;
+    case 1: sum += i; break;
+    default: sum += 100;
+    }
+    sum += 1000;
+  }
+  return sum;
+}
+int sw_char(char c) {
+  switch (c) {
+  case 'a': return 1;
+  case -1: return 2;
+  }
+  return 3;
+}
+int sw_unsigned(unsigned x) {
+  switch (x) {
+  case -1: return 1;
+  case 0: return 2;
+  }
+  return 3;
+}
+int sw_long(long x) {
+  switch (x) {
+  case 0x100000000: return 1;
+  case 0: return 2;
+  }
+  return 3;
+}
+int sw_nested(int x, int y) {
+  switch (x) {
+  case 0:
+    switch (y) {
+    case 0: return 1;
+    default: break;
+    }
+    return 2;
+  default:
+    return 3;
+  }
+}
+int sw_duff(int n) {
+  int c = 0;
+  int i = (n + 3) / 4;
+  switch (n % 4) {
+  case 0: do { c++;
+  case 3: c++;
+  case 2: c++;
+  case 1: c++;
+          } while (--i > 0);
+  }
+  return c;
+}
+int cont_for() {
+  int sum = 0;
+  for (int i = 0; i < 10; i++) {
+    if (i % 2)
+      continue;
+    sum += i;
+  }
+  return sum;
+}
+int cont_while() {
+  int i = 0, sum = 0;
+  while (i < 10) {
+    i++;
+    if (i % 2)
+      continue;
+    sum += i;
+  }
+  return sum;
+}
+int cont_do() {
+  int i = 0, sum = 0;
+  do {
+    i++;
+    if (i > 5)
+      continue;
+    sum += i;
+  } while (i < 10);
+  return sum;
+}
+
+struct off { char a; int b; struct { short c; long d[3]; } e; };
+int offsetof_b() { return offsetof(struct off, b); }
+int offsetof_e() { return offsetof(struct off, e); }
+int offsetof_d() { return offsetof(struct off, e.d); }
+int offsetof_d2() { return offsetof(struct off, e.d[2]); }
+int offsetof_ary() { char a[offsetof(struct off, e.c) + 1]; return sizeof(a); }
+int offsetof_size() { return sizeof(offsetof(struct off, b)); }
+int stddef_types() { size_t a; ptrdiff_t b; return sizeof(a) + sizeof(b) + (NULL == 0); }
+
+_Static_assert(sizeof(int) == 4, "int must be 4 bytes");
+struct sa { int x; _Static_assert(1, "in a struct"); int y; };
+int static_assert_local() { _Static_assert(ALPHA == 12, "alpha"); return sizeof(struct sa); }
+
+int g_ary[5] = { 1, 2, 3, 4, 5 };
+int *g_ary_p = &g_ary[2];
+int *g_ary_q = g_ary + 3;
+char *g_str_p = "abc" + 1;
+struct { int a; int b; } g_ac_st;
+int *g_st_p = &g_ac_st.b;
+int addr_const() { return *g_ary_p * 100 + *g_ary_q * 10 + (g_st_p == &g_ac_st.b); }
+int addr_const_str() { return *g_str_p; }
+int ptr_diff() { int a[10]; return &a[7] - &a[2]; }
+int ptr_diff_neg() { int a[10]; int *p = a + 1, *q = a + 8; return p - q; }
+int ptr_diff_struct() { struct { char c[12]; } a[5]; return &a[4] - a; }
+int ptr_diff_char() { char *s = "hello"; char *e = s; while (*e) e++; return e - s; }
+int ptr_diff_type() { long a[2]; return sizeof(&a[1] - &a[0]); }
+int ptr_diff_void() { char a[8]; void *p = a, *q = a + 5; return q - p; }
+int ptr_cmp() { int a[4]; int *p = &a[1], *q = &a[3]; return (p < q) * 1000 + (q <= p) * 100 + (p == q) * 10 + (p != q); }
+int ptr_cmp_high() { char *p = (char *)0x7fffffffffffffff, *q = (char *)0x8000000000000000; return p < q; }
+int ptr_null() { int x; int *p = 0, *q = &x; return (p == 0) * 100 + (q != 0) * 10 + (0 == p); }
+int ptr_null_void() { int *p = (void *)0; return p == (void *)0; }
+int ptr_void_cmp() { int x; int *p = &x; void *v = &x; return v == p; }
+int *void_to_ptr(void *v) { return v; }
+void *ptr_to_void(int *p) { return p; }
+int void_conv() { int x = 5; void *v = &x; int *p = v; *p = 7; return *void_to_ptr(ptr_to_void(&x)) + x; }
+int cond_null(int c) { int x = 3; int *p = c ? &x : 0; return p ? *p : -1; }
+int cond_void(int c) { int x = 4; void *v = &x; char *s = "a"; return *(char *)(c ? v : s) == 'a'; }
+double proto_half(double x) { return x / 2; }
+int proto_conv() { return proto_half(7) * 2; }
+int proto_char(char c) { return c; }
+int proto_trunc() { return proto_char(0x141); }
+int proto_ptr(void *p) { return p != 0; }
+int proto_void_arg() { int x; return proto_ptr(&x); }
+double noproto_dbl();
+int noproto_call() { float f = 1.5; return noproto_dbl(f) * 2; }
+double noproto_dbl(double d) { return d; }
+int noproto_redecl();
+int noproto_redecl(int a, long b);
+int noproto_redecl();
+int noproto_redecl(int a, long b) { return a + b; }
+int proto_kept() { return noproto_redecl(1, 2); }
+int fwd_struct_size();
+struct fwd2;
+struct fwd2 *fwd2_ptr;
+struct fwd2 { int a[5]; };
+int fwd_struct_size() { return sizeof(*fwd2_ptr); }
+int stmt_expr_ret(int x) { int y = ({ if (x) return 7; 3; }); return y; }
+int case_range(int x) { switch (x) { case 1 ... 3: return 1; case 4: return 2; case 5 ... 10: return 3; } return 0; }
+int case_range_u(unsigned x) { switch (x) { case 0 ... 9: return 1; case 4000000000u ... 4294967295u: return 2; } return 0; }
+int case_range_ch(char c) { switch (c) { case 'a' ... 'z': return 1; case 'A' ... 'Z': return 2; default: return 0; } }
+__extension__ typedef long g_ext_t;
+__extension__ g_ext_t g_ext = 5;
+int g_elvis = 0 ?: 4;
+int g_zero_ary[0];
+struct zero_ary { int n; int d[0]; };
+static __inline__ int ext_inline(int x) { return x + 1; }
+int asm_stmt() { int x = 3; __asm__ volatile ("nop"); asm("nop"); return x; }
+_Noreturn void nr_exit(int c) { exit(c); }
+int nr_ret(int x) { if (x) return 5; nr_exit(1); }
+struct align_s { char a; _Alignas(16) char b; };
+struct align_m { int x; static_assert(sizeof(int) == 4); alignas(long) char c; };
+_Alignas(64) char g_align64[2];
+static alignas(8) char g_align8;
+int align_local() { char a; _Alignas(16) char b; a = 1; return (long)&b % 16 + a - 1; }
+int align_rec(int n, int a, int b, int c, int d, int e, int f, int g) {
+  _Alignas(64) char buf[3];
+  buf[0] = n;
+  if ((long)buf % 64)
+    return -1;
+  if (n == 0)
+    return a + b + c + d + e + f + g;
+  int r = align_rec(n - 1, a, b, c, d, e, f, g);
+  return r < 0 ? r : r + buf[0];
+}
+long align_va(int n, ...) {
+  _Alignas(64) long x = 0;
+  va_list ap;
+  va_start(ap, n);
+  for (int i = 0; i < n; i++)
+    x += va_arg(ap, long);
+  va_end(ap);
+  return (long)&x % 64 ? -1 : x;
+}
+static_assert(sizeof(struct align_s) == 32, "align_s");
+static_assert(_Alignof(struct align_s) == 16);
+struct attr_pk { char a; int b; short c; } __attribute__((packed));
+struct __attribute__((__packed__)) attr_pk2 { char a; long b; };
+struct attr_mpk { char a; int b __attribute__((packed)); };
+struct attr_al { char a; } __attribute__((aligned(8)));
+struct [[gnu::packed]] attr_c23 { char a; int b; };
+int attr_sec __attribute__((section(".data.attr_sec"))) = 7;
+int attr_weak __attribute__((weak)) = 9;
+extern int attr_undef __attribute__((weak));
+__attribute__((visibility("hidden"))) int attr_hidden = 11;
+int attr_aligned __attribute__((aligned(32)));
+int attr_ctor_val;
+__attribute__((constructor)) static void attr_ctor() { attr_ctor_val = attr_ctor_val * 10 + 1; }
+__attribute__((constructor(101))) static void attr_ctor_first() { attr_ctor_val = 5; }
+__attribute__((noinline)) int attr_second(int a [[maybe_unused]], int b) { return b; }
+
+double fmix_gcc(double a, float b, int c, double d);
+double call_fmix_9cc();
+double fmix_9cc(double a, float b, int c, double d) { return a + b * c - d; }
+
 // Single-line comment test
 
 
@@ -55,12 +603,12 @@ int main() {
   EXPECT(45, (2+3)*(4+5));
   EXPECT(153, 1+2+3+4+5+6+7+8+9+10+11+12+13+14+15+16+17);
 
-  EXPECT(2, ({ int a=2; return a; }));
-  EXPECT(10, ({ int a=2; int b; b=3+2; return a*b; }));
-  EXPECT(2, ({ if (1) return 2; return 3; }));
-  EXPECT(3, ({ if (0) return 2; return 3; }));
-  EXPECT(2, ({ if (1) return 2; else return 3; }));
-  EXPECT(3, ({ if (0) return 2; else return 3; }));
+  EXPECT(2, ({ int a=2; a; }));
+  EXPECT(10, ({ int a=2; int b; b=3+2; a*b; }));
+  EXPECT(2, ({ int x = 3; if (1) x = 2; x; }));
+  EXPECT(3, ({ int x = 3; if (0) x = 2; x; }));
+  EXPECT(2, ({ int x; if (1) x = 2; else x = 3; x; }));
+  EXPECT(3, ({ int x; if (0) x = 2; else x = 3; x; }));
 
   EXPECT(5, plus(2, 3));
   EXPECT(1, one());
@@ -112,10 +660,10 @@ int main() {
   EXPECT(-1, ~0);
   EXPECT(-4, ~3);
 
-  EXPECT(3, ({ int i = 3; return i++;}));
-  EXPECT(4, ({ int i = 3; return ++i;}));
-  EXPECT(3, ({ int i = 3; return i--;}));
-  EXPECT(2, ({ int i = 3; return --i;}));
+  EXPECT(3, ({ int i = 3; i++;}));
+  EXPECT(4, ({ int i = 3; ++i;}));
+  EXPECT(3, ({ int i = 3; i--;}));
+  EXPECT(2, ({ int i = 3; --i;}));
 
   EXPECT(5, 0 ? 3 : 5);
   EXPECT(3, 1 ? 3 : 5);
@@ -128,75 +676,75 @@ int main() {
   EXPECT(2, 6 & 3);
   EXPECT(0, 6 & 0);
 
-  EXPECT(3, ({int x; int y; x=y=3; return x;}));
-  EXPECT(3, ({int x; int y; x=y=3; return y;}));
+  EXPECT(3, ({int x; int y; x=y=3; x;}));
+  EXPECT(3, ({int x; int y; x=y=3; y;}));
 
 
-  EXPECT(45, ({ int x=0; int y=0; do { y=y+x; x=x+1; } while (x < 10); return y; }));
+  EXPECT(45, ({ int x=0; int y=0; do { y=y+x; x=x+1; } while (x < 10); y; }));
 
-  EXPECT(60, ({ int sum=0; int i; for (i=10; i<15; i=i+1) sum = sum + i; return sum;}));
-  EXPECT(89, ({ int i=1; int j=1; for (int k=0; k<10; k=k+1) { int m=i+j; i=j; j=m; } return i;}));
-  EXPECT(1, ({ int i=1; for (int i = 5; i < 10; i++); return i;}));
-  EXPECT(5, ({ int i=0; for (0; i < 10; i++) if (i==5) break; return i;}));
-  EXPECT(10, ({ int i=0; for(;;) { i++; if (i==10) break;} return i;}));
-  EXPECT(45, ({ int i=0; int j=0; while(i<10) {j=j+i; i=i+1;} return j;}));
+  EXPECT(60, ({ int sum=0; int i; for (i=10; i<15; i=i+1) sum = sum + i; sum;}));
+  EXPECT(89, ({ int i=1; int j=1; for (int k=0; k<10; k=k+1) { int m=i+j; i=j; j=m; } i;}));
+  EXPECT(1, ({ int i=1; for (int i = 5; i < 10; i++); i;}));
+  EXPECT(5, ({ int i=0; for (0; i < 10; i++) if (i==5) break; i;}));
+  EXPECT(10, ({ int i=0; for(;;) { i++; if (i==10) break;} i;}));
+  EXPECT(45, ({ int i=0; int j=0; while(i<10) {j=j+i; i=i+1;} j;}));
 
-  EXPECT(3, ({ int ary[2]; *ary=1; *(ary+1)=2; return *ary + *(ary+1);}));
-  EXPECT(5, ({ int x; int *p = &x; x = 5; return *p;}));
+  EXPECT(3, ({ int ary[2]; *ary=1; *(ary+1)=2; *ary + *(ary+1);}));
+  EXPECT(5, ({ int x; int *p = &x; x = 5; *p;}));
 
-  EXPECT(40, ({ int ary[2][5]; return sizeof(ary);}));
-  EXPECT(8, ({ int ary[2][2]; ary[0][0]=3; ary[1][0]=5; return add2(ary);}));
-  EXPECT(8, ({ int ary[2][2]; ary[0][0]=3; ary[1][0]=5; return add3(ary);}));
-  EXPECT(8, ({ int ary[2][2]; ary[0][0]=3; ary[1][0]=5; return add4(ary);}));
+  EXPECT(40, ({ int ary[2][5]; sizeof(ary);}));
+  EXPECT(8, ({ int ary[2][2]; ary[0][0]=3; ary[1][0]=5; add2(ary);}));
+  EXPECT(8, ({ int ary[2][2]; ary[0][0]=3; ary[1][0]=5; add3(ary);}));
+  EXPECT(8, ({ int ary[2][2]; ary[0][0]=3; ary[1][0]=5; add4(ary);}));
 
-  EXPECT(3, ({ int ary[2]; ary[0]=1; ary[1]=2; return ary[0] + ary[0+1];}));
-  EXPECT(5, ({ int x; int *p = &x; x = 5; return p[0];}));
-  EXPECT(1, ({ int ary[2]; ary[0]=1; ary[1]=2; int *p=ary; return *p++;}));
-  EXPECT(2, ({ int ary[2]; ary[0]=1; ary[1]=2; int *p=ary; return *++p;}));
+  EXPECT(3, ({ int ary[2]; ary[0]=1; ary[1]=2; ary[0] + ary[0+1];}));
+  EXPECT(5, ({ int x; int *p = &x; x = 5; p[0];}));
+  EXPECT(1, ({ int ary[2]; ary[0]=1; ary[1]=2; int *p=ary; *p++;}));
+  EXPECT(2, ({ int ary[2]; ary[0]=1; ary[1]=2; int *p=ary; *++p;}));
 
-  EXPECT(1, ({ char x; return sizeof x; }));
-  EXPECT(4, ({ int x; return sizeof(x); }));
-  EXPECT(8, ({ int *x; return sizeof x; }));
-  EXPECT(16, ({ int x[4]; return sizeof x; }));
+  EXPECT(1, ({ char x; sizeof x; }));
+  EXPECT(4, ({ int x; sizeof(x); }));
+  EXPECT(8, ({ int *x; sizeof x; }));
+  EXPECT(16, ({ int x[4]; sizeof x; }));
   EXPECT(4, sizeof("abc"));
   EXPECT(7, sizeof("abc" "def"));
   EXPECT(9, sizeof("ab\0c" "\0def"));
 
-  EXPECT(1, ({ char x; return _Alignof x;}));
-  EXPECT(4, ({ int x; return _Alignof x;}));
-  EXPECT(8, ({ int *x; return _Alignof x;}));
-  EXPECT(4, ({ int x[4]; return _Alignof x;}));
-  EXPECT(8, ({ int *x[4]; return _Alignof x;}));
+  EXPECT(1, ({ char x; _Alignof x;}));
+  EXPECT(4, ({ int x; _Alignof x;}));
+  EXPECT(8, ({ int *x; _Alignof x;}));
+  EXPECT(4, ({ int x[4]; _Alignof x;}));
+  EXPECT(8, ({ int *x[4]; _Alignof x;}));
   
 
-  EXPECT(5, ({ char x = 5; return x; }));
-  EXPECT(42, ({ int x = 0; char *p = &x; p[0] = 42; return x; }));
+  EXPECT(5, ({ char x = 5; x; }));
+  EXPECT(42, ({ int x = 0; char *p = &x; p[0] = 42; x; }));
   
 
-  EXPECT('a', ({ char *p = "abc"; return p[0]; }));
-  EXPECT('b', ({ char *p = "abc"; return p[1]; }));
-  EXPECT('c', ({ char *p = "abc"; return p[2]; }));
-  EXPECT(0, ({ char *p = "abc"; return p[3]; }));
+  EXPECT('a', ({ char *p = "abc"; p[0]; }));
+  EXPECT('b', ({ char *p = "abc"; p[1]; }));
+  EXPECT('c', ({ char *p = "abc"; p[2]; }));
+  EXPECT(0, ({ char *p = "abc"; p[3]; }));
 
-  EXPECT(1, ({ int x = 1; { int x = 2; } return x; }));
+  EXPECT(1, ({ int x = 1; { int x = 2; } x; }));
 
   EXPECT(0, var1);
-  EXPECT(5, ({ var1 = 5; return var1; }));
+  EXPECT(5, ({ var1 = 5; var1; }));
   EXPECT(20, sizeof(var2));
-  EXPECT(15, ({ var2[0] = 5; var2[4] = 10; return var2[0] + var2[4]; }));
+  EXPECT(15, ({ var2[0] = 5; var2[4] = 10; var2[0] + var2[4]; }));
   EXPECT(5, global_arr[0]);
 
-  EXPECT(8, ({ return 3 + ({ return 5; }); }));
-  EXPECT(1, ({; return 1;}));
-
-  EXPECT(4, ({ struct { int a; } x; return sizeof(x);}));
-  EXPECT(8, ({ struct { char a; int b; } x; return sizeof(x);}));
-  EXPECT(12, ({ struct { char a; char b; int c; char d; } x; return sizeof(x);}));
-  EXPECT(3, ({ struct { int a; } x; x.a=3; return x.a; }));
-  EXPECT(8, ({ struct { char a; int b; } x; x.a=3; x.b=5; return x.a+x.b;}));
-  EXPECT(8, ({ struct { char a; int b; } x; struct { char a; int b; } *p = &x; x.a=3; x.b=5; return p->a+p->b; }));
-  EXPECT(8, ({ struct tag { char a; int b; } x; struct tag *p = &x; x.a=3; x.b=5; return p->a+p->b; }));
-  EXPECT(48, ({ struct { struct { int b; int c[5]; } a[2]; } x; return sizeof(x);}));
+  EXPECT(8, ({ 3 + ({ 5; }); }));
+  EXPECT(1, ({; 1;}));
+
+  EXPECT(4, ({ struct { int a; } x; sizeof(x);}));
+  EXPECT(8, ({ struct { char a; int b; } x; sizeof(x);}));
+  EXPECT(12, ({ struct { char a; char b; int c; char d; } x; sizeof(x);}));
+  EXPECT(3, ({ struct { int a; } x; x.a=3; x.a; }));
+  EXPECT(8, ({ struct { char a; int b; } x; x.a=3; x.b=5; x.a+x.b;}));
+  EXPECT(8, ({ struct { char a; int b; } x; struct { char a; int b; } *p = &x; x.a=3; x.b=5; p->a+p->b; }));
+  EXPECT(8, ({ struct tag { char a; int b; } x; struct tag *p = &x; x.a=3; x.b=5; p->a+p->b; }));
+  EXPECT(48, ({ struct { struct { int b; int c[5]; } a[2]; } x; sizeof(x);}));
   
   EXPECT(8, ({
       struct {
@@ -207,24 +755,617 @@ int main() {
       } x;
       x.a[0].b = 3;
       x.a[0].c[1] = 5;
-      return x.a[0].b + x.a[0].c[1];
+      x.a[0].b + x.a[0].c[1];
   }));
 
-  EXPECT(3, ({ typedef int foo; foo x = 3; return x;}));
-  EXPECT(4, ({ myint foo = 3; return sizeof(foo);}));
-
-  EXPECT(1, ({ typedef struct foo_ foo; return 1;}));
-
-  EXPECT(15, ({ int i=5; i*=3; return i;}));
-  EXPECT(1, ({ int i=5; i/=3; return i;}));
-  EXPECT(2, ({ int i=5; i%=3; return i;}));
-  EXPECT(8, ({ int i=5; i+=3; return i;}));
-  EXPECT(2, ({ int i=5; i-=3; return i;}));
-  EXPECT(40, ({ int i=5; i<<=3; return i;}));
-  EXPECT(0, ({ int i=5; i>>=3; return i;}));
-  EXPECT(1, ({ int i=5; i&=3; return i;}));
-  EXPECT(6, ({ int i=5; i^=3; return i;}));
-  EXPECT(7, ({ int i=5; i|=3; return i;}));
+  EXPECT(3, ({ typedef int foo; foo x = 3; x;}));
+  EXPECT(4, ({ myint foo = 3; sizeof(foo);}));
+
+  EXPECT(1, ({ typedef struct foo_ foo; 1;}));
+
+  EXPECT(0, sum_va(0));
+  EXPECT(3, sum_va(1, 3));
+  EXPECT(15, sum_va(5, 1, 2, 3, 4, 5));
+  EXPECT(6, sum_va2(2, 1, 3));
+  EXPECT(55, sum_va(10, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10));
+  EXPECT(21, sum_va(6, 1, 2, 3, 4, 5, 6));
+
+  EXPECT(385, add10_gcc(1, 2, 3, 4, 5, 6, 7, 8, 9, 10));
+  EXPECT(385, add10_9cc(1, 2, 3, 4, 5, 6, 7, 8, 9, 10));
+  EXPECT(385, call_add10_9cc());
+  EXPECT(22, sub7(50, 1, 2, 3, 4, 5, 13));
+  EXPECT(-6, sub7(sub7(1, 1, 1, 1, 1, 1, 1), 0, 0, 0, 0, 0, plus(1, 0)));
+  EXPECT(0, ({ char buf[64]; sprintf(buf, "%d %d %d %d %d %d %d %d", 1, 2, 3, 4, 5, 6, 7, 8); strcmp(buf, "1 2 3 4 5 6 7 8"); }));
+  EXPECT(0, ({ char buf[32]; strcmp(fmt_va(buf, "%d-%s-%c", 12, "ab", 'x'), "12-ab-x"); }));
+
+  EXPECT(6, ({ int a[] = {1, 2, 3}; a[0] + a[1] + a[2]; }));
+  EXPECT(12, ({ int a[] = {1, 2, 3}; sizeof(a); }));
+  EXPECT(0, ({ int a[4] = {1}; a[1] + a[2] + a[3]; }));
+  EXPECT(0, ({ int a[3] = {}; a[0] + a[1] + a[2]; }));
+  EXPECT(4, ({ char s[] = "abc"; sizeof(s); }));
+  EXPECT(99, ({ char s[] = "abc"; s[2]; }));
+  EXPECT(0, ({ char s[] = "abc"; s[3]; }));
+  EXPECT(0, ({ char s[10] = "abc"; s[9]; }));
+  EXPECT(98, ({ char s[] = {"abc"}; s[1]; }));
+  EXPECT(3, ({ char s[3] = "abc"; sizeof(s); }));
+  EXPECT(3, ({ int x = {3}; x; }));
+  EXPECT(6, ({ int a[2][3] = {{1, 2, 3}, {4, 5, 6}}; a[1][2]; }));
+  EXPECT(5, ({ int a[2][3] = {1, 2, 3, 4, 5, 6}; a[1][1]; }));
+  EXPECT(0, ({ int a[2][3] = {{1}, {4}}; a[0][1] + a[1][2]; }));
+  EXPECT(4, ({ int a[2][3] = {{1}, {4}}; a[1][0]; }));
+  EXPECT(24, ({ int a[][3] = {{1}, {4}}; sizeof(a); }));
+  EXPECT(3, ({ struct { int a; int b; } x = {1, 2}; x.a + x.b; }));
+  EXPECT(0, ({ struct { int a; int b; } x = {1}; x.b; }));
+  EXPECT(7, ({ struct { int a; int b; } x = {.b = 7}; x.a + x.b; }));
+  EXPECT(10, ({ struct { int a; int b; int c; } x = {.b = 3, 7}; x.b + x.c; }));
+  EXPECT(6, ({ struct { char a; int b[2]; } x = {1, {2, 3}}; x.a + x.b[0] + x.b[1]; }));
+  EXPECT(6, ({ struct { char a; int b[2]; } x = {1, 2, 3}; x.a + x.b[0] + x.b[1]; }));
+  EXPECT(15, ({ struct { int a; int b; } x[2] = {{1, 2}, [1].b = 5, [1].a = 7}; x[0].a + x[0].b + x[1].a + x[1].b; }));
+  EXPECT(5, ({ int a[5] = {[3] = 5}; a[3] + a[0] + a[4]; }));
+  EXPECT(8, ({ int a[] = {[2] = 3, 4}; sizeof(a) / 4 + a[3]; }));
+  EXPECT(9, ({ int a[5] = {1, [3] = 2, 6}; a[0] + a[3] + a[4] - a[1]; }));
+  EXPECT(3, ({ struct { int a[2]; int b; } x = {.a[1] = 1, 2}; x.a[1] + x.b; }));
+  EXPECT(98, ({ char *p = "abc"; char s[2][4] = {"xyz", "abc"}; s[1][1]; }));
+
+  EXPECT(105, g_msg[1]);
+  EXPECT(10, *g_px);
+  EXPECT(4, *g_py);
+  EXPECT(2, *g_py2);
+  EXPECT(99, g_strs[1][0]);
+  EXPECT(0, g_strs[2]);
+  EXPECT(121, g_rel.s[1]);
+  EXPECT(3, *g_rel.p);
+  EXPECT(4, *g_pb);
+  EXPECT(400, sizeof(g_big));
+  EXPECT(1, g_big[0] + g_big[99]);
+
+  EXPECT(5, ({ *g_b = 5; g_a; }));
+  EXPECT(12, sizeof(g_c));
+  EXPECT(3, g_c[2]);
+  EXPECT(1, g_table[0]());
+  EXPECT(2, (*g_table[1])());
+  EXPECT(7, g_table[2](3, 4));
+  EXPECT(12, g_table[3](3, 4));
+  EXPECT(32, sizeof(g_table));
+  EXPECT(5, g_pmat[1][1]);
+  EXPECT(7, three() + four());
+  EXPECT(11, apply(plus, 5, 6));
+  EXPECT(30, apply(mul, 5, 6));
+  EXPECT(30, apply2(mul, 5, 6));
+  EXPECT(9, pick(0)(4, 5));
+  EXPECT(20, pick2(1)(4, 5));
+  EXPECT(1, g_table[3] == mul);
+  EXPECT(1, &plus == plus);
+  EXPECT(3, g_st2.a + g_st2.b);
+  EXPECT(1, g_st2.c == &g_a);
+  EXPECT(7, ({ int a = 3, *b = &a, c[2] = {4, 0}; *b + c[0]; }));
+  EXPECT(6, ({ int (*fp)(int, int) = plus; fp(2, 4); }));
+  EXPECT(8, ({ int (*fp)(int, int) = plus; (*fp)(4, 4); }));
+  EXPECT(3, ({ int (*fps[2])(); fps[0] = one; fps[1] = two; fps[0]() + fps[1](); }));
+  EXPECT(24, ({ int (*p)[3]; sizeof(*p) * 2; }));
+  EXPECT(8, ({ int *(x); sizeof(x); }));
+  EXPECT(5, ({ int f(int, int); typedef int t1, *t2; t1 a = 2; t2 b = &a; *b + 3; }));
+  EXPECT(3, ({ int x = 0; for (int i = 0, j = 3; i < j; i++) x++; x; }));
+  EXPECT(7, ({ struct { int a, b; } s; s.a = 3; s.b = 4; s.a + s.b; }));
+
+  EXPECT(3, g_arr[2]);
+  EXPECT(12, sizeof(g_arr));
+  EXPECT(2, g_arr2[1] + g_arr2[4]);
+  EXPECT(4, sizeof(g_str));
+  EXPECT(98, g_str[1]);
+  EXPECT(0, g_str2[7]);
+  EXPECT(121, g_str2[1]);
+  EXPECT(13, g_scalar);
+  EXPECT(6, g_mat[1][2]);
+  EXPECT(3, g_flat[1][0]);
+  EXPECT(10, g_st.a + g_st.b + g_st.c[0] + g_st.c[1]);
+  EXPECT(7, g_desig.x + g_desig.y);
+  EXPECT(19, g_desig_arr[4] + g_desig_arr[5] + g_desig_arr[1] + g_desig_arr[0]);
+
+  EXPECT(2, ({ short x; sizeof(x); }));
+  EXPECT(8, ({ long x; sizeof(x); }));
+  EXPECT(8, ({ long long x; sizeof(x); }));
+  EXPECT(8, ({ long unsigned int x; sizeof(x); }));
+  EXPECT(4, ({ unsigned x; sizeof(x); }));
+  EXPECT(4, ({ signed x; sizeof(x); }));
+  EXPECT(1, ({ unsigned char x; sizeof(x); }));
+  EXPECT(2, ({ short int unsigned x; sizeof(x); }));
+  EXPECT(4, sizeof(1));
+  EXPECT(4, sizeof(1u));
+  EXPECT(8, sizeof(1L));
+  EXPECT(8, sizeof(1ull));
+  EXPECT(8, sizeof(4294967296));
+  EXPECT(4, sizeof(0xffffffff));
+  EXPECT(8, sizeof(4294967295));
+  EXPECT(-1, ({ char c = 255; c; }));
+  EXPECT(-1, ({ signed char c = 255; c; }));
+  EXPECT(255, ({ unsigned char c = 255; c; }));
+  EXPECT(-1, ({ short s = 65535; s; }));
+  EXPECT(65535, ({ unsigned short s = -1; s; }));
+  EXPECT(-3, g_short);
+  EXPECT(200, g_uchar);
+  EXPECT(1, g_long == 1234567890123);
+  EXPECT(1, g_ull == -1);
+  EXPECT(-6, sub_short(7, 3, 10));
+  EXPECT(1, mul_long(3000000000, 3) == 9000000000);
+  EXPECT(44, to_uchar(300));
+  EXPECT(-3, -7 / 2);
+  EXPECT(-1, -7 % 2);
+  EXPECT(-4, ({ int x = -8; x >> 1; }));
+  EXPECT(1, ({ unsigned x = 0x80000000; x >> 31; }));
+  EXPECT(2147483647, ({ unsigned x = 4294967295u; x / 2; }));
+  EXPECT(1, ({ unsigned x = 4294967295u; x % 2; }));
+  EXPECT(1, ({ unsigned long a = -1; unsigned long b = 1; b < a; }));
+  EXPECT(1, ({ unsigned long a = -1; unsigned long b = 1; b <= a; }));
+  EXPECT(0, ({ long a = -1; long b = 1; b < a; }));
+  EXPECT(1, ({ int x = 2147483647; x + 1 < 0; }));
+  EXPECT(0, ({ unsigned x = 4294967295u; x++; x; }));
+  EXPECT(1, ({ long x = 1; x = x << 40; x >> 40; }));
+  EXPECT(1, ({ long x = 4294967296; x == 4294967296; }));
+  EXPECT(1, ({ unsigned char c = 250; c += 10; c == 4; }));
+
+  EXPECT(200, ({ char c = 100; c + c; }));
+  EXPECT(400, ({ unsigned char a = 200; a + a; }));
+  EXPECT(0, ({ int x = -1; unsigned y = 1; x < y; }));
+  EXPECT(1, ({ long x = -1; unsigned y = 1; x < y; }));
+  EXPECT(0, -1 < 0u);
+  EXPECT(1, -1 < 0);
+  EXPECT(1, ({ int i = -1; unsigned long u = i; u == -1; }));
+  EXPECT(1, ({ long l = 4294967297; int i = l; i; }));
+  EXPECT(44, ({ char c; c = 300; c; }));
+  EXPECT(44, ret_trunc(300));
+  EXPECT(1, ret_widen(-1) == -1);
+  EXPECT(-6, sub_short(65536 + 7, 3, 10));
+  EXPECT(1, ({ int x = -1; unsigned y = 0; (1 ? x : y) > 0; }));
+  EXPECT(4, ({ char c; sizeof(c + c); }));
+  EXPECT(4, ({ char c; sizeof(-c); }));
+  EXPECT(4, ({ short s; sizeof(s << 1); }));
+  EXPECT(8, ({ long l; int i; sizeof(l + i); }));
+  EXPECT(8, sizeof(1 ? 1 : 1L));
+  EXPECT(4, sizeof(1L < 2));
+  EXPECT(246, ({ unsigned char c = 10; c -= 20; c; }));
+  EXPECT(2147483647, ({ int x = -2; unsigned y = 2; x /= y; x; }));
+  EXPECT(0, ({ short s = 1; s <<= 20; s; }));
+  EXPECT(1, ({ long l = 1; l <<= 40; l == 1099511627776; }));
+  EXPECT(1, 1u << 31 >> 31);
+  EXPECT(-1, -2147483647 - 1 >> 31);
+  EXPECT(1, 2147483647 + 1 < 0);
+
+  EXPECT(1, 1.5 == 1.5);
+  EXPECT(1, 0.1 + 0.2 != 0.3);
+  EXPECT(1, .5 < 1);
+  EXPECT(0, 1.0f > 1);
+  EXPECT(1, 2.f <= 2.0);
+  EXPECT(1000, 1e3);
+  EXPECT(12, 0x1.8p3);
+  EXPECT(4, sizeof(1.0f));
+  EXPECT(8, sizeof(1.0));
+  EXPECT(8, sizeof(1.0L));
+  EXPECT(8, sizeof(1.0f + 1.0));
+  EXPECT(4, sizeof(1.0f + 1));
+  EXPECT(3, 7.5 / 2.5);
+  EXPECT(-3, 1.5 - 4.5);
+  EXPECT(6, 1.5 * 4);
+  EXPECT(-2, -2.5);
+  EXPECT(1, !0.0);
+  EXPECT(0, !0.5);
+  EXPECT(1, 0.5 && 1);
+  EXPECT(0, 0.0 || 0);
+  EXPECT(3, 0.1 ? 3 : 4);
+  EXPECT(1, ({ double x = -0.0; int r = 1; if (x) r = 2; r; }));
+  EXPECT(-3, ({ double d = -3.7; int i = d; i; }));
+  EXPECT(1, ({ int i = -7; double d = i; d == -7.0; }));
+  EXPECT(1, ({ float f = 0.1; double d = f; d != 0.1; }));
+  EXPECT(1, ({ float f = 0.5; double d = f; d == 0.5; }));
+  EXPECT(1, ({ unsigned long u = 18000000000000000000ul; double d = u; d == 1.8e19; }));
+  EXPECT(1, ({ double d = 1.8e19; unsigned long u = d; u == 18000000000000000000ul; }));
+  EXPECT(1, ({ unsigned u = 4000000000; double d = u; d == 4e9; }));
+  EXPECT(2, ({ char c = 2.9; c; }));
+  EXPECT(4, ({ double d = 1.5; d++; ++d; d + 0.5; }));
+  EXPECT(1, ({ double d = 1.5; d-- == 1.5 && d == 0.5; }));
+  EXPECT(10, ({ double d = 4; d *= 2.5; d; }));
+  EXPECT(3, ({ int i = 7; i /= 2.0; i; }));
+  EXPECT(1, ({ float f = 2; f += 0.5; f == 2.5; }));
+  EXPECT(1, g_dbl == 2.5);
+  EXPECT(1, g_flt == 1.25);
+  EXPECT(1, g_dbls[0] + g_dbls[1] == 1.5);
+  EXPECT(1, dadd(1, 2.5) == 3.5);
+  EXPECT(1, fhalf(3) == 1.5);
+  EXPECT(-2, dtoi(-2.5));
+  EXPECT(55, dsum10(1, 2, 3, 4, 5, 6, 7, 8, 9, 10));
+  EXPECT(1, dsum_va(3, 1.0, 2.0, 3.5) == 6.5);
+  EXPECT(1, fmix_gcc(1.5, 2.0f, 3, 0.25) == 7.25);
+  EXPECT(1, call_fmix_9cc() == 7.25);
+  EXPECT(0, ({ char buf[32]; strcmp(fmt_va(buf, "%.2f %d %.1f", 3.14159, 5, 0.5), "3.14 5 0.5"); }));
+  EXPECT(0, ({ char buf[32]; sprintf(buf, "%.3f", 1.0f / 8); strcmp(buf, "0.125"); }));
+
+  EXPECT(4, sizeof(int));
+  EXPECT(1, sizeof(char));
+  EXPECT(8, sizeof(int *));
+  EXPECT(24, sizeof(int[2][3]));
+  EXPECT(8, sizeof(int (*)[3]));
+  EXPECT(8, sizeof(int (*)(int, int)));
+  EXPECT(4, sizeof(float));
+  EXPECT(8, sizeof(double));
+  EXPECT(8, sizeof(long double));
+  EXPECT(8, sizeof(unsigned long long));
+  EXPECT(8, sizeof(myint *));
+  EXPECT(12, sizeof(struct { char a; int b; short c; }));
+  EXPECT(3, sizeof(int) - 1);
+  EXPECT(4, _Alignof(int));
+  EXPECT(8, _Alignof(long));
+  EXPECT(1, _Alignof(char[3]));
+  EXPECT(4, _Alignof(struct { char a; int b; }));
+  EXPECT(4, sizeof (3));
+  EXPECT(8, sizeof(g_dbl) * (1));
+  EXPECT(3, (int)3.9);
+  EXPECT(-3, (int)-3.9);
+  EXPECT(44, (char)300);
+  EXPECT(200, (unsigned char)200);
+  EXPECT(-56, (char)200);
+  EXPECT(-1, (short)65535);
+  EXPECT(65535, (unsigned short)-1);
+  EXPECT(1, (long)-1 < 0);
+  EXPECT(0, (unsigned)-1 < 0);
+  EXPECT(1, (unsigned long)-1 == 18446744073709551615ul);
+  EXPECT(1, (int)4294967297L);
+  EXPECT(1, (myint)1);
+  EXPECT(8, sizeof((long)1));
+  EXPECT(1, sizeof((char)1));
+  EXPECT(7, (int)(7.5f));
+  EXPECT(1, (double)1 / 2 == 0.5);
+  EXPECT(0, (double)(1 / 2));
+  EXPECT(2, (int)(double)(float)2.5);
+  EXPECT(1, ({ int x = 0x01020304; char *p = (char *)&x; *p == 4; }));
+  EXPECT(2, ({ int x[2] = {1, 2}; long a = (long)x; *(int *)(a + 4); }));
+  EXPECT(1, ({ int x; void *p = (void *)&x; (int *)p == &x; }));
+  EXPECT(3, ({ int x = 3; (void)x; x; }));
+  EXPECT(0, ({ (void)nop(); 0; }));
+  EXPECT(-2, -(int)2.5);
+  EXPECT(1, !(int)0.5);
+  EXPECT(3, (int)3.5 / (int)1.5);
+  EXPECT(3, ((int (*)(void))three)());
+  EXPECT(3, (1 + 2));
+  EXPECT(1, sizeof(_Bool));
+  EXPECT(1, sizeof(bool));
+  EXPECT(1, _Alignof(_Bool));
+  EXPECT(1, true);
+  EXPECT(0, false);
+  EXPECT(1, sizeof(true));
+  EXPECT(2, true + true);
+  EXPECT(1, ({ _Bool b = 2; b; }));
+  EXPECT(0, ({ _Bool b = 0; b; }));
+  EXPECT(1, ({ _Bool b = 256; b; }));
+  EXPECT(1, ({ _Bool b = 0.1; b; }));
+  EXPECT(0, ({ _Bool b = 0.0; b; }));
+  EXPECT(1, ({ _Bool b = -0.5f; b; }));
+  EXPECT(1, ({ int x; _Bool b = &x; b; }));
+  EXPECT(0, ({ char *p = 0; _Bool b = p; b; }));
+  EXPECT(1, ({ long l = 4294967296; _Bool b = l; b; }));
+  EXPECT(1, (_Bool)2);
+  EXPECT(0, (_Bool)0);
+  EXPECT(1, (bool)0.5);
+  EXPECT(1, (_Bool)4294967296);
+  EXPECT(1, ({ _Bool b = 1; b++; b; }));
+  EXPECT(1, ({ _Bool b = 1; b++; }));
+  EXPECT(1, ({ _Bool b = 1; ++b; }));
+  EXPECT(0, ({ _Bool b = 1; b--; b; }));
+  EXPECT(1, ({ _Bool b = 0; b--; b; }));
+  EXPECT(1, ({ _Bool b = 0; b += 2; b; }));
+  EXPECT(0, ({ _Bool b = 1; b -= 1; b; }));
+  EXPECT(1, ({ _Bool b = 0; b |= 4; b; }));
+  EXPECT(1, ({ _Bool b[4] = {0, 3, 0, 1}; b[1]; }));
+  EXPECT(1, ({ struct { char c; _Bool b; } s; s.b = 10; s.b; }));
+  EXPECT(1, ({ _Bool b = 1; -b < 0; }));
+  EXPECT(1, g_bool);
+  EXPECT(1, g_bool2);
+  EXPECT(1, g_bool3);
+  EXPECT(1, to_bool(256));
+  EXPECT(0, to_bool(0));
+  EXPECT(1, bool_arg(512));
+  EXPECT(1, bool_gcc(42));
+  EXPECT(0, bool_gcc(0));
+  EXPECT(4, ({ typeof(1) x; sizeof(x); }));
+  EXPECT(8, ({ typeof(1L) x; sizeof(x); }));
+  EXPECT(1, ({ char c; typeof(c) x; sizeof(x); }));
+  EXPECT(12, ({ int a[3]; typeof(a) b; sizeof(b); }));
+  EXPECT(8, ({ int a[3]; typeof(a + 0) b; sizeof(b); }));
+  EXPECT(8, ({ typeof(int *) p; sizeof(p); }));
+  EXPECT(24, ({ typeof(int[3]) a[2]; sizeof(a); }));
+  EXPECT(8, ({ char c; typeof(c) *p; sizeof(p); }));
+  EXPECT(4, ({ char c; typeof(c + c) x; sizeof(x); }));
+  EXPECT(8, ({ typeof(1.0) d; sizeof(d); }));
+  EXPECT(4, sizeof(typeof(1.0f)));
+  EXPECT(4, sizeof(typeof_unqual(int)));
+  EXPECT(3, ({ int x = 3; typeof(x) y = x; y; }));
+  EXPECT(0, ({ int x = 0; typeof(x++) y; x; }));
+  EXPECT(8, ({ long l; sizeof((typeof(l))1); }));
+  EXPECT(1, ({ struct { int a; typeof(char) b; } s; sizeof(s.b); }));
+  EXPECT(8, ({ struct { int a; long b; } s; typeof(s.b) x; sizeof(x); }));
+  EXPECT(4, ({ struct P { int x; } p; typeof(p) q; sizeof(q); }));
+  EXPECT(8, ({ typeof(plus) *fp = plus; sizeof(fp); }));
+  EXPECT(5, ({ typeof(plus) *fp = plus; fp(2, 3); }));
+  EXPECT(4, ({ typeof(plus(1, 2)) r; sizeof(r); }));
+  EXPECT(1, ({ int x, r; { char x; typeof(x) y; r = sizeof(y); } r; }));
+  EXPECT(4, ({ int x; { char x; } typeof(x) y; sizeof(y); }));
+  EXPECT(4, ({ typeof(({ int i = 1; i; })) y; sizeof(y); }));
+  EXPECT(7, g_typeof);
+  EXPECT(7, *g_typeof_p);
+  EXPECT(8, sizeof(g_auto));
+  EXPECT(3, g_auto);
+  EXPECT(2, g_auto2[1]);
+  EXPECT(4, sizeof(g_typeof_arr));
+  EXPECT(4, ({ __auto_type x = 1; sizeof(x); }));
+  EXPECT(8, ({ __auto_type x = 1L; sizeof(x); }));
+  EXPECT(8, ({ auto x = 1.5; sizeof(x); }));
+  EXPECT(1, ({ auto x = 1.5; x == 1.5; }));
+  EXPECT(8, ({ int a[3]; auto p = a; sizeof(p); }));
+  EXPECT(2, ({ int a[3] = {1, 2, 3}; auto p = a; p[1]; }));
+  EXPECT(8, ({ auto s = "abc"; sizeof(s); }));
+  EXPECT(5, ({ auto fp = plus; fp(2, 3); }));
+  EXPECT(3, ({ auto a = 1, b = 2L; a + b; }));
+  EXPECT(8, ({ auto a = 1, b = 2L; sizeof(b); }));
+  EXPECT(4, ({ auto int x = 3; sizeof(x) + x - 3; }));
+  EXPECT(8, ({ auto x = 3; auto y = x * 2L; sizeof(y); }));
+  EXPECT(1, ({ char c = 1; __auto_type d = c; sizeof(d); }));
+  EXPECT(5, max_int(3, 5));
+  EXPECT(3, max_dbl(3.0, 0.5));
+  EXPECT(5, max_mixed(1, 5));
+  EXPECT(21, swap_test(1, 2));
+  EXPECT(3, ({ typedef int T; int r; { int T = 3; r = T; } r; }));
+  EXPECT(4, ({ typedef int T; { int T = 3; } T x; sizeof(x); }));
+  EXPECT(6, ({ int n = 0; for (int i = 0; i < 3; i++) { typeof(i) j = i; n += j * 2; } n; }));
+  EXPECT(42, g_const);
+  EXPECT(0, strcmp(g_const_str, "ro"));
+  EXPECT(6, g_const_arr[0] + g_const_arr[1] + g_const_arr[2]);
+  EXPECT(0, strcmp(g_const_ptr, "rw"));
+  EXPECT(10, *g_ptr_const);
+  EXPECT(5, g_volatile);
+  EXPECT(6, g_atomic);
+  EXPECT(7, g_atomic2);
+  EXPECT(8, sizeof(g_atomic2));
+  EXPECT(3, ({ const int x = 3; x; x; }));
+  EXPECT(5, ({ int const x = 5; x; }));
+  EXPECT(4, ({ const int x = 3; typeof_unqual(x) y = 4; y = y; y; }));
+  EXPECT(4, ({ const int x = 3; __auto_type y = x; y = 4; y; }));
+  EXPECT(7, ({ const int x = 3; typeof(x + 1) y = 0; y = 7; y; }));
+  EXPECT(3, ({ const char *p = "abc"; p++; const_len(p) + 1; }));
+  EXPECT(3, ({ char buf[4] = "xyz"; const_len(buf); }));
+  EXPECT(2, ({ char c = 'a'; char *const p = &c; *p = 2; c; }));
+  EXPECT(10, ({ int a[4] = {1, 2, 3, 4}; const_sum(a, 4); }));
+  EXPECT(98, *const_pass("abc"));
+  EXPECT(4, ({ const int *const *volatile pp; sizeof(**pp); }));
+  EXPECT(8, ({ int *restrict p; sizeof(p); }));
+  EXPECT(1, ({ volatile int x = 1; int y = x; y; }));
+  EXPECT(3, ({ volatile int x = 1; x += 2; x; }));
+  EXPECT(2, ({ _Atomic int x = 1; x++; x; }));
+  EXPECT(4, sizeof(const int));
+  EXPECT(8, sizeof(const char *const));
+  EXPECT(4, sizeof(_Atomic(int)));
+  EXPECT(2, (const int)2);
+  EXPECT(7, ({ struct T7 { int a; } s = {7}; const struct T7 *p = &s; p->a; }));
+  EXPECT(9, ({ struct fwd f = {8, 9}; fwd_get(&f); }));
+  EXPECT(2, ({ const struct { int a; int b; } s = {1, 2}; s.b; }));
+  EXPECT(1, counter());
+  EXPECT(2, counter());
+  EXPECT(3, counter());
+  EXPECT(15, counter_init());
+  EXPECT(20, counter_init());
+  EXPECT(2, static_addr()[1]);
+  EXPECT(1, static_addr() == static_addr());
+  EXPECT(1, static_shadow());
+  EXPECT(10, static_fn(2));
+  EXPECT(9, static_inl(3));
+  EXPECT(8, inl_twice(4));
+  EXPECT(1, helper_static());
+  EXPECT(2, call_helper_gcc());
+  EXPECT(10, extern_local());
+  EXPECT(10, register_sum(5));
+  EXPECT(4, auto_local());
+  EXPECT(13, tls_9cc);
+  EXPECT(14, ({ tls_9cc++; tls_9cc; }));
+  EXPECT(14, get_tls_9cc_gcc());
+  EXPECT(0, tls_bss);
+  EXPECT(5, ({ tls_bss = 5; tls_bss; }));
+  EXPECT('b', tls_str[1]);
+  EXPECT(11, tls_gcc);
+  EXPECT(12, ({ int *p = &tls_gcc; *p = 12; tls_gcc; }));
+  EXPECT(4, *tls_local_addr());
+  EXPECT(5, *tls_local_addr());
+  EXPECT(21, get_9cc_var_gcc());
+  EXPECT(2, ({ static int s = 2; s; }));
+  EXPECT(0, bf_sizes());
+  EXPECT(4, sizeof(struct bf1));
+  EXPECT(-8, bf_signed());
+  EXPECT(0, bf_unsigned_wrap());
+  EXPECT(70, bf_post_inc());
+  EXPECT(5311, bf_neighbors());
+  EXPECT(1, bf_assign_value());
+  EXPECT(3, bf_compound());
+  EXPECT(-4, bf_ptr());
+  EXPECT(-289, bf_long());
+  EXPECT(0, bf_interop());
+  EXPECT(25172, bf_global());
+  EXPECT(46308, bf_local_init());
+  EXPECT(13, bf_desig());
+  EXPECT(8, sizeof(union u1));
+  EXPECT(4, sizeof(union u2));
+  EXPECT(4, g_u1.c[0]);
+  EXPECT(41, union_char());
+  EXPECT(5, union_desig());
+  EXPECT(31, union_bf());
+  EXPECT(21, union_member());
+  EXPECT(123, struct_copy());
+  EXPECT(45, struct_copy_chain());
+  EXPECT(123, struct_copy_ptr());
+  EXPECT(19, struct_copy_global());
+  EXPECT(8, struct_init_expr());
+  EXPECT(10, struct_ret_member());
+  EXPECT(12, struct_cond(1));
+  EXPECT(34, struct_cond(0));
+  EXPECT(0, struct_ret_9cc());
+  EXPECT(0, struct_ret_gcc());
+  EXPECT(0, struct_arg_gcc());
+  EXPECT(0, call_struct_9cc());
+  EXPECT(24, const_ary_size());
+  EXPECT(8, const_ary_sizeof());
+  EXPECT(5, const_ary_cond());
+  EXPECT(1, const_ary_cast());
+  EXPECT(15, const_unsigned_div());
+  EXPECT(7, const_unsigned_shr());
+  EXPECT(1, const_unsigned_lt());
+  EXPECT(2, const_signed_lt());
+  EXPECT(23, enum_val());
+  EXPECT(5, enum_var());
+  EXPECT(6, g_color);
+  EXPECT(8, enum_size());
+  EXPECT(12, enum_anon());
+  EXPECT(12, enum_ary());
+  EXPECT(100, enum_bf());
+  EXPECT(7, enum_shadow());
+  EXPECT(1, enum_scope());
+  EXPECT(2, enum_trailing());
+  EXPECT(3, sw(1));
+  EXPECT(2, sw(2));
+  EXPECT(30, sw(3));
+  EXPECT(40, sw(4));
+  EXPECT(99, sw(5));
+  EXPECT(10, sw_nodefault(1));
+  EXPECT(5, sw_nodefault(2));
+  EXPECT(6312, sw_loop());
+  EXPECT(1, sw_char('a'));
+  EXPECT(2, sw_char(-1));
+  EXPECT(3, sw_char(0));
+  EXPECT(1, sw_unsigned(-1));
+  EXPECT(2, sw_unsigned(0));
+  EXPECT(3, sw_long(0x200000000));
+  EXPECT(1, sw_long(0x100000000));
+  EXPECT(2, sw_long(0));
+  EXPECT(1, sw_nested(0, 0));
+  EXPECT(2, sw_nested(0, 1));
+  EXPECT(3, sw_nested(1, 0));
+  EXPECT(7, sw_duff(7));
+  EXPECT(8, sw_duff(8));
+  EXPECT(20, cont_for());
+  EXPECT(30, cont_while());
+  EXPECT(15, cont_do());
+  EXPECT(4, offsetof_b());
+  EXPECT(8, offsetof_e());
+  EXPECT(16, offsetof_d());
+  EXPECT(32, offsetof_d2());
+  EXPECT(9, offsetof_ary());
+  EXPECT(8, offsetof_size());
+  EXPECT(17, stddef_types());
+  EXPECT(8, static_assert_local());
+  EXPECT(341, addr_const());
+  EXPECT(98, addr_const_str());
+  EXPECT(5, ptr_diff());
+  EXPECT(-7, ptr_diff_neg());
+  EXPECT(4, ptr_diff_struct());
+  EXPECT(5, ptr_diff_char());
+  EXPECT(8, ptr_diff_type());
+  EXPECT(5, ptr_diff_void());
+  EXPECT(1001, ptr_cmp());
+  EXPECT(1, ptr_cmp_high());
+  EXPECT(111, ptr_null());
+  EXPECT(1, ptr_null_void());
+  EXPECT(1, ptr_void_cmp());
+  EXPECT(14, void_conv());
+  EXPECT(3, cond_null(1));
+  EXPECT(-1, cond_null(0));
+  EXPECT(1, cond_void(0));
+  EXPECT(7, proto_conv());
+  EXPECT(65, proto_trunc());
+  EXPECT(1, proto_void_arg());
+  EXPECT(3, noproto_call());
+  EXPECT(3, proto_kept());
+  EXPECT(20, fwd_struct_size());
+  EXPECT(8, sizeof(({ 1L; })));
+  EXPECT(1, sizeof(({ char c = 1; c; })));
+  EXPECT(8, sizeof(({ char a[4]; a; })));
+  EXPECT(2, ({ 2.5; }));
+  EXPECT(5, ({ int x = 5; ({ if (x) x; }); x; }));
+  EXPECT(7, stmt_expr_ret(1));
+  EXPECT(3, stmt_expr_ret(0));
+  EXPECT(3, __extension__ ({ 3; }));
+  EXPECT(5, g_ext);
+  EXPECT(8, ({ __extension__ long x = 1; sizeof(x); }));
+  EXPECT(0, case_range(0));
+  EXPECT(1, case_range(3));
+  EXPECT(2, case_range(4));
+  EXPECT(3, case_range(10));
+  EXPECT(0, case_range(11));
+  EXPECT(1, case_range_u(9));
+  EXPECT(0, case_range_u(10));
+  EXPECT(2, case_range_u(4294967295u));
+  EXPECT(1, case_range_ch('q'));
+  EXPECT(2, case_range_ch('Q'));
+  EXPECT(0, case_range_ch('0'));
+  EXPECT(5, 5 ?: 7);
+  EXPECT(7, 0 ?: 7);
+  EXPECT(4, g_elvis);
+  EXPECT(2, ({ int i = 1; i++ ?: 9; i; }));
+  EXPECT(9, ({ int i = 0; i++ ?: 9; }));
+  EXPECT(1, (0.5 ?: 2) == 0.5);
+  EXPECT(97, ({ char *p = 0; *(p ?: "ab"); }));
+  EXPECT(0, sizeof(g_zero_ary));
+  EXPECT(4, sizeof(struct zero_ary));
+  EXPECT(0, ({ int a[0]; sizeof(a); }));
+  EXPECT(8, ({ __typeof__(1L) x; sizeof(x); }));
+  EXPECT(4, ({ __typeof(1) x; sizeof(x); }));
+  EXPECT(3, ext_inline(2));
+  EXPECT(3, asm_stmt());
+  EXPECT(5, nr_ret(1));
+  EXPECT(32, sizeof(struct align_s));
+  EXPECT(16, _Alignof(struct align_s));
+  EXPECT(16, ({ struct align_s s; (char *)&s.b - (char *)&s; }));
+  EXPECT(16, sizeof(struct align_m));
+  EXPECT(8, alignof(struct align_m));
+  EXPECT(0, (long)g_align64 % 64);
+  EXPECT(0, (long)&g_align8 % 8);
+  EXPECT(0, align_local());
+  EXPECT(34, align_rec(3, 1, 2, 3, 4, 5, 6, 7));
+  EXPECT(36, align_va(8, 1L, 2L, 3L, 4L, 5L, 6L, 7L, 8L));
+  EXPECT(0, ({ _Alignas(32) int a[3]; a[2] = 5; (long)a % 32 + a[2] - 5; }));
+  EXPECT(1, _Generic(1, int: 1, unsigned: 2, long: 3, default: 0));
+  EXPECT(2, _Generic(1u, int: 1, unsigned: 2, long: 3, default: 0));
+  EXPECT(3, _Generic(1L, int: 1, unsigned: 2, long: 3, default: 0));
+  EXPECT(0, _Generic(1.0f, int: 1, double: 2, default: 0));
+  EXPECT(2, _Generic(1.0, int: 1, double: 2, default: 0));
+  EXPECT(2, _Generic("a", const char *: 1, char *: 2));
+  EXPECT(2, ({ struct align_s s; _Generic(s, struct align_m: 1, struct align_s: 2); }));
+  EXPECT(1, ({ const int c = 0; _Generic(c, int: 1, const int: 2); }));
+  EXPECT(1, ({ char a[2]; _Generic(a, char *: 1, char [2]: 2); }));
+  EXPECT(1, ({ int i = 0; _Generic(i++, int: 1) + i; }));
+  EXPECT(7, sizeof(struct attr_pk));
+  EXPECT(1, _Alignof(struct attr_pk));
+  EXPECT(1, (long)&((struct attr_pk *)0)->b);
+  EXPECT(6, ({ struct attr_pk p; p.a = 1; p.b = 2; p.c = 3; p.a + p.b + p.c; }));
+  EXPECT(9, sizeof(struct attr_pk2));
+  EXPECT(5, sizeof(struct attr_mpk));
+  EXPECT(8, sizeof(struct attr_al));
+  EXPECT(8, _Alignof(struct attr_al));
+  EXPECT(5, sizeof(struct attr_c23));
+  EXPECT(7, attr_sec);
+  EXPECT(9, attr_weak);
+  EXPECT(1, &attr_undef == 0);
+  EXPECT(11, attr_hidden);
+  EXPECT(0, (long)&attr_aligned % 32);
+  EXPECT(51, attr_ctor_val);
+  EXPECT(3, attr_second(1, 3));
+  EXPECT(2, ({ int x = 1; switch (x) { case 1: x++; __attribute__((fallthrough)); case 2: [[fallthrough]]; default: ; } x; }));
+
+  EXPECT(13, ({ struct ia { int x, y; }; typeof(({ struct ia t = {.y = 4, .x = 3}; t; })) q = {.y = 2, .x = 1}; __auto_type r = ({ struct ia t = {.y = 4, .x = 3}; t; }); q.x * 10 + r.x; }));
+  EXPECT(15, ({ int i=5; i*=3; i;}));
+  EXPECT(1, ({ int i=5; i/=3; i;}));
+  EXPECT(2, ({ int i=5; i%=3; i;}));
+  EXPECT(8, ({ int i=5; i+=3; i;}));
+  EXPECT(2, ({ int i=5; i-=3; i;}));
+  EXPECT(40, ({ int i=5; i<<=3; i;}));
+  EXPECT(0, ({ int i=5; i>>=3; i;}));
+  EXPECT(1, ({ int i=5; i&=3; i;}));
+  EXPECT(6, ({ int i=5; i^=3; i;}));
+  EXPECT(7, ({ int i=5; i|=3; i;}));
 
   printf("OK\n");
   return 0;